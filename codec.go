@@ -0,0 +1,69 @@
+package databank
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// Built-in codecs.
+var (
+	Gob  Codec = &GobCodec{}
+	JSON Codec = &JSONCodec{}
+)
+
+// ErrUnknownCodec is returned when reading a value encoded with a codec that is not configured.
+var ErrUnknownCodec = errors.New("unknown value codec")
+
+// Codec encodes and decodes structured values, for use with WriteValue and ReadValue.
+// Implement it to use other serialization formats, such as MessagePack or protobuf.
+type Codec interface {
+	// Name of the codec, recorded in entry metadata so that values can be decoded.
+	// It must be unique, and must not change once values have been stored with it.
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal into v, which must be a pointer.
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// GobCodec encodes values with encoding/gob.
+// Interface values must be registered with gob.Register.
+type GobCodec struct{}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+// Marshal a value.
+func (c *GobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Name of the codec.
+func (c *GobCodec) Name() string {
+	return "gob"
+}
+
+// Unmarshal a value.
+func (c *GobCodec) Unmarshal(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// Marshal a value.
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Name of the codec.
+func (c *JSONCodec) Name() string {
+	return "json"
+}
+
+// Unmarshal a value.
+func (c *JSONCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
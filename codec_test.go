@@ -0,0 +1,111 @@
+package databank_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name  string
+	Roles []string
+}
+
+// upperCodec is a custom codec wrapping JSON.
+type upperCodec struct {
+	databank.JSONCodec
+}
+
+func (c *upperCodec) Name() string {
+	return "upper"
+}
+
+func Test_Value(t *testing.T) {
+	for _, codec := range []databank.Codec{databank.Gob, databank.JSON} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			a := assert.New(t)
+			c := databank.NewConfig()
+			c.Codec = codec
+			db := databank.New(c, atomicdb.New())
+
+			in := user{"alice", []string{"admin"}}
+			e, ok, err := db.WriteValue("user", in)
+			a.Nil(err)
+			a.True(ok)
+			a.Equal(codec.Name(), e.Meta.Codec)
+			a.Equal(databank.TypeValue, e.Meta.Type)
+
+			out := user{}
+			ok, err = db.ReadValue(e.ID(), &out)
+			a.True(ok)
+			a.Nil(err)
+			a.Equal(in, out)
+
+			ok, err = db.ReadValue("missing", &out)
+			a.False(ok)
+			a.Nil(err)
+
+			_, ok = db.ReadString(e.ID())
+			a.False(ok)
+		})
+	}
+}
+
+func Test_Value_Context(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New()).WithContext(context.Background())
+
+	in := user{"alice", []string{"admin"}}
+	e, ok, err := db.WriteValue("user", in)
+	a.Nil(err)
+	a.True(ok)
+
+	out := user{}
+	ok, err = db.ReadValue(e.ID(), &out)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal(in, out)
+}
+
+func Test_Value_Codecs(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+
+	// values written with one codec can be read by a databank configured with another
+	c := databank.NewConfig()
+	c.Codec = databank.Gob
+	e, _, _ := databank.New(c, back).WriteValue("gob", user{Name: "bob"})
+	db := databank.New(nil, back)
+	out := user{}
+	_, err := db.ReadValue(e.ID(), &out)
+	a.Nil(err)
+	a.Equal("bob", out.Name)
+
+	// custom codecs must be configured to be read
+	c = databank.NewConfig()
+	c.Codec = &upperCodec{}
+	e, _, _ = databank.New(c, back).WriteValue("upper", user{Name: "carol"})
+	_, err = db.ReadValue(e.ID(), &out)
+	a.True(errors.Is(err, databank.ErrUnknownCodec))
+	_, err = databank.New(c, back).ReadValue(e.ID(), &out)
+	a.Nil(err)
+	a.Equal("carol", out.Name)
+
+	// untyped content is read with the configured codec
+	raw := databank.NewEntry("raw", 0)
+	raw.Content = []byte(`{"Name":"dave"}`)
+	db.Write(raw)
+	_, err = db.ReadValue(raw.ID(), &out)
+	a.Nil(err)
+	a.Equal("dave", out.Name)
+
+	// unencodable values are not written
+	_, ok, err := db.WriteValue("func", func() {})
+	a.False(ok)
+	a.NotNil(err)
+	a.False(db.Has("func"))
+}
@@ -4,9 +4,20 @@ import "time"
 
 // Config object for a Databank.
 type Config struct {
+	// Codec for writing structured values with WriteValue.
+	// Default is JSON.
+	Codec Codec
+	// Codecs that can be read with ReadValue, in addition to Codec.
+	// Include any codecs previously used with the same storage.
+	// Default is all built-in codecs.
+	Codecs []Codec
 	// Hot Databanks do not automatically expire cache entries on-the-fly; you must set up your own routines to clean them.
 	// Default is false, allowing the cache to self-clean and simplify development. In production, you may find that more control is better for performance.
 	Hot bool
+	// HostByteOrder stores numeric values in the byte order of the host machine rather than the canonical little-endian order.
+	// The byte order is recorded in entry metadata either way, so entries remain readable on other architectures.
+	// Default is false.
+	HostByteOrder bool
 	// Lifetime of entries. If set to 0 (zero), entries never expire.
 	// Default is 0.
 	Lifetime time.Duration
@@ -16,7 +27,10 @@ type Config struct {
 // ("Sensible" is defined by what little can be inferred without context; e.g. lifetime is assumed to be infinite.)
 func NewConfig() *Config {
 	return &Config{
-		Hot:      false,
-		Lifetime: 0,
+		Codec:         JSON,
+		Codecs:        []Codec{Gob, JSON},
+		Hot:           false,
+		HostByteOrder: false,
+		Lifetime:      0,
 	}
 }
@@ -1,16 +1,35 @@
 package databank
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 // Databank is a standard cache frontend for any backend Driver.
 type Databank interface {
+	// Begin a transaction.
+	Begin() *Tx
 	// Cleanup all expired entries.
 	Cleanup() (uint, bool)
 	// Count total number of entries.
 	// Note that this includes expired entries.
 	Count() (uint, bool)
+	// Create an entry whose content is written through the returned writer, without holding it all in memory if the driver supports it.
+	// The entry is stored when the writer is closed; Close returns an error if it could not be.
+	// See Streamer.
+	Create(key string) io.WriteCloser
 	// Delete an entry.
 	Delete(id string) bool
+	// DeleteMany deletes multiple entries.
+	// The results are mapped by ID.
+	DeleteMany(ids []string) map[string]bool
+	// DeleteByTag deletes all entries with a tag set to the given value.
+	DeleteByTag(tag, value string) (uint, bool)
 	// Expire an entry.
 	Expire(id string) bool
+	// ExpireByTag expires all entries with a tag set to the given value.
+	ExpireByTag(tag, value string) (uint, bool)
 	// Flush all entries.
 	Flush() bool
 	// Has an ID, i.e. entry exists in storage?
@@ -20,48 +39,102 @@ type Databank interface {
 	NewEntry(key string) *Entry
 	// Read an entry from storage.
 	Read(id string) (*Entry, bool)
+	// OpenReader opens an entry for reading its content, without holding it all in memory if the driver supports it.
+	// The reader must be closed.
+	// See Streamer.
+	OpenReader(id string) (io.ReadCloser, bool)
+	// ReadMany reads multiple entries from storage.
+	// The results are mapped by ID; entries that could not be read are omitted.
+	ReadMany(ids []string) map[string]*Entry
 	// Review entries, automatically expiring them as necessary.
 	Review() (uint, bool)
 	// Scan for IDs.
 	Scan() ([]string, bool)
 	// Search entries.
 	Search(q *Query) (map[string]*Entry, bool)
+	// Tagged finds the IDs of all entries with a tag set to the given value.
+	Tagged(tag, value string) ([]string, bool)
+	// WithContext creates a copy of the Databank bound to a context, which is passed down to its driver.
+	// See ContextBinder.
+	WithContext(ctx context.Context) Databank
 	// Write an entry to storage.
 	Write(e *Entry) bool
+	// WriteMany writes multiple entries to storage.
+	// The results are mapped by ID.
+	WriteMany(entries []*Entry) map[string]bool
 
 	// Driver provides direct access to the backend storage API, bypassing standard Databank features and middlewares.
 	// This is only advised for use in tests.
 	// Production code should use Databank's abstractions.
 	Driver() Driver
 
+	// ReadBool from storage.
+	// Typed reads return false if the entry does not exist or its content is not of the type read; use Read and the Entry's typed reads to get the error.
+	ReadBool(id string) (bool, bool)
+	// ReadDuration from storage.
+	ReadDuration(id string) (time.Duration, bool)
+	// ReadFloat32 from storage.
+	ReadFloat32(id string) (float32, bool)
+	// ReadFloat64 from storage.
+	ReadFloat64(id string) (float64, bool)
 	// ReadInt16 from storage.
 	ReadInt16(id string) (int16, bool)
 	// ReadInt32 from storage.
 	ReadInt32(id string) (int32, bool)
 	// ReadInt64 from storage.
 	ReadInt64(id string) (int64, bool)
+	// ReadInt8 from storage.
+	ReadInt8(id string) (int8, bool)
 	// ReadString from storage.
 	ReadString(id string) (string, bool)
+	// ReadStrings from storage.
+	ReadStrings(id string) ([]string, bool)
+	// ReadTime from storage.
+	ReadTime(id string) (time.Time, bool)
 	// ReadUint16 from storage.
 	ReadUint16(id string) (uint16, bool)
 	// ReadUint32 from storage.
 	ReadUint32(id string) (uint32, bool)
 	// ReadUint64 from storage.
 	ReadUint64(id string) (uint64, bool)
+	// ReadUint8 from storage.
+	ReadUint8(id string) (uint8, bool)
+	// ReadValue from storage into v, which must be a pointer, using the codec recorded in the entry.
+	// This returns false if the entry does not exist, or an error if its content cannot be decoded.
+	ReadValue(id string, v interface{}) (bool, error)
+	// WriteBool to storage.
+	WriteBool(key string, val bool) (*Entry, bool)
+	// WriteDuration to storage.
+	WriteDuration(key string, val time.Duration) (*Entry, bool)
+	// WriteFloat32 to storage.
+	WriteFloat32(key string, val float32) (*Entry, bool)
+	// WriteFloat64 to storage.
+	WriteFloat64(key string, val float64) (*Entry, bool)
 	// WriteInt16 to storage.
 	WriteInt16(key string, val int16) (*Entry, bool)
 	// WriteInt32 to storage.
 	WriteInt32(key string, val int32) (*Entry, bool)
 	// WriteInt64 to storage.
 	WriteInt64(key string, val int64) (*Entry, bool)
+	// WriteInt8 to storage.
+	WriteInt8(key string, val int8) (*Entry, bool)
 	// WriteString to storage.
 	WriteString(key, val string) (*Entry, bool)
+	// WriteStrings to storage.
+	WriteStrings(key string, val []string) (*Entry, bool)
+	// WriteTime to storage.
+	WriteTime(key string, val time.Time) (*Entry, bool)
 	// WriteUint16 to storage.
 	WriteUint16(key string, val uint16) (*Entry, bool)
 	// WriteUint32 to storage.
 	WriteUint32(key string, val uint32) (*Entry, bool)
 	// WriteUint64 to storage.
 	WriteUint64(key string, val uint64) (*Entry, bool)
+	// WriteUint8 to storage.
+	WriteUint8(key string, val uint8) (*Entry, bool)
+	// WriteValue to storage, encoded with the configured codec.
+	// This returns an error if the value cannot be encoded.
+	WriteValue(key string, val interface{}) (*Entry, bool, error)
 }
 
 // Driver describes the storage API required by databank.
@@ -100,18 +173,116 @@ type Driver interface {
 	Write(e *Entry) (bool, error)
 }
 
+// BatchDriver is an optional extension of Driver.
+// A Driver that can operate on multiple entries more efficiently than one at a time should implement it.
+//
+// Results and errors are mapped by ID.
+// An ID only appears in the error map if an error was encountered for it, in which case its result should be disregarded.
+type BatchDriver interface {
+	// DeleteMany deletes multiple entries.
+	// As with Delete, the bool result reflects each entry's nonexistence in storage when this function returns.
+	DeleteMany(ids []string) (map[string]bool, map[string]error)
+	// ReadMany reads multiple entries from storage.
+	// Entries that are not found are omitted from the results.
+	ReadMany(ids []string) (map[string]*Entry, map[string]error)
+	// WriteMany writes multiple entries to storage.
+	WriteMany(entries []*Entry) (map[string]bool, map[string]error)
+}
+
+// ContextBinder is an optional extension of Driver.
+// A Driver that makes use of a context, for example to propagate tracing spans, should implement it.
+//
+// Driver functions do not take a context directly, so a context is bound to a copy of the Driver for the duration of a call chain instead.
+// Drivers that wrap other drivers should bind the context to them in turn (see WithContext), so that it propagates all the way through.
+type ContextBinder interface {
+	// WithContext creates a copy of the Driver bound to a context.
+	WithContext(ctx context.Context) Driver
+}
+
+// RangeReader is an optional extension of Driver.
+// A Driver that can read part of an entry's content without reading all of it should implement it.
+type RangeReader interface {
+	// ReadRange reads part of an entry's content, starting at an offset.
+	// The range is truncated at the end of the content, so fewer bytes than requested may be returned.
+	// A negative offset or length returns ErrInvalidRange.
+	ReadRange(id string, offset, length int) ([]byte, bool, error)
+}
+
+// Streamer is an optional extension of Driver.
+// A Driver that can store content without holding it all in memory should implement it, allowing large entries to be streamed.
+type Streamer interface {
+	// Create an entry whose content is written through the returned writer.
+	// Any content already in the entry is ignored.
+	// The entry is stored when the writer is closed, at which point its Size is set; if the writer is not closed, the entry is not stored.
+	Create(e *Entry) (io.WriteCloser, error)
+	// OpenReader opens an entry for reading its content.
+	// The entry is returned without content, which must be read from the returned reader instead.
+	// The reader must be closed.
+	OpenReader(id string) (*Entry, io.ReadCloser, bool, error)
+}
+
+// TagIndexer is an optional extension of Driver.
+// A Driver that maintains a secondary index of tags to IDs should implement it, allowing tagged entries to be found without reading the entire storage.
+type TagIndexer interface {
+	// Tagged finds the IDs of all entries with a tag set to the given value.
+	Tagged(tag, value string) ([]string, bool, error)
+}
+
+// Transactor is an optional extension of Driver.
+// A Driver that can apply multiple operations all-or-nothing should implement it, allowing transactions to be committed atomically.
+//
+// Drivers that wrap other drivers may implement it to translate or observe transactions, passing them on to the next driver with Transact.
+// Such a driver is only as atomic as the driver it wraps, and should report that from Atomic (see the Atomic function).
+type Transactor interface {
+	// Atomic reports whether Transact applies operations atomically.
+	Atomic() bool
+	// Transact applies a set of operations atomically.
+	//
+	// Before any operation is applied, the current version of each ID in expect must be checked (see Version).
+	// If any version does not match, no operations are applied and ErrTxConflict is returned.
+	Transact(expect map[string]string, ops []TxOp) (bool, error)
+}
+
 // Query TODO
 type Query struct{}
 
 // databank is the internal implementation of Databank.
 type databank struct {
+	// base driver, without middlewares.
+	base   Driver
+	codecs map[string]Codec
 	config *Config
 	driver Driver
 }
 
+// Atomic reports whether a driver applies transactions atomically, i.e. it implements Transactor and reports that it is atomic.
+func Atomic(d Driver) bool {
+	if t, ok := d.(Transactor); ok {
+		return t.Atomic()
+	}
+	return false
+}
+
+// WithContext binds a context to a driver, if it implements ContextBinder.
+// Otherwise, the driver is returned as-is.
+func WithContext(ctx context.Context, d Driver) Driver {
+	if cb, ok := d.(ContextBinder); ok {
+		return cb.WithContext(ctx)
+	}
+	return d
+}
+
 // New standard Databank with your config and driver.
 // Once initialised, the Databank's settings and structure cannot be altered.
-func New(c *Config, d Driver) Databank {
+//
+// Options can add middlewares around the driver:
+//
+//	db := databank.New(nil, proxy.NewSync(atomic.New(), diskDriver), databank.WithMiddleware(
+//		func(next databank.Driver) databank.Driver {
+//			return metrics.NewMiddleware(metrics.NewConfig(), next)
+//		},
+//	))
+func New(c *Config, d Driver, opts ...Option) Databank {
 	// TODO this shouldn't be optional - force explicit invocation
 	var config *Config
 	if c != nil {
@@ -119,10 +290,20 @@ func New(c *Config, d Driver) Databank {
 	} else {
 		config = NewConfig()
 	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	db := &databank{
+		base:   d,
+		codecs: map[string]Codec{},
 		config: config,
-		driver: d,
+		driver: Chain(d, o.middlewares...),
 	}
+	for _, codec := range config.Codecs {
+		db.codecs[codec.Name()] = codec
+	}
+	db.codecs[db.codec().Name()] = db.codec()
 	return db
 }
 
@@ -142,7 +323,7 @@ func (d *databank) Delete(id string) bool {
 }
 
 func (d *databank) Driver() Driver {
-	return d.driver
+	return d.base
 }
 
 func (d *databank) Expire(id string) bool {
@@ -168,7 +349,7 @@ func (d *databank) Read(id string) (*Entry, bool) {
 	e, ok, _ := d.driver.Read(id)
 	if ok && !d.config.Hot {
 		if e.MaybeExpire() {
-			d.Write(e)
+			d.driver.Expire(id)
 			return nil, false
 		}
 	}
@@ -190,6 +371,12 @@ func (d *databank) Search(q *Query) (map[string]*Entry, bool) {
 	return results, ok
 }
 
+func (d *databank) WithContext(ctx context.Context) Databank {
+	c := *d
+	c.driver = WithContext(ctx, d.driver)
+	return &c
+}
+
 func (d *databank) Write(e *Entry) bool {
 	e.CalculateSize()
 	ok, _ := d.driver.Write(e)
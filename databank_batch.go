@@ -0,0 +1,95 @@
+package databank
+
+// DeleteMany deletes multiple entries from a driver.
+//
+// If the driver implements BatchDriver, its native implementation is used.
+// Otherwise, each entry is deleted in sequence.
+func DeleteMany(d Driver, ids []string) (map[string]bool, map[string]error) {
+	if bd, ok := d.(BatchDriver); ok {
+		return bd.DeleteMany(ids)
+	}
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, id := range ids {
+		ok, err := d.Delete(id)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+// ReadMany reads multiple entries from a driver.
+//
+// If the driver implements BatchDriver, its native implementation is used.
+// Otherwise, each entry is read in sequence.
+func ReadMany(d Driver, ids []string) (map[string]*Entry, map[string]error) {
+	if bd, ok := d.(BatchDriver); ok {
+		return bd.ReadMany(ids)
+	}
+	results := map[string]*Entry{}
+	errs := map[string]error{}
+	for _, id := range ids {
+		e, ok, err := d.Read(id)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		if ok {
+			results[id] = e
+		}
+	}
+	return results, errs
+}
+
+// WriteMany writes multiple entries to a driver.
+//
+// If the driver implements BatchDriver, its native implementation is used.
+// Otherwise, each entry is written in sequence.
+func WriteMany(d Driver, entries []*Entry) (map[string]bool, map[string]error) {
+	if bd, ok := d.(BatchDriver); ok {
+		return bd.WriteMany(entries)
+	}
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, e := range entries {
+		id := e.ID()
+		ok, err := d.Write(e)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+func (d *databank) DeleteMany(ids []string) map[string]bool {
+	results, _ := DeleteMany(d.driver, ids)
+	return results
+}
+
+func (d *databank) ReadMany(ids []string) map[string]*Entry {
+	results, _ := ReadMany(d.driver, ids)
+	if !d.config.Hot {
+		expired := []*Entry{}
+		for id, e := range results {
+			if e.MaybeExpire() {
+				expired = append(expired, e)
+				delete(results, id)
+			}
+		}
+		if len(expired) > 0 {
+			d.WriteMany(expired)
+		}
+	}
+	return results
+}
+
+func (d *databank) WriteMany(entries []*Entry) map[string]bool {
+	for _, e := range entries {
+		e.CalculateSize()
+	}
+	results, _ := WriteMany(d.driver, entries)
+	return results
+}
@@ -0,0 +1,46 @@
+package databank
+
+import "errors"
+
+// ErrInvalidRange is returned when reading a range with a negative offset or length.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ReadRange reads part of an entry's content from a driver, starting at an offset.
+// The range is truncated at the end of the content, so fewer bytes than requested may be returned.
+//
+// If the driver implements RangeReader, its native implementation is used.
+// Otherwise, the entry is read in full and the range is sliced from its content.
+func ReadRange(d Driver, id string, offset, length int) ([]byte, bool, error) {
+	if rr, ok := d.(RangeReader); ok {
+		return rr.ReadRange(id, offset, length)
+	}
+	return ReadRangeFull(d, id, offset, length)
+}
+
+// ReadRangeFull reads part of an entry's content from a driver, starting at an offset.
+// The entry is read in full with Read and the range is sliced from its content, even if the driver implements RangeReader.
+//
+// This is useful for drivers that transform content, as they can implement RangeReader with it and still have content go through their own Read.
+func ReadRangeFull(d Driver, id string, offset, length int) ([]byte, bool, error) {
+	if offset < 0 || length < 0 {
+		return nil, false, ErrInvalidRange
+	}
+	e, ok, err := d.Read(id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	return SliceRange(e.Content, offset, length), true, nil
+}
+
+// SliceRange copies part of content, starting at an offset.
+// The range is truncated at the end of the content.
+func SliceRange(b []byte, offset, length int) []byte {
+	if offset >= len(b) {
+		return []byte{}
+	}
+	end := offset + length
+	if end > len(b) || end < offset {
+		end = len(b)
+	}
+	return append([]byte{}, b[offset:end]...)
+}
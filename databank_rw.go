@@ -1,92 +1,258 @@
 package databank
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/edge/databank/pkg/convert"
+)
+
+// codec returns the configured codec for writing values.
+func (d *databank) codec() Codec {
+	if d.config.Codec != nil {
+		return d.config.Codec
+	}
+	return JSON
+}
+
+// newNumericEntry creates an entry for content encoded in the configured byte order, such as numeric values.
+func (d *databank) newNumericEntry(key string) *Entry {
+	e := d.NewEntry(key)
+	if d.config.HostByteOrder {
+		e.Meta.ByteOrder = convert.OrderName(convert.Endian())
+	}
+	return e
+}
+
+func (d *databank) ReadBool(id string) (bool, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadBool()
+		return v, err == nil
+	}
+	return false, false
+}
+
+func (d *databank) ReadDuration(id string) (time.Duration, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadDuration()
+		return v, err == nil
+	}
+	return 0, false
+}
+
+func (d *databank) ReadFloat32(id string) (float32, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadFloat32()
+		return v, err == nil
+	}
+	return 0, false
+}
+
+func (d *databank) ReadFloat64(id string) (float64, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadFloat64()
+		return v, err == nil
+	}
+	return 0, false
+}
+
 func (d *databank) ReadInt16(id string) (int16, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadInt16(), ok
+		v, err := e.ReadInt16()
+		return v, err == nil
 	}
 	return 0, false
 }
 
 func (d *databank) ReadInt32(id string) (int32, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadInt32(), true
+		v, err := e.ReadInt32()
+		return v, err == nil
 	}
 	return 0, false
 }
 
 func (d *databank) ReadInt64(id string) (int64, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadInt64(), true
+		v, err := e.ReadInt64()
+		return v, err == nil
+	}
+	return 0, false
+}
+
+func (d *databank) ReadInt8(id string) (int8, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadInt8()
+		return v, err == nil
 	}
 	return 0, false
 }
 
 func (d *databank) ReadString(id string) (string, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadString(), true
+		v, err := e.ReadString()
+		return v, err == nil
 	}
 	return "", false
 }
 
+func (d *databank) ReadStrings(id string) ([]string, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadStrings()
+		return v, err == nil
+	}
+	return nil, false
+}
+
+func (d *databank) ReadTime(id string) (time.Time, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadTime()
+		return v, err == nil
+	}
+	return time.Time{}, false
+}
+
 func (d *databank) ReadUint16(id string) (uint16, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadUint16(), true
+		v, err := e.ReadUint16()
+		return v, err == nil
 	}
 	return 0, false
 }
 
 func (d *databank) ReadUint32(id string) (uint32, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadUint32(), true
+		v, err := e.ReadUint32()
+		return v, err == nil
 	}
 	return 0, false
 }
 
 func (d *databank) ReadUint64(id string) (uint64, bool) {
 	if e, ok := d.Read(id); ok {
-		return e.ReadUint64(), true
+		v, err := e.ReadUint64()
+		return v, err == nil
 	}
 	return 0, false
 }
 
-func (d *databank) WriteInt16(key string, val int16) (*Entry, bool) {
+func (d *databank) ReadUint8(id string) (uint8, bool) {
+	if e, ok := d.Read(id); ok {
+		v, err := e.ReadUint8()
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// ReadValue uses the codec recorded in the entry, or the configured codec for entries without one.
+func (d *databank) ReadValue(id string, v interface{}) (bool, error) {
+	e, ok := d.Read(id)
+	if !ok {
+		return false, nil
+	}
+	c := d.codec()
+	if e.Meta != nil && e.Meta.Codec != "" {
+		if c, ok = d.codecs[e.Meta.Codec]; !ok {
+			return true, fmt.Errorf("%w: %s", ErrUnknownCodec, e.Meta.Codec)
+		}
+	}
+	return true, e.ReadValue(c, v)
+}
+
+func (d *databank) WriteBool(key string, val bool) (*Entry, bool) {
 	e := d.NewEntry(key)
+	e.WriteBool(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteDuration(key string, val time.Duration) (*Entry, bool) {
+	e := d.newNumericEntry(key)
+	e.WriteDuration(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteFloat32(key string, val float32) (*Entry, bool) {
+	e := d.newNumericEntry(key)
+	e.WriteFloat32(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteFloat64(key string, val float64) (*Entry, bool) {
+	e := d.newNumericEntry(key)
+	e.WriteFloat64(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteInt16(key string, val int16) (*Entry, bool) {
+	e := d.newNumericEntry(key)
 	e.WriteInt16(val)
 	return e, d.Write(e)
 }
 
 func (d *databank) WriteInt32(key string, val int32) (*Entry, bool) {
-	e := d.NewEntry(key)
+	e := d.newNumericEntry(key)
 	e.WriteInt32(val)
 	return e, d.Write(e)
 }
 
 func (d *databank) WriteInt64(key string, val int64) (*Entry, bool) {
-	e := d.NewEntry(key)
+	e := d.newNumericEntry(key)
 	e.WriteInt64(val)
 	return e, d.Write(e)
 }
 
+func (d *databank) WriteInt8(key string, val int8) (*Entry, bool) {
+	e := d.NewEntry(key)
+	e.WriteInt8(val)
+	return e, d.Write(e)
+}
+
 func (d *databank) WriteString(key, val string) (*Entry, bool) {
 	e := d.NewEntry(key)
 	e.WriteString(val)
 	return e, d.Write(e)
 }
 
-func (d *databank) WriteUint16(key string, val uint16) (*Entry, bool) {
+func (d *databank) WriteStrings(key string, val []string) (*Entry, bool) {
+	e := d.newNumericEntry(key)
+	e.WriteStrings(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteTime(key string, val time.Time) (*Entry, bool) {
 	e := d.NewEntry(key)
+	e.WriteTime(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteUint16(key string, val uint16) (*Entry, bool) {
+	e := d.newNumericEntry(key)
 	e.WriteUint16(val)
 	return e, d.Write(e)
 }
 
 func (d *databank) WriteUint32(key string, val uint32) (*Entry, bool) {
-	e := d.NewEntry(key)
+	e := d.newNumericEntry(key)
 	e.WriteUint32(val)
 	return e, d.Write(e)
 }
 
 func (d *databank) WriteUint64(key string, val uint64) (*Entry, bool) {
-	e := d.NewEntry(key)
+	e := d.newNumericEntry(key)
 	e.WriteUint64(val)
 	return e, d.Write(e)
 }
+
+func (d *databank) WriteUint8(key string, val uint8) (*Entry, bool) {
+	e := d.NewEntry(key)
+	e.WriteUint8(val)
+	return e, d.Write(e)
+}
+
+func (d *databank) WriteValue(key string, val interface{}) (*Entry, bool, error) {
+	e := d.NewEntry(key)
+	if err := e.WriteValue(d.codec(), val); err != nil {
+		return nil, false, err
+	}
+	return e, d.Write(e), nil
+}
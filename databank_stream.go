@@ -0,0 +1,127 @@
+package databank
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrClosed is returned when writing to a stream that has already been closed.
+var ErrClosed = errors.New("stream is closed")
+
+// bufferedWriter buffers content in memory, then writes the entry to a driver when closed.
+type bufferedWriter struct {
+	buf    bytes.Buffer
+	closed bool
+	d      Driver
+	e      *Entry
+}
+
+// errWriter fails every write with an error.
+type errWriter struct {
+	err error
+}
+
+// Create an entry in a driver whose content is written through the returned writer.
+//
+// If the driver implements Streamer, content is streamed to it.
+// Otherwise, content is buffered in memory and the entry is written when the writer is closed.
+func Create(d Driver, e *Entry) (io.WriteCloser, error) {
+	if s, ok := d.(Streamer); ok {
+		return s.Create(e)
+	}
+	return CreateBuffered(d, e), nil
+}
+
+// CreateBuffered creates an entry in a driver whose content is written through the returned writer.
+// Content is buffered in memory and the entry is written with Write when the writer is closed, even if the driver implements Streamer.
+//
+// Drivers that wrap other drivers and transform content on Write can use it to implement Streamer.
+func CreateBuffered(d Driver, e *Entry) io.WriteCloser {
+	return &bufferedWriter{d: d, e: e}
+}
+
+// OpenBuffered opens an entry in a driver for reading its content.
+// The entry is read in full with Read and its content is read from memory, even if the driver implements Streamer.
+//
+// Drivers that wrap other drivers and transform content on Read can use it to implement Streamer.
+func OpenBuffered(d Driver, id string) (*Entry, io.ReadCloser, bool, error) {
+	e, ok, err := d.Read(id)
+	if err != nil || !ok {
+		return nil, nil, ok, err
+	}
+	e = e.Clone()
+	r := ioutil.NopCloser(bytes.NewReader(e.Content))
+	e.Content = []byte{}
+	return e, r, true, nil
+}
+
+// OpenReader opens an entry in a driver for reading its content.
+//
+// If the driver implements Streamer, content is streamed from it.
+// Otherwise, the entry is read in full and its content is read from memory.
+func OpenReader(d Driver, id string) (*Entry, io.ReadCloser, bool, error) {
+	if s, ok := d.(Streamer); ok {
+		return s.OpenReader(id)
+	}
+	return OpenBuffered(d, id)
+}
+
+// Close the writer and write the entry.
+func (w *bufferedWriter) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	w.e.Content = w.buf.Bytes()
+	w.e.CalculateSize()
+	ok, err := w.d.Write(w.e)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrWriteFailed, w.e.ID())
+	}
+	return nil
+}
+
+// Write content to the buffer.
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	return w.buf.Write(b)
+}
+
+// Close returns the error.
+func (w *errWriter) Close() error {
+	return w.err
+}
+
+// Write returns the error.
+func (w *errWriter) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func (d *databank) Create(key string) io.WriteCloser {
+	w, err := Create(d.driver, d.NewEntry(key))
+	if err != nil {
+		return &errWriter{err: err}
+	}
+	return w
+}
+
+func (d *databank) OpenReader(id string) (io.ReadCloser, bool) {
+	e, r, ok, _ := OpenReader(d.driver, id)
+	if !ok {
+		return nil, false
+	}
+	if !d.config.Hot && e.MaybeExpire() {
+		r.Close()
+		d.driver.Expire(id)
+		return nil, false
+	}
+	return r, true
+}
@@ -0,0 +1,67 @@
+package databank
+
+// FindTagged finds the IDs of all entries in a driver with a tag set to the given value.
+//
+// If the driver implements TagIndexer, its index is used.
+// Otherwise, every entry is read and checked, which may be slow depending on the size of your data source.
+func FindTagged(d Driver, tag, value string) ([]string, bool, error) {
+	if ti, ok := d.(TagIndexer); ok {
+		return ti.Tagged(tag, value)
+	}
+	ids, ok, err := d.Scan()
+	if err != nil || !ok {
+		return []string{}, ok, err
+	}
+	tagged := []string{}
+	for _, id := range ids {
+		e, ok, err := d.Read(id)
+		if err != nil {
+			return []string{}, false, err
+		}
+		if !ok {
+			// this just means the ID was not found; ignore
+			continue
+		}
+		if v, ok := e.Tags[tag]; ok && v == value {
+			tagged = append(tagged, id)
+		}
+	}
+	return tagged, true, nil
+}
+
+func (d *databank) DeleteByTag(tag, value string) (uint, bool) {
+	ids, ok := d.Tagged(tag, value)
+	if !ok {
+		return 0, false
+	}
+	var deleted uint
+	for _, id := range ids {
+		if d.Delete(id) {
+			deleted++
+		} else {
+			ok = false
+		}
+	}
+	return deleted, ok
+}
+
+func (d *databank) ExpireByTag(tag, value string) (uint, bool) {
+	ids, ok := d.Tagged(tag, value)
+	if !ok {
+		return 0, false
+	}
+	var expired uint
+	for _, id := range ids {
+		if d.Expire(id) {
+			expired++
+		} else {
+			ok = false
+		}
+	}
+	return expired, ok
+}
+
+func (d *databank) Tagged(tag, value string) ([]string, bool) {
+	ids, ok, _ := FindTagged(d.driver, tag, value)
+	return ids, ok
+}
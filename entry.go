@@ -8,6 +8,9 @@ import (
 
 // Entry represents a single data entry and its metadata.
 type Entry struct {
+	// Content of the entry.
+	// Assigning it directly leaves the content type, value codec and byte order recorded in Meta by the typed Write helpers unchanged, so that a typed Read may fail or misread it.
+	// Use SetContent to replace content with raw bytes.
 	Content []byte            `json:"content"`
 	Key     string            `json:"key"`
 	Size    int               `json:"size"`
@@ -22,6 +25,42 @@ type EntryMetadata struct {
 	Expires      time.Time `json:"expires"`
 	ExpiresNever bool      `json:"expiresNever"`
 	Expired      bool      `json:"expired"`
+
+	// ByteOrder of numeric content, as named by convert.OrderName.
+	// This is set by the numeric Write helpers; entries written before it was introduced have none, and are read in the host byte order.
+	ByteOrder string `json:"byteOrder,omitempty"`
+	// Type of content, such as TypeInt64 or TypeString.
+	// This is set by the typed Write helpers and checked by the typed Read helpers; entries without it are checked only for length.
+	Type string `json:"type,omitempty"`
+	// Blob indicates that the driver stores the content separately from the entry, such as disk.Driver does for streamed content.
+	// An entry with Blob set and no content only carries metadata, and writing it back to the same driver keeps the stored content.
+	// Entries read in full have content, and do not have Blob set.
+	Blob bool `json:"blob,omitempty"`
+	// Chunks the content is split into, if it is stored in chunks.
+	// This is set and cleared by chunk.Middleware, along with ChunkSet and ChunkSize; entries read through it always have their content reassembled.
+	Chunks int `json:"chunks,omitempty"`
+	// ChunkSet identifies the chunks the content is stored in.
+	// Each write stores content in a new set of chunks, so that concurrent writes do not overwrite each other's chunks.
+	ChunkSet string `json:"chunkSet,omitempty"`
+	// ChunkSize in bytes of stored chunks.
+	ChunkSize int `json:"chunkSize,omitempty"`
+	// Codec of a structured value, if the content is one.
+	// This is set by the WriteValue helpers so that values can be decoded with the same codec.
+	Codec string `json:"codec,omitempty"`
+	// ContentHash of content stored separately by content address, if it is.
+	// This is set and cleared by dedup.Driver; entries read through it always have their content.
+	ContentHash string `json:"contentHash,omitempty"`
+	// Compression codec of the stored content, if it is compressed.
+	// This is set and cleared by compress.Middleware; content read through it is always uncompressed.
+	Compression string `json:"compression,omitempty"`
+	// Internal names the driver that stored the entry for its own use, such as "chunk" for the chunks stored by chunk.Middleware.
+	// Drivers only hide or collect entries marked as their own, so that entries written by users with similar IDs are left alone.
+	Internal string `json:"internal,omitempty"`
+	// KeyID of the key that encrypted the stored content, if it is encrypted.
+	// This is set and cleared by encrypt.Middleware; content read through it is always decrypted.
+	KeyID string `json:"keyId,omitempty"`
+	// StoredSize of the content in storage, if it differs from the entry's Size e.g. due to compression or encryption.
+	StoredSize int `json:"storedSize,omitempty"`
 }
 
 // NewEntry returns an empty Entry with required key and metadata set.
@@ -47,10 +86,29 @@ func NewEntry(key string, ttl time.Duration) *Entry {
 }
 
 // CalculateSize of content.
+// The size of a metadata-only entry (see EntryMetadata.Blob) is left unchanged.
 func (e *Entry) CalculateSize() {
+	if e.Meta != nil && e.Meta.Blob && len(e.Content) == 0 {
+		return
+	}
 	e.Size = len(e.Content)
 }
 
+// Clone creates a copy of the entry, so that it can be modified without affecting the original.
+func (e *Entry) Clone() *Entry {
+	c := *e
+	c.Content = append([]byte{}, e.Content...)
+	c.Tags = map[string]string{}
+	for k, v := range e.Tags {
+		c.Tags[k] = v
+	}
+	if e.Meta != nil {
+		meta := *e.Meta
+		c.Meta = &meta
+	}
+	return &c
+}
+
 // Expire marks the entry expired.
 func (e *Entry) Expire() {
 	e.Meta.Expired = true
@@ -83,6 +141,16 @@ func (e *Entry) ShouldExpire() bool {
 	return e.Meta.Expires.Before(time.Now())
 }
 
+// SetContent replaces entry content with raw bytes, clearing any content type, value codec and byte order recorded in metadata.
+func (e *Entry) SetContent(b []byte) {
+	e.Content = b
+	if e.Meta != nil {
+		e.Meta.ByteOrder = ""
+		e.Meta.Codec = ""
+		e.Meta.Type = ""
+	}
+}
+
 // Touch the entry (renew its life). It will keep the same TTL that it had previously.
 func (e *Entry) Touch() {
 	e.Meta.Created = time.Now()
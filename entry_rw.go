@@ -1,85 +1,350 @@
 package databank
 
-import "github.com/edge/databank/pkg/convert"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/edge/databank/pkg/convert"
+)
+
+// Content types recorded in entry metadata by the Write helpers.
+const (
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+	TypeFloat32  = "float32"
+	TypeFloat64  = "float64"
+	TypeInt8     = "int8"
+	TypeInt16    = "int16"
+	TypeInt32    = "int32"
+	TypeInt64    = "int64"
+	TypeString   = "string"
+	TypeStrings  = "strings"
+	TypeTime     = "time"
+	TypeUint8    = "uint8"
+	TypeUint16   = "uint16"
+	TypeUint32   = "uint32"
+	TypeUint64   = "uint64"
+	TypeValue    = "value"
+)
+
+var (
+	// ErrContentLength is returned when entry content is the wrong length for the type being read.
+	ErrContentLength = errors.New("content length does not match type")
+	// ErrTypeMismatch is returned when reading entry content as a different type than it was written.
+	ErrTypeMismatch = errors.New("content type mismatch")
+)
+
+// check that entry content can be read as a type of size n, or any size if n is negative.
+// Entries without a content type, such as those written before it was introduced, are checked only for length.
+func (e *Entry) check(t string, n int) error {
+	if e.Meta != nil && e.Meta.Type != "" && e.Meta.Type != t {
+		return fmt.Errorf("%w: %s is not %s", ErrTypeMismatch, e.Meta.Type, t)
+	}
+	if n >= 0 && len(e.Content) != n {
+		return fmt.Errorf("%w: %s must be %d bytes, got %d", ErrContentLength, t, n, len(e.Content))
+	}
+	return nil
+}
+
+// reader returns the converter for reading numeric content.
+// Entries without a byte order marker predate it, and were written in the host byte order.
+func (e *Entry) reader() convert.Converter {
+	if e.Meta != nil {
+		if o, ok := convert.ParseOrder(e.Meta.ByteOrder); ok {
+			return convert.NewConverter(o)
+		}
+	}
+	return convert.NewConverter(convert.Endian())
+}
+
+// writer returns the converter for writing numeric content, and marks the entry with its byte order.
+// The canonical byte order is used unless another has already been set in the entry metadata.
+func (e *Entry) writer() convert.Converter {
+	if e.Meta == nil {
+		return convert.NewConverter(convert.Canonical)
+	}
+	o, ok := convert.ParseOrder(e.Meta.ByteOrder)
+	if !ok {
+		o = convert.Canonical
+		e.Meta.ByteOrder = convert.OrderName(o)
+	}
+	return convert.NewConverter(o)
+}
+
+// setType records the content type in entry metadata.
+// Any value codec is cleared, as it only applies to TypeValue content.
+func (e *Entry) setType(t string) {
+	if e.Meta != nil {
+		e.Meta.Codec = ""
+		e.Meta.Type = t
+	}
+}
+
+// ReadBool from entry content.
+func (e *Entry) ReadBool() (bool, error) {
+	if err := e.check(TypeBool, 1); err != nil {
+		return false, err
+	}
+	return convert.BytesToBool(e.Content[0]), nil
+}
+
+// ReadDuration from entry content.
+func (e *Entry) ReadDuration() (time.Duration, error) {
+	if err := e.check(TypeDuration, 8); err != nil {
+		return 0, err
+	}
+	b := e.Content
+	return e.reader().BytesToDuration([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]}), nil
+}
+
+// ReadFloat32 from entry content.
+func (e *Entry) ReadFloat32() (float32, error) {
+	if err := e.check(TypeFloat32, 4); err != nil {
+		return 0, err
+	}
+	b := e.Content
+	return e.reader().BytesToFloat32([4]byte{b[0], b[1], b[2], b[3]}), nil
+}
+
+// ReadFloat64 from entry content.
+func (e *Entry) ReadFloat64() (float64, error) {
+	if err := e.check(TypeFloat64, 8); err != nil {
+		return 0, err
+	}
+	b := e.Content
+	return e.reader().BytesToFloat64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]}), nil
+}
 
 // ReadInt16 from entry content.
-func (e *Entry) ReadInt16() int16 {
+func (e *Entry) ReadInt16() (int16, error) {
+	if err := e.check(TypeInt16, 2); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToInt16([2]byte{b[0], b[1]})
+	return e.reader().BytesToInt16([2]byte{b[0], b[1]}), nil
 }
 
 // ReadInt32 from entry content.
-func (e *Entry) ReadInt32() int32 {
+func (e *Entry) ReadInt32() (int32, error) {
+	if err := e.check(TypeInt32, 4); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToInt32([4]byte{b[0], b[1], b[2], b[3]})
+	return e.reader().BytesToInt32([4]byte{b[0], b[1], b[2], b[3]}), nil
 }
 
 // ReadInt64 from entry content.
-func (e *Entry) ReadInt64() int64 {
+func (e *Entry) ReadInt64() (int64, error) {
+	if err := e.check(TypeInt64, 8); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToInt64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+	return e.reader().BytesToInt64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]}), nil
+}
+
+// ReadInt8 from entry content.
+func (e *Entry) ReadInt8() (int8, error) {
+	if err := e.check(TypeInt8, 1); err != nil {
+		return 0, err
+	}
+	return convert.BytesToInt8(e.Content[0]), nil
 }
 
 // ReadString from entry content.
-func (e *Entry) ReadString() string {
-	return convert.BytesToString(e.Content)
+func (e *Entry) ReadString() (string, error) {
+	if err := e.check(TypeString, -1); err != nil {
+		return "", err
+	}
+	return convert.BytesToString(e.Content), nil
+}
+
+// ReadStrings from entry content.
+func (e *Entry) ReadStrings() ([]string, error) {
+	if err := e.check(TypeStrings, -1); err != nil {
+		return nil, err
+	}
+	v, err := e.reader().BytesToStrings(e.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrContentLength, TypeStrings)
+	}
+	return v, nil
+}
+
+// ReadTime from entry content.
+func (e *Entry) ReadTime() (time.Time, error) {
+	if err := e.check(TypeTime, -1); err != nil {
+		return time.Time{}, err
+	}
+	v, err := convert.BytesToTime(e.Content)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrContentLength, TypeTime)
+	}
+	return v, nil
 }
 
 // ReadUint16 from entry content.
-func (e *Entry) ReadUint16() uint16 {
+func (e *Entry) ReadUint16() (uint16, error) {
+	if err := e.check(TypeUint16, 2); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToUint16([2]byte{b[0], b[1]})
+	return e.reader().BytesToUint16([2]byte{b[0], b[1]}), nil
 }
 
 // ReadUint32 from entry content.
-func (e *Entry) ReadUint32() uint32 {
+func (e *Entry) ReadUint32() (uint32, error) {
+	if err := e.check(TypeUint32, 4); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToUint32([4]byte{b[0], b[1], b[2], b[3]})
+	return e.reader().BytesToUint32([4]byte{b[0], b[1], b[2], b[3]}), nil
 }
 
 // ReadUint64 from entry content.
-func (e *Entry) ReadUint64() uint64 {
+func (e *Entry) ReadUint64() (uint64, error) {
+	if err := e.check(TypeUint64, 8); err != nil {
+		return 0, err
+	}
 	b := e.Content
-	return convert.BytesToUint64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+	return e.reader().BytesToUint64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]}), nil
+}
+
+// ReadUint8 from entry content.
+func (e *Entry) ReadUint8() (uint8, error) {
+	if err := e.check(TypeUint8, 1); err != nil {
+		return 0, err
+	}
+	return convert.BytesToUint8(e.Content[0]), nil
+}
+
+// ReadValue from entry content into v, which must be a pointer.
+// The codec must be the one recorded in entry metadata, if any.
+func (e *Entry) ReadValue(c Codec, v interface{}) error {
+	if err := e.check(TypeValue, -1); err != nil {
+		return err
+	}
+	if e.Meta != nil && e.Meta.Codec != "" && e.Meta.Codec != c.Name() {
+		return fmt.Errorf("%w: value is %s, not %s", ErrTypeMismatch, e.Meta.Codec, c.Name())
+	}
+	return c.Unmarshal(e.Content, v)
+}
+
+// WriteBool to entry content.
+func (e *Entry) WriteBool(v bool) {
+	e.Content = convert.BoolToBytes(v)
+	e.setType(TypeBool)
+}
+
+// WriteDuration to entry content.
+func (e *Entry) WriteDuration(v time.Duration) {
+	b := e.writer().DurationToBytes(v)
+	e.Content = b[0:8]
+	e.setType(TypeDuration)
+}
+
+// WriteFloat32 to entry content.
+func (e *Entry) WriteFloat32(v float32) {
+	b := e.writer().Float32ToBytes(v)
+	e.Content = b[0:4]
+	e.setType(TypeFloat32)
+}
+
+// WriteFloat64 to entry content.
+func (e *Entry) WriteFloat64(v float64) {
+	b := e.writer().Float64ToBytes(v)
+	e.Content = b[0:8]
+	e.setType(TypeFloat64)
 }
 
 // WriteInt16 to entry content.
 func (e *Entry) WriteInt16(v int16) {
-	b := convert.Int16ToBytes(v)
+	b := e.writer().Int16ToBytes(v)
 	e.Content = b[0:2]
+	e.setType(TypeInt16)
 }
 
 // WriteInt32 to entry content.
 func (e *Entry) WriteInt32(v int32) {
-	b := convert.Int32ToBytes(v)
+	b := e.writer().Int32ToBytes(v)
 	e.Content = b[0:4]
+	e.setType(TypeInt32)
 }
 
 // WriteInt64 to entry content.
 func (e *Entry) WriteInt64(v int64) {
-	b := convert.Int64ToBytes(v)
+	b := e.writer().Int64ToBytes(v)
 	e.Content = b[0:8]
+	e.setType(TypeInt64)
+}
+
+// WriteInt8 to entry content.
+func (e *Entry) WriteInt8(v int8) {
+	e.Content = convert.Int8ToBytes(v)
+	e.setType(TypeInt8)
 }
 
 // WriteString to entry content.
 func (e *Entry) WriteString(v string) {
 	e.Content = convert.StringToBytes(v)
+	e.setType(TypeString)
+}
+
+// WriteStrings to entry content.
+func (e *Entry) WriteStrings(v []string) {
+	e.Content = e.writer().StringsToBytes(v)
+	e.setType(TypeStrings)
+}
+
+// WriteTime to entry content.
+// The time's location is preserved as a fixed offset from UTC; if the offset cannot be encoded, the time is written in UTC.
+func (e *Entry) WriteTime(v time.Time) {
+	b, err := convert.TimeToBytes(v)
+	if err != nil {
+		b, _ = convert.TimeToBytes(v.UTC())
+	}
+	e.Content = b
+	e.setType(TypeTime)
 }
 
 // WriteUint16 to entry content.
 func (e *Entry) WriteUint16(v uint16) {
-	b := convert.Uint16ToBytes(v)
+	b := e.writer().Uint16ToBytes(v)
 	e.Content = b[0:2]
+	e.setType(TypeUint16)
 }
 
 // WriteUint32 to entry content.
 func (e *Entry) WriteUint32(v uint32) {
-	b := convert.Uint32ToBytes(v)
+	b := e.writer().Uint32ToBytes(v)
 	e.Content = b[0:4]
+	e.setType(TypeUint32)
 }
 
 // WriteUint64 to entry content.
 func (e *Entry) WriteUint64(v uint64) {
-	b := convert.Uint64ToBytes(v)
+	b := e.writer().Uint64ToBytes(v)
 	e.Content = b[0:8]
+	e.setType(TypeUint64)
+}
+
+// WriteUint8 to entry content.
+func (e *Entry) WriteUint8(v uint8) {
+	e.Content = convert.Uint8ToBytes(v)
+	e.setType(TypeUint8)
+}
+
+// WriteValue to entry content, encoded with a codec.
+// If the value cannot be encoded, the entry is not changed.
+func (e *Entry) WriteValue(c Codec, v interface{}) error {
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.Content = b
+	e.setType(TypeValue)
+	if e.Meta != nil {
+		e.Meta.Codec = c.Name()
+	}
+	return nil
 }
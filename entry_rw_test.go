@@ -0,0 +1,122 @@
+package databank_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/convert"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Entry_ByteOrder(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New())
+
+	// numerics are stored little-endian regardless of host
+	e, ok := db.WriteUint32("n", 0x01020304)
+	a.True(ok)
+	a.Equal([]byte{4, 3, 2, 1}, e.Content)
+	a.Equal("le", e.Meta.ByteOrder)
+	v, ok := db.ReadUint32("n")
+	a.True(ok)
+	a.Equal(uint32(0x01020304), v)
+
+	// entries marked big-endian are read big-endian
+	e = databank.NewEntry("be", 0)
+	e.Meta.ByteOrder = "be"
+	e.WriteInt16(-2)
+	a.Equal([]byte{0xff, 0xfe}, e.Content)
+	i, err := e.ReadInt16()
+	a.Nil(err)
+	a.Equal(int16(-2), i)
+
+	// legacy entries without a marker are read in host byte order
+	e = databank.NewEntry("legacy", 0)
+	e.Content = make([]byte, 8)
+	convert.Endian().PutUint64(e.Content, 42)
+	u, err := e.ReadUint64()
+	a.Nil(err)
+	a.Equal(uint64(42), u)
+}
+
+func Test_Entry_HostByteOrder(t *testing.T) {
+	a := assert.New(t)
+	c := databank.NewConfig()
+	c.HostByteOrder = true
+	db := databank.New(c, atomicdb.New())
+
+	e, _ := db.WriteInt64("n", 7)
+	a.Equal(convert.OrderName(convert.Endian()), e.Meta.ByteOrder)
+	b := make([]byte, 8)
+	convert.Endian().PutUint64(b, 7)
+	a.Equal(b, e.Content)
+
+	// readable regardless of the reader's configuration
+	o, ok := convert.ParseOrder(e.Meta.ByteOrder)
+	a.True(ok)
+	a.Equal(uint64(7), o.Uint64(e.Content))
+	v, _ := databank.New(nil, db.Driver()).ReadInt64("n")
+	a.Equal(int64(7), v)
+
+	a.Equal(binary.LittleEndian, convert.Canonical)
+}
+
+func Test_Entry_Type(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New())
+
+	e, _ := db.WriteString("s", "abcd")
+	a.Equal(databank.TypeString, e.Meta.Type)
+	_, err := e.ReadUint32()
+	a.True(errors.Is(err, databank.ErrTypeMismatch))
+	_, ok := db.ReadUint32("s")
+	a.False(ok)
+	v, ok := db.ReadString("s")
+	a.True(ok)
+	a.Equal("abcd", v)
+
+	e, _ = db.WriteInt64("n", 1)
+	a.Equal(databank.TypeInt64, e.Meta.Type)
+	_, err = e.ReadString()
+	a.True(errors.Is(err, databank.ErrTypeMismatch))
+	_, err = e.ReadUint64()
+	a.True(errors.Is(err, databank.ErrTypeMismatch))
+
+	// untyped entries are checked for length only
+	e = databank.NewEntry("raw", 0)
+	e.Content = []byte{1, 2}
+	_, err = e.ReadInt64()
+	a.True(errors.Is(err, databank.ErrContentLength))
+	_, err = e.ReadUint16()
+	a.Nil(err)
+	db.Write(e)
+	_, ok = db.ReadInt64("raw")
+	a.False(ok)
+}
+
+func Test_Entry_SetContent(t *testing.T) {
+	a := assert.New(t)
+	e := databank.NewEntry("key", 0)
+	a.Nil(e.WriteValue(databank.JSON, []int{1, 2}))
+	a.Equal(databank.TypeValue, e.Meta.Type)
+	a.Equal("json", e.Meta.Codec)
+
+	// typed Write helpers replace the type and clear the codec
+	e.WriteString("abcd")
+	a.Equal(databank.TypeString, e.Meta.Type)
+	a.Equal("", e.Meta.Codec)
+
+	// raw content clears all type metadata
+	e.WriteUint32(1)
+	a.NotEqual("", e.Meta.ByteOrder)
+	e.SetContent([]byte{1, 2, 3, 4})
+	a.Equal("", e.Meta.Type)
+	a.Equal("", e.Meta.ByteOrder)
+	_, err := e.ReadUint32()
+	a.Nil(err)
+	_, err = e.ReadString()
+	a.Nil(err)
+}
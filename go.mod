@@ -1,12 +1,18 @@
 module github.com/edge/databank
 
-go 1.15
+go 1.18
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/edge/atomicstore v0.0.0-20210114134325-01f3c683593d
 	github.com/edge/logger v0.0.0-20210128001200-b8b44d057f9b
-	github.com/kr/pretty v0.1.0 // indirect
 	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/edge/atomiccounter v0.0.0-20210113152313-b78bd3f6f8be // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,379 @@
+package databank
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Call is a driver operation passed to an Interceptor.
+// Only the fields relevant to the operation are set; for example, a Read sets ID, and a WriteMany sets Entries.
+//
+// Streamed writes are a Create call, which is complete once it returns a writer; the entry is only written when the writer is closed.
+// To act on the write itself, wrap the Result's Writer.
+//
+// Interceptors may modify a Call before passing it on, e.g. to rewrite an ID.
+type Call struct {
+	// Ctx is the context bound to the driver, or context.Background if there is none.
+	// Interceptors may replace it to bind a different context to the next driver for this Call, e.g. to nest a tracing span.
+	Ctx context.Context
+	Op  Op
+
+	Entries []*Entry
+	Entry   *Entry
+	Expect  map[string]string
+	ID      string
+	IDs     []string
+	Length  int
+	Offset  int
+	Query   *Query
+	Tag     string
+	TxOps   []TxOp
+	Value   string
+}
+
+// Handler performs a Call.
+type Handler func(c *Call) *Result
+
+// Interceptor intercepts every operation of a driver.
+// It can act before and after calling next, alter the Call or Result, or return a Result without calling next at all.
+//
+// For example, an interceptor that refuses all writes while in maintenance:
+//
+//	func(c *databank.Call, next databank.Handler) *databank.Result {
+//		if maintenance && c.Op == databank.OpWrite {
+//			return &databank.Result{Err: errors.New("maintenance")}
+//		}
+//		return next(c)
+//	}
+type Interceptor func(c *Call, next Handler) *Result
+
+// Result of a Call.
+// Only the fields relevant to the operation are set, following the operation's return values.
+//
+// An Interceptor that fails an operation itself may simply set Err.
+// It is converted to the operation's error type as needed, e.g. a single-item Errs for Flush, or an error for each ID for DeleteMany.
+type Result struct {
+	Content []byte
+	Entries map[string]*Entry
+	Entry   *Entry
+	Err     error
+	ErrMap  map[string]error
+	Errs    []error
+	IDs     []string
+	N       uint
+	OK      bool
+	Reader  io.ReadCloser
+	Results map[string]bool
+	Writer  io.WriteCloser
+}
+
+// Intercepted is a driver wrapped by an Interceptor.
+// It implements all optional Driver extensions, routing each operation through the Interceptor.
+//
+// Middlewares can embed it to implement Driver with a single Interceptor, while adding methods of their own:
+//
+//	type Middleware struct {
+//		*databank.Intercepted
+//		count uint64
+//	}
+//
+//	func NewMiddleware(next databank.Driver) *Middleware {
+//		m := &Middleware{}
+//		m.Intercepted = databank.Intercept(next, m.intercept)
+//		return m
+//	}
+type Intercepted struct {
+	ctx         context.Context
+	interceptor Interceptor
+	next        Driver
+}
+
+// Intercept wraps a driver with an Interceptor.
+// The returned driver implements all optional Driver extensions, and binds contexts to the next driver.
+func Intercept(next Driver, i Interceptor) *Intercepted {
+	return &Intercepted{
+		ctx:         context.Background(),
+		interceptor: i,
+		next:        next,
+	}
+}
+
+// InterceptMiddleware adapts an Interceptor to a Middleware.
+func InterceptMiddleware(i Interceptor) Middleware {
+	return func(next Driver) Driver {
+		return Intercept(next, i)
+	}
+}
+
+// Atomic reports whether the next driver applies transactions atomically.
+func (d *Intercepted) Atomic() bool {
+	return Atomic(d.next)
+}
+
+// Cleanup all expired entries.
+func (d *Intercepted) Cleanup() (uint, bool, []error) {
+	r := d.call(&Call{Op: OpCleanup})
+	return r.N, r.OK, r.errs()
+}
+
+// Count total number of entries in storage.
+func (d *Intercepted) Count() (uint, bool, error) {
+	r := d.call(&Call{Op: OpCount})
+	return r.N, r.OK, r.Err
+}
+
+// Create an entry whose content is written through the returned writer.
+func (d *Intercepted) Create(e *Entry) (io.WriteCloser, error) {
+	r := d.call(&Call{Op: OpCreate, Entry: e})
+	if r.Err == nil && r.Writer == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWriteFailed, e.ID())
+	}
+	return r.Writer, r.Err
+}
+
+// Delete an entry.
+func (d *Intercepted) Delete(id string) (bool, error) {
+	r := d.call(&Call{Op: OpDelete, ID: id})
+	return r.OK, r.Err
+}
+
+// DeleteMany deletes multiple entries.
+func (d *Intercepted) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	r := d.call(&Call{Op: OpDeleteMany, IDs: ids})
+	return r.results(), r.errMap(ids)
+}
+
+// Expire an entry.
+func (d *Intercepted) Expire(id string) (bool, error) {
+	r := d.call(&Call{Op: OpExpire, ID: id})
+	return r.OK, r.Err
+}
+
+// Flush all entries.
+func (d *Intercepted) Flush() (bool, []error) {
+	r := d.call(&Call{Op: OpFlush})
+	return r.OK, r.errs()
+}
+
+// Has an ID, i.e. entry exists in storage?
+func (d *Intercepted) Has(id string) (bool, error) {
+	r := d.call(&Call{Op: OpHas, ID: id})
+	return r.OK, r.Err
+}
+
+// OpenReader opens an entry for reading its content.
+func (d *Intercepted) OpenReader(id string) (*Entry, io.ReadCloser, bool, error) {
+	r := d.call(&Call{Op: OpOpenReader, ID: id})
+	if r.Reader == nil {
+		return nil, nil, false, r.Err
+	}
+	return r.Entry, r.Reader, r.OK, r.Err
+}
+
+// Read an entry from storage.
+func (d *Intercepted) Read(id string) (*Entry, bool, error) {
+	r := d.call(&Call{Op: OpRead, ID: id})
+	return r.Entry, r.OK, r.Err
+}
+
+// ReadMany reads multiple entries from storage.
+func (d *Intercepted) ReadMany(ids []string) (map[string]*Entry, map[string]error) {
+	r := d.call(&Call{Op: OpReadMany, IDs: ids})
+	entries := r.Entries
+	if entries == nil {
+		entries = map[string]*Entry{}
+	}
+	return entries, r.errMap(ids)
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+func (d *Intercepted) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	r := d.call(&Call{Op: OpReadRange, ID: id, Offset: offset, Length: length})
+	return r.Content, r.OK, r.Err
+}
+
+// Review entries, automatically expiring them as necessary.
+func (d *Intercepted) Review() (uint, bool, []error) {
+	r := d.call(&Call{Op: OpReview})
+	return r.N, r.OK, r.errs()
+}
+
+// Scan for IDs.
+func (d *Intercepted) Scan() ([]string, bool, error) {
+	r := d.call(&Call{Op: OpScan})
+	ids := r.IDs
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, r.OK, r.Err
+}
+
+// Search entries.
+func (d *Intercepted) Search(q *Query) (map[string]*Entry, bool, error) {
+	r := d.call(&Call{Op: OpSearch, Query: q})
+	entries := r.Entries
+	if entries == nil {
+		entries = map[string]*Entry{}
+	}
+	return entries, r.OK, r.Err
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+func (d *Intercepted) Tagged(tag, value string) ([]string, bool, error) {
+	r := d.call(&Call{Op: OpTagged, Tag: tag, Value: value})
+	ids := r.IDs
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, r.OK, r.Err
+}
+
+// Transact applies a set of operations.
+func (d *Intercepted) Transact(expect map[string]string, ops []TxOp) (bool, error) {
+	r := d.call(&Call{Op: OpTransact, Expect: expect, TxOps: ops})
+	return r.OK, r.Err
+}
+
+// WithContext creates a copy of the Intercepted bound to a context.
+// The context is also bound to the next driver, and set in the Ctx of every Call.
+func (d *Intercepted) WithContext(ctx context.Context) Driver {
+	return &Intercepted{
+		ctx:         ctx,
+		interceptor: d.interceptor,
+		next:        WithContext(ctx, d.next),
+	}
+}
+
+// Write an entry to storage.
+func (d *Intercepted) Write(e *Entry) (bool, error) {
+	r := d.call(&Call{Op: OpWrite, Entry: e})
+	return r.OK, r.Err
+}
+
+// WriteMany writes multiple entries to storage.
+func (d *Intercepted) WriteMany(entries []*Entry) (map[string]bool, map[string]error) {
+	r := d.call(&Call{Op: OpWriteMany, Entries: entries})
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID())
+	}
+	return r.results(), r.errMap(ids)
+}
+
+// call the interceptor.
+func (d *Intercepted) call(c *Call) *Result {
+	c.Ctx = d.ctx
+	r := d.interceptor(c, d.handle)
+	if r == nil {
+		return &Result{}
+	}
+	return r
+}
+
+// handle a Call by performing it on the next driver.
+// If the interceptor replaced the Call's context, it is bound to the next driver for this Call only.
+func (d *Intercepted) handle(c *Call) *Result {
+	next := d.next
+	if c.Ctx != nil && c.Ctx != d.ctx {
+		next = WithContext(c.Ctx, d.next)
+	}
+	r := &Result{}
+	switch c.Op {
+	case OpCleanup:
+		r.N, r.OK, r.Errs = next.Cleanup()
+	case OpCount:
+		r.N, r.OK, r.Err = next.Count()
+	case OpCreate:
+		r.Writer, r.Err = Create(next, c.Entry)
+	case OpDelete:
+		r.OK, r.Err = next.Delete(c.ID)
+	case OpDeleteMany:
+		r.Results, r.ErrMap = DeleteMany(next, c.IDs)
+	case OpExpire:
+		r.OK, r.Err = next.Expire(c.ID)
+	case OpFlush:
+		r.OK, r.Errs = next.Flush()
+	case OpHas:
+		r.OK, r.Err = next.Has(c.ID)
+	case OpOpenReader:
+		r.Entry, r.Reader, r.OK, r.Err = OpenReader(next, c.ID)
+	case OpRead:
+		r.Entry, r.OK, r.Err = next.Read(c.ID)
+	case OpReadMany:
+		r.Entries, r.ErrMap = ReadMany(next, c.IDs)
+	case OpReadRange:
+		r.Content, r.OK, r.Err = ReadRange(next, c.ID, c.Offset, c.Length)
+	case OpReview:
+		r.N, r.OK, r.Errs = next.Review()
+	case OpScan:
+		r.IDs, r.OK, r.Err = next.Scan()
+	case OpSearch:
+		r.Entries, r.OK, r.Err = next.Search(c.Query)
+	case OpTagged:
+		r.IDs, r.OK, r.Err = FindTagged(next, c.Tag, c.Value)
+	case OpTransact:
+		r.OK, r.Err = Transact(next, c.Expect, c.TxOps)
+	case OpWrite:
+		r.OK, r.Err = next.Write(c.Entry)
+	case OpWriteMany:
+		r.Results, r.ErrMap = WriteMany(next, c.Entries)
+	default:
+		r.Err = fmt.Errorf("unknown operation %q", c.Op)
+	}
+	return r
+}
+
+// Errors gets all errors of a Result, whichever of Err, ErrMap and Errs they are set in.
+// Errors in ErrMap are ordered by ID.
+func (r *Result) Errors() []error {
+	errs := []error{}
+	if r.Err != nil {
+		errs = append(errs, r.Err)
+	}
+	ids := []string{}
+	for id := range r.ErrMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		errs = append(errs, r.ErrMap[id])
+	}
+	return append(errs, r.Errs...)
+}
+
+// errMap gets the errors of a batch operation.
+// If only Err is set, it is mapped to every ID.
+func (r *Result) errMap(ids []string) map[string]error {
+	if r.ErrMap != nil {
+		return r.ErrMap
+	}
+	errs := map[string]error{}
+	if r.Err != nil {
+		for _, id := range ids {
+			errs[id] = r.Err
+		}
+	}
+	return errs
+}
+
+// errs gets the errors of a multi-error operation.
+// If only Err is set, it is the sole error.
+func (r *Result) errs() []error {
+	if r.Errs != nil {
+		return r.Errs
+	}
+	if r.Err != nil {
+		return []error{r.Err}
+	}
+	return []error{}
+}
+
+// results gets the results of a batch operation.
+func (r *Result) results() map[string]bool {
+	if r.Results == nil {
+		return map[string]bool{}
+	}
+	return r.Results
+}
@@ -0,0 +1,229 @@
+package databank_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// contextKey for test values stored in a context.
+type contextKey struct{}
+
+// readOnly is a driver built on Passthrough.
+type readOnly struct {
+	databank.Passthrough
+}
+
+func (d *readOnly) Create(e *databank.Entry) (io.WriteCloser, error) {
+	return nil, errors.New("read only")
+}
+
+func (d *readOnly) Write(e *databank.Entry) (bool, error) {
+	return false, errors.New("read only")
+}
+
+// streamer is a driver built on Passthrough that counts streams opened on it.
+type streamer struct {
+	databank.Passthrough
+	creates int
+	opens   int
+}
+
+func (d *streamer) Create(e *databank.Entry) (io.WriteCloser, error) {
+	d.creates++
+	return databank.CreateBuffered(d, e), nil
+}
+
+func (d *streamer) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	d.opens++
+	return databank.OpenBuffered(d, id)
+}
+
+// testStreams checks that streams opened on a driver wrapping s are passed through to it.
+func testStreams(t *testing.T, s *streamer, d databank.Driver) {
+	a := assert.New(t)
+	w, err := databank.Create(d, databank.NewEntry("stream", 0))
+	a.Nil(err)
+	_, err = w.Write([]byte("abc"))
+	a.Nil(err)
+	a.Nil(w.Close())
+	a.Equal(1, s.creates)
+
+	_, r, ok, err := databank.OpenReader(d, "stream")
+	a.True(ok)
+	a.Nil(err)
+	b, err := ioutil.ReadAll(r)
+	a.Nil(err)
+	a.Nil(r.Close())
+	a.Equal("abc", string(b))
+	a.Equal(1, s.opens)
+}
+
+func Test_Intercept(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return databank.Intercept(atomicdb.New(), func(c *databank.Call, next databank.Handler) *databank.Result {
+			return next(c)
+		})
+	})
+	dt.Run(t)
+}
+
+func Test_Passthrough(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return databank.NewPassthrough(atomicdb.New())
+	})
+	dt.Run(t)
+
+	a := assert.New(t)
+	db := databank.New(nil, &readOnly{databank.NewPassthrough(atomicdb.New())})
+	_, ok := db.WriteString("key", "abc")
+	a.False(ok)
+	_, err := db.Create("key").Write([]byte("abc"))
+	a.NotNil(err)
+}
+
+func Test_Passthrough_Stream(t *testing.T) {
+	s := &streamer{Passthrough: databank.NewPassthrough(atomicdb.New())}
+	testStreams(t, s, databank.NewPassthrough(s))
+}
+
+func Test_Intercept_Stream(t *testing.T) {
+	s := &streamer{Passthrough: databank.NewPassthrough(atomicdb.New())}
+	ops := []databank.Op{}
+	d := databank.Intercept(s, func(c *databank.Call, next databank.Handler) *databank.Result {
+		ops = append(ops, c.Op)
+		return next(c)
+	})
+	testStreams(t, s, d)
+	assert.Equal(t, []databank.Op{databank.OpCreate, databank.OpOpenReader}, ops)
+}
+
+func Test_Intercept_ReadRange(t *testing.T) {
+	a := assert.New(t)
+	ops := []databank.Op{}
+	d := databank.Intercept(atomicdb.New(), func(c *databank.Call, next databank.Handler) *databank.Result {
+		ops = append(ops, c.Op)
+		return next(c)
+	})
+	e := databank.NewEntry("key", 0)
+	e.Content = []byte("abcdef")
+	d.Write(e)
+
+	// the next driver is not a RangeReader, so the entry is read in full
+	b, ok, err := databank.ReadRange(databank.NewPassthrough(d), "key", 2, 3)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal("cde", string(b))
+	b, ok, err = databank.ReadRange(d, "key", 4, 10)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal("ef", string(b))
+	_, ok, err = databank.ReadRange(d, "missing", 0, 1)
+	a.False(ok)
+	a.Nil(err)
+	_, _, err = databank.ReadRange(d, "key", -1, 1)
+	a.Equal(databank.ErrInvalidRange, err)
+	a.Equal([]databank.Op{databank.OpWrite, databank.OpReadRange, databank.OpReadRange, databank.OpReadRange, databank.OpReadRange}, ops)
+}
+
+func Test_WithMiddleware(t *testing.T) {
+	a := assert.New(t)
+	order := []string{}
+	trace := func(name string) databank.Middleware {
+		return databank.InterceptMiddleware(func(c *databank.Call, next databank.Handler) *databank.Result {
+			order = append(order, name+">"+string(c.Op))
+			r := next(c)
+			order = append(order, name+"<"+string(c.Op))
+			return r
+		})
+	}
+	base := atomicdb.New()
+	db := databank.New(nil, base, databank.WithMiddleware(trace("outer"), trace("inner")))
+
+	db.Has("x")
+	a.Equal([]string{"outer>has", "inner>has", "inner<has", "outer<has"}, order)
+	a.Equal(base, db.Driver())
+}
+
+func Test_Intercept_Modify(t *testing.T) {
+	a := assert.New(t)
+	denied := errors.New("denied")
+	db := databank.New(nil, atomicdb.New(), databank.WithMiddleware(
+		databank.InterceptMiddleware(func(c *databank.Call, next databank.Handler) *databank.Result {
+			if c.Op == databank.OpWrite && strings.HasPrefix(c.Entry.Key, "secret") {
+				return &databank.Result{Err: denied}
+			}
+			if c.Op == databank.OpFlush || c.Op == databank.OpDeleteMany {
+				return &databank.Result{Err: denied}
+			}
+			return next(c)
+		}),
+	))
+
+	_, ok := db.WriteString("secret", "abc")
+	a.False(ok)
+	e, ok := db.WriteString("public", "abc")
+	a.True(ok)
+	a.True(db.Has(e.ID()))
+
+	// Driver bypasses middlewares
+	ok, errs := db.Driver().Flush()
+	a.True(ok)
+	a.Empty(errs)
+
+	d := databank.Intercept(atomicdb.New(), func(c *databank.Call, next databank.Handler) *databank.Result {
+		return &databank.Result{Err: denied}
+	})
+	_, errs = d.Flush()
+	a.Equal([]error{denied}, errs)
+	_, errMap := databank.DeleteMany(d, []string{"a", "b"})
+	a.Equal(map[string]error{"a": denied, "b": denied}, errMap)
+}
+
+func Test_Intercept_Context(t *testing.T) {
+	a := assert.New(t)
+	var got interface{}
+	d := databank.Intercept(atomicdb.New(), func(c *databank.Call, next databank.Handler) *databank.Result {
+		got = c.Ctx.Value(contextKey{})
+		return next(c)
+	})
+	db := databank.New(nil, d)
+
+	db.Has("x")
+	a.Nil(got)
+	db.WithContext(context.WithValue(context.Background(), contextKey{}, "abc")).Has("x")
+	a.Equal("abc", got)
+}
+
+func Test_Intercept_ReplaceContext(t *testing.T) {
+	a := assert.New(t)
+	var got interface{}
+	inner := databank.Intercept(atomicdb.New(), func(c *databank.Call, next databank.Handler) *databank.Result {
+		got = c.Ctx.Value(contextKey{})
+		return next(c)
+	})
+	d := databank.Intercept(inner, func(c *databank.Call, next databank.Handler) *databank.Result {
+		c.Ctx = context.WithValue(c.Ctx, contextKey{}, "abc")
+		return next(c)
+	})
+
+	d.Has("x")
+	a.Equal("abc", got)
+}
+
+func Test_Result_Errors(t *testing.T) {
+	a := assert.New(t)
+	e1, e2, e3 := errors.New("1"), errors.New("2"), errors.New("3")
+	a.Equal([]error{}, (&databank.Result{}).Errors())
+	a.Equal([]error{e1}, (&databank.Result{Err: e1}).Errors())
+	a.Equal([]error{e2, e1}, (&databank.Result{ErrMap: map[string]error{"a": e2, "b": e1}}).Errors())
+	a.Equal([]error{e3, e1}, (&databank.Result{Errs: []error{e3, e1}}).Errors())
+}
@@ -0,0 +1,37 @@
+package databank
+
+// Middleware wraps a driver to add functionality around it.
+// Any constructor of a driver that wraps another can be adapted to a Middleware, for example:
+//
+//	func(next databank.Driver) databank.Driver {
+//		return metrics.NewMiddleware(metrics.NewConfig(), next)
+//	}
+type Middleware func(next Driver) Driver
+
+// Option configures a Databank created with New.
+type Option func(o *options)
+
+// options collected from Options.
+type options struct {
+	middlewares []Middleware
+}
+
+// Chain wraps a driver with middlewares.
+// The first middleware is outermost, i.e. it sees each operation first and its result last.
+func Chain(d Driver, ms ...Middleware) Driver {
+	for i := len(ms) - 1; i >= 0; i-- {
+		d = ms[i](d)
+	}
+	return d
+}
+
+// WithMiddleware wraps the Databank's driver with middlewares.
+// The first middleware is outermost; see Chain.
+// It can be given more than once, in which case middlewares are appended in order.
+//
+// Databank.Driver still provides access to the driver without middlewares.
+func WithMiddleware(ms ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, ms...)
+	}
+}
@@ -0,0 +1,53 @@
+package databank
+
+// Op is the name of a Driver operation.
+// This is useful for middlewares that instrument or configure operations individually.
+type Op string
+
+// Driver operations.
+const (
+	OpCleanup Op = "cleanup"
+	OpCount   Op = "count"
+	OpDelete  Op = "delete"
+	OpExpire  Op = "expire"
+	OpFlush   Op = "flush"
+	OpHas     Op = "has"
+	OpRead    Op = "read"
+	OpReview  Op = "review"
+	OpScan    Op = "scan"
+	OpSearch  Op = "search"
+	OpWrite   Op = "write"
+
+	// Operations of optional Driver extensions.
+	OpCreate     Op = "create"
+	OpDeleteMany Op = "deleteMany"
+	OpOpenReader Op = "openReader"
+	OpReadMany   Op = "readMany"
+	OpReadRange  Op = "readRange"
+	OpTagged     Op = "tagged"
+	OpTransact   Op = "transact"
+	OpWriteMany  Op = "writeMany"
+)
+
+// Ops lists all operations.
+var Ops = []Op{
+	OpCleanup,
+	OpCount,
+	OpCreate,
+	OpDelete,
+	OpDeleteMany,
+	OpExpire,
+	OpFlush,
+	OpHas,
+	OpOpenReader,
+	OpRead,
+	OpReadMany,
+	OpReadRange,
+	OpReview,
+	OpScan,
+	OpSearch,
+	OpTagged,
+	OpTransact,
+	OpWrite,
+	OpWriteMany,
+}
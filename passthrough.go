@@ -0,0 +1,130 @@
+package databank
+
+import "io"
+
+// Passthrough is a base for drivers that wrap another driver.
+// It passes every operation, including those of optional Driver extensions, through to the next driver unchanged.
+//
+// Embed it and override only the operations you need:
+//
+//	type readOnly struct {
+//		databank.Passthrough
+//	}
+//
+//	func (d *readOnly) Write(e *databank.Entry) (bool, error) {
+//		return false, errors.New("read only")
+//	}
+//
+// Note that batch operations, transactions, streams and ranged reads are passed through directly, not via the single-entry operations, so override them too if necessary.
+// A driver that transforms content can implement streams and ranged reads with CreateBuffered, OpenBuffered and ReadRangeFull, which go through its own Write and Read.
+//
+// Passthrough does not implement ContextBinder, as it cannot copy the driver that embeds it.
+// Implement WithContext on the embedding driver to propagate contexts.
+type Passthrough struct {
+	Next Driver
+}
+
+// NewPassthrough creates a Passthrough to the next driver.
+func NewPassthrough(next Driver) Passthrough {
+	return Passthrough{Next: next}
+}
+
+// Atomic reports whether the next driver applies transactions atomically.
+func (p Passthrough) Atomic() bool {
+	return Atomic(p.Next)
+}
+
+// Cleanup all expired entries.
+func (p Passthrough) Cleanup() (uint, bool, []error) {
+	return p.Next.Cleanup()
+}
+
+// Count total number of entries in storage.
+func (p Passthrough) Count() (uint, bool, error) {
+	return p.Next.Count()
+}
+
+// Create an entry whose content is written through the returned writer.
+func (p Passthrough) Create(e *Entry) (io.WriteCloser, error) {
+	return Create(p.Next, e)
+}
+
+// Delete an entry.
+func (p Passthrough) Delete(id string) (bool, error) {
+	return p.Next.Delete(id)
+}
+
+// DeleteMany deletes multiple entries.
+func (p Passthrough) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	return DeleteMany(p.Next, ids)
+}
+
+// Expire an entry.
+func (p Passthrough) Expire(id string) (bool, error) {
+	return p.Next.Expire(id)
+}
+
+// Flush all entries.
+func (p Passthrough) Flush() (bool, []error) {
+	return p.Next.Flush()
+}
+
+// Has an ID, i.e. entry exists in storage?
+func (p Passthrough) Has(id string) (bool, error) {
+	return p.Next.Has(id)
+}
+
+// OpenReader opens an entry for reading its content.
+func (p Passthrough) OpenReader(id string) (*Entry, io.ReadCloser, bool, error) {
+	return OpenReader(p.Next, id)
+}
+
+// Read an entry from storage.
+func (p Passthrough) Read(id string) (*Entry, bool, error) {
+	return p.Next.Read(id)
+}
+
+// ReadMany reads multiple entries from storage.
+func (p Passthrough) ReadMany(ids []string) (map[string]*Entry, map[string]error) {
+	return ReadMany(p.Next, ids)
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+func (p Passthrough) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return ReadRange(p.Next, id, offset, length)
+}
+
+// Review entries, automatically expiring them as necessary.
+func (p Passthrough) Review() (uint, bool, []error) {
+	return p.Next.Review()
+}
+
+// Scan for IDs.
+func (p Passthrough) Scan() ([]string, bool, error) {
+	return p.Next.Scan()
+}
+
+// Search entries.
+func (p Passthrough) Search(q *Query) (map[string]*Entry, bool, error) {
+	return p.Next.Search(q)
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+func (p Passthrough) Tagged(tag, value string) ([]string, bool, error) {
+	return FindTagged(p.Next, tag, value)
+}
+
+// Transact applies a set of operations.
+func (p Passthrough) Transact(expect map[string]string, ops []TxOp) (bool, error) {
+	return Transact(p.Next, expect, ops)
+}
+
+// Write an entry to storage.
+func (p Passthrough) Write(e *Entry) (bool, error) {
+	return p.Next.Write(e)
+}
+
+// WriteMany writes multiple entries to storage.
+func (p Passthrough) WriteMany(entries []*Entry) (map[string]bool, map[string]error) {
+	return WriteMany(p.Next, entries)
+}
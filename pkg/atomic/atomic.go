@@ -1,6 +1,8 @@
 package atomic
 
 import (
+	"sync"
+
 	"github.com/edge/atomicstore"
 	"github.com/edge/databank"
 )
@@ -8,21 +10,33 @@ import (
 // Driver is the atomic implementation of databank.Driver.
 type Driver struct {
 	store *atomicstore.Store
+	tags  *tagIndex
+
+	// mtx is held exclusively while committing a transaction, and shared by all other writes.
+	mtx sync.RWMutex
+	// swapMtx is held while replacing an entry in the store and its records in the tag index, so that concurrent writes of the same ID update both in the same order.
+	swapMtx sync.Mutex
 }
 
 // New atomic Driver.
 func New() *Driver {
 	return &Driver{
 		store: atomicstore.New(true),
+		tags:  newTagIndex(),
 	}
 }
 
+// Atomic reports that transactions are applied atomically.
+func (d *Driver) Atomic() bool {
+	return true
+}
+
 // Cleanup all expired entries.
 func (d *Driver) Cleanup() (uint, bool, []error) {
 	var deleted uint
 	errs := []error{}
 	d.store.Range(func(id, value interface{}) bool {
-		e := value.(databank.Entry)
+		e := value.(*databank.Entry)
 		if e.Meta.Expired {
 			ok, err := d.Delete(id.(string))
 			if err != nil {
@@ -48,10 +62,21 @@ func (d *Driver) Count() (uint, bool, error) {
 // The bool return reflects the entry's nonexistence in storage when this function returns.
 // Ergo, if the ID is not found, this function still returns true.
 func (d *Driver) Delete(id string) (bool, error) {
-	d.store.Delete(id)
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	d.delete(id)
 	return true, nil
 }
 
+// DeleteMany deletes multiple entries.
+func (d *Driver) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	for _, id := range ids {
+		results[id], _ = d.Delete(id)
+	}
+	return results, map[string]error{}
+}
+
 // Expire an entry.
 // The bool return reflects whether the entry is in an expired or otherwise unreachable state when this function returns.
 // Ergo, if the ID is not found, this function still returns true.
@@ -69,7 +94,10 @@ func (d *Driver) Expire(id string) (bool, error) {
 
 // Flush all entries.
 func (d *Driver) Flush() (bool, []error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
 	d.store.Flush()
+	d.tags.reset()
 	return true, []error{}
 }
 
@@ -92,6 +120,17 @@ func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
 	return nil, false, nil
 }
 
+// ReadMany reads multiple entries from storage.
+func (d *Driver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results := map[string]*databank.Entry{}
+	for _, id := range ids {
+		if e, ok := d.store.Get(id); ok {
+			results[id] = e.(*databank.Entry)
+		}
+	}
+	return results, map[string]error{}
+}
+
 // Review entries, automatically expiring them as necessary.
 func (d *Driver) Review() (uint, bool, []error) {
 	var expired uint
@@ -126,8 +165,70 @@ func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, er
 	return map[string]*databank.Entry{}, false, nil
 }
 
+// Tagged finds the IDs of all entries with a tag set to the given value.
+func (d *Driver) Tagged(tag, value string) ([]string, bool, error) {
+	return d.tags.get(tag, value), true, nil
+}
+
+// Transact applies a set of operations atomically.
+func (d *Driver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for id, v := range expect {
+		var e *databank.Entry
+		if stored, ok := d.store.Get(id); ok {
+			e = stored.(*databank.Entry)
+		}
+		if databank.Version(e) != v {
+			return false, databank.ErrTxConflict
+		}
+	}
+	for _, op := range ops {
+		if op.Entry != nil {
+			d.write(op.Entry)
+		} else {
+			d.delete(op.ID)
+		}
+	}
+	return true, nil
+}
+
 // Write an entry to storage.
 func (d *Driver) Write(e *databank.Entry) (bool, error) {
-	d.store.Insert(e.ID(), e)
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	d.write(e)
 	return true, nil
 }
+
+// WriteMany writes multiple entries to storage.
+func (d *Driver) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	for _, e := range entries {
+		results[e.ID()], _ = d.Write(e)
+	}
+	return results, map[string]error{}
+}
+
+// delete an entry and its index records.
+func (d *Driver) delete(id string) {
+	d.swapMtx.Lock()
+	defer d.swapMtx.Unlock()
+	if old, ok := d.store.Get(id); ok {
+		d.store.Remove(id)
+		d.tags.replace(id, old.(*databank.Entry), nil)
+	}
+}
+
+// write an entry and its index records.
+func (d *Driver) write(e *databank.Entry) {
+	id := e.ID()
+	d.swapMtx.Lock()
+	defer d.swapMtx.Unlock()
+	var old *databank.Entry
+	if v, ok := d.store.Get(id); ok {
+		old = v.(*databank.Entry)
+	}
+	d.store.Insert(id, e)
+	d.tags.replace(id, old, e)
+}
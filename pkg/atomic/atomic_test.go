@@ -1,6 +1,7 @@
 package atomic
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/edge/databank"
@@ -17,3 +18,38 @@ func Test_AtomicDriver(t *testing.T) {
 	})
 	dt.Run(t)
 }
+
+func Test_AtomicDriver_TagIndex(t *testing.T) {
+	d := New()
+	e := databank.NewEntry("key", 0)
+	e.Tags["region"] = "eu"
+	id := e.ID()
+
+	// the index must match the store however concurrent writes and deletes of an ID interleave
+	for i := 0; i < 1000; i++ {
+		start := make(chan struct{})
+		wg := sync.WaitGroup{}
+		for j := 0; j < 4; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				d.Write(e.Clone())
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				d.Delete(id)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		has, _ := d.Has(id)
+		ids, _, _ := d.Tagged("region", "eu")
+		if has != (len(ids) == 1) {
+			t.Fatalf("entry stored is %t but indexed IDs are %v", has, ids)
+		}
+		d.Delete(id)
+	}
+}
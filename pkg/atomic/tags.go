@@ -0,0 +1,75 @@
+package atomic
+
+import (
+	"sync"
+
+	"github.com/edge/databank"
+)
+
+// tagIndex is an in-memory secondary index of tags to IDs.
+type tagIndex struct {
+	// ids are indexed by tag, then value.
+	ids map[string]map[string]map[string]bool
+	mtx sync.RWMutex
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		ids: map[string]map[string]map[string]bool{},
+	}
+}
+
+// get the IDs of all entries with a tag set to the given value.
+func (t *tagIndex) get(tag, value string) []string {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	ids := []string{}
+	if values, ok := t.ids[tag]; ok {
+		for id := range values[value] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// replace the indexed tags of an ID.
+// Either entry may be nil, in which case there is nothing to remove or add respectively.
+func (t *tagIndex) replace(id string, old, e *databank.Entry) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if old != nil {
+		for tag, value := range old.Tags {
+			values, ok := t.ids[tag]
+			if !ok {
+				continue
+			}
+			delete(values[value], id)
+			if len(values[value]) == 0 {
+				delete(values, value)
+			}
+			if len(values) == 0 {
+				delete(t.ids, tag)
+			}
+		}
+	}
+	if e != nil {
+		for tag, value := range e.Tags {
+			values, ok := t.ids[tag]
+			if !ok {
+				values = map[string]map[string]bool{}
+				t.ids[tag] = values
+			}
+			if _, ok := values[value]; !ok {
+				values[value] = map[string]bool{}
+			}
+			values[value][id] = true
+		}
+	}
+}
+
+// reset the index.
+func (t *tagIndex) reset() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.ids = map[string]map[string]map[string]bool{}
+}
@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// identityKey for caller identities stored in a context.
+type identityKey struct{}
+
+// Middleware is an audit middleware that wraps another driver.
+// It records every mutating operation to a Journal, including who performed it.
+//
+// The caller's identity is taken from the context bound with WithContext:
+//
+//	ctx := audit.WithIdentity(r.Context(), user.Name)
+//	db.WithContext(ctx).Write(e)
+//
+// Operations are recorded after they are applied, whether they succeed or not.
+// Reads are not recorded.
+type Middleware struct {
+	databank.Passthrough
+
+	ctx     context.Context
+	journal *Journal
+}
+
+// writer records a streamed write when it is closed.
+type writer struct {
+	io.WriteCloser
+
+	closed bool
+	e      *databank.Entry
+	hash   hash.Hash
+	m      *Middleware
+	size   int
+}
+
+// IdentityFromContext gets the caller identity in a context.
+// If there is none, an empty string is returned.
+func IdentityFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// NewMiddleware creates a new audit Middleware.
+func NewMiddleware(j *Journal, next databank.Driver) *Middleware {
+	return &Middleware{
+		Passthrough: databank.NewPassthrough(next),
+
+		ctx:     context.Background(),
+		journal: j,
+	}
+}
+
+// WithIdentity creates a context containing a caller identity, such as a user or service name.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Cleanup records a cleanup operation.
+func (m *Middleware) Cleanup() (uint, bool, []error) {
+	n, ok, errs := m.Next.Cleanup()
+	r := m.record(databank.OpCleanup, ok, first(errs))
+	r.N = n
+	m.append(r)
+	return n, ok, errs
+}
+
+// Create records a write operation when the returned writer is closed.
+// The record's hash and size are calculated from the content as it is streamed.
+func (m *Middleware) Create(e *databank.Entry) (io.WriteCloser, error) {
+	w, err := databank.Create(m.Next, e)
+	if err != nil {
+		r := m.record(databank.OpWrite, false, err)
+		r.ID = e.ID()
+		m.append(r)
+		return nil, err
+	}
+	return &writer{WriteCloser: w, e: e, hash: sha256.New(), m: m}, nil
+}
+
+// Delete records a delete operation.
+func (m *Middleware) Delete(id string) (bool, error) {
+	ok, err := m.Next.Delete(id)
+	r := m.record(databank.OpDelete, ok, err)
+	r.ID = id
+	m.append(r)
+	return ok, err
+}
+
+// DeleteMany records a delete operation for each entry.
+func (m *Middleware) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results, errs := databank.DeleteMany(m.Next, ids)
+	records := []*Record{}
+	for _, id := range ids {
+		r := m.record(databank.OpDelete, results[id], errs[id])
+		r.ID = id
+		records = append(records, r)
+	}
+	m.append(records...)
+	return results, errs
+}
+
+// Expire records an expire operation.
+func (m *Middleware) Expire(id string) (bool, error) {
+	ok, err := m.Next.Expire(id)
+	r := m.record(databank.OpExpire, ok, err)
+	r.ID = id
+	m.append(r)
+	return ok, err
+}
+
+// Flush records a flush operation.
+func (m *Middleware) Flush() (bool, []error) {
+	ok, errs := m.Next.Flush()
+	m.append(m.record(databank.OpFlush, ok, first(errs)))
+	return ok, errs
+}
+
+// Journal the Middleware records to.
+func (m *Middleware) Journal() *Journal {
+	return m.journal
+}
+
+// Transact records a write or delete operation for each operation in a transaction.
+func (m *Middleware) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	ok, err := databank.Transact(m.Next, expect, ops)
+	records := []*Record{}
+	for _, op := range ops {
+		var r *Record
+		if op.Entry != nil {
+			r = m.entryRecord(databank.OpWrite, op.Entry, ok, err)
+		} else {
+			r = m.record(databank.OpDelete, ok, err)
+		}
+		r.ID = op.ID
+		records = append(records, r)
+	}
+	m.append(records...)
+	return ok, err
+}
+
+// WithContext creates a copy of the Middleware bound to a context.
+// The caller identity is taken from the context.
+func (m *Middleware) WithContext(ctx context.Context) databank.Driver {
+	c := *m
+	c.ctx = ctx
+	c.Next = databank.WithContext(ctx, m.Next)
+	return &c
+}
+
+// Write records a write operation.
+func (m *Middleware) Write(e *databank.Entry) (bool, error) {
+	ok, err := m.Next.Write(e)
+	m.append(m.entryRecord(databank.OpWrite, e, ok, err))
+	return ok, err
+}
+
+// WriteMany records a write operation for each entry.
+func (m *Middleware) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	results, errs := databank.WriteMany(m.Next, entries)
+	records := []*Record{}
+	for _, e := range entries {
+		records = append(records, m.entryRecord(databank.OpWrite, e, results[e.ID()], errs[e.ID()]))
+	}
+	m.append(records...)
+	return results, errs
+}
+
+// append records to the journal, reporting any error.
+func (m *Middleware) append(records ...*Record) {
+	if err := m.journal.Append(records...); err != nil {
+		m.journal.error(err)
+	}
+}
+
+// entryRecord creates a record of an operation writing an entry.
+func (m *Middleware) entryRecord(op databank.Op, e *databank.Entry, ok bool, err error) *Record {
+	r := m.record(op, ok, err)
+	r.ID = e.ID()
+	r.Hash = fmt.Sprintf("%x", sha256.Sum256(e.Content))
+	r.Size = len(e.Content)
+	return r
+}
+
+// record creates a record of an operation.
+func (m *Middleware) record(op databank.Op, ok bool, err error) *Record {
+	r := &Record{
+		Time:     time.Now(),
+		Op:       op,
+		Identity: IdentityFromContext(m.ctx),
+		OK:       ok && err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Close the writer and record the write.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	r := w.m.record(databank.OpWrite, err == nil, err)
+	r.ID = w.e.ID()
+	r.Hash = fmt.Sprintf("%x", w.hash.Sum(nil))
+	r.Size = w.size
+	w.m.append(r)
+	return err
+}
+
+// Write content, adding it to the hash.
+func (w *writer) Write(b []byte) (int, error) {
+	n, err := w.WriteCloser.Write(b)
+	w.hash.Write(b[:n])
+	w.size += n
+	return n, err
+}
+
+// first error in a list, or nil.
+func first(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
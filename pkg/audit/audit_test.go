@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJournal(t *testing.T, maxSize int64) *Journal {
+	c := NewConfig(t.TempDir())
+	c.MaxSize = maxSize
+	c.OnError = func(err error) {
+		t.Error(err)
+	}
+	j, err := NewJournal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		j.Close()
+	})
+	return j
+}
+
+func Test_AuditMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware(newJournal(t, 0), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_AuditMiddleware_Records(t *testing.T) {
+	a := assert.New(t)
+	j := newJournal(t, 0)
+	db := databank.New(nil, NewMiddleware(j, atomicdb.New()))
+
+	ctx := WithIdentity(context.Background(), "alice")
+	e, _ := db.WithContext(ctx).WriteString("key", "abc")
+	db.ReadString(e.ID())
+	db.Expire(e.ID())
+	db.Delete(e.ID())
+	db.Flush()
+
+	records, err := j.Read(nil)
+	a.Nil(err)
+	a.Len(records, 4)
+	ops := []databank.Op{}
+	for _, r := range records {
+		ops = append(ops, r.Op)
+	}
+	a.Equal([]databank.Op{databank.OpWrite, databank.OpExpire, databank.OpDelete, databank.OpFlush}, ops)
+
+	w := records[0]
+	a.Equal(e.ID(), w.ID)
+	a.Equal("alice", w.Identity)
+	a.Equal(3, w.Size)
+	a.Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", w.Hash)
+	a.True(w.OK)
+	a.Equal("", records[1].Identity)
+
+	// streamed writes are recorded when closed
+	sw := db.WithContext(ctx).Create("streamed")
+	sw.Write([]byte("ab"))
+	sw.Write([]byte("c"))
+	records, _ = j.Read(nil)
+	a.Len(records, 4)
+	a.Nil(sw.Close())
+	records, _ = j.Read(nil)
+	if a.Len(records, 5) {
+		w = records[4]
+		a.Equal(databank.OpWrite, w.Op)
+		a.Equal("streamed", w.ID)
+		a.Equal("alice", w.Identity)
+		a.Equal(3, w.Size)
+		a.Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", w.Hash)
+		a.True(w.OK)
+	}
+}
+
+func Test_AuditMiddleware_Filter(t *testing.T) {
+	a := assert.New(t)
+	j := newJournal(t, 0)
+	db := databank.New(nil, NewMiddleware(j, atomicdb.New()))
+
+	e1, _ := db.WriteString("a", "1")
+	db.WriteString("b", "2")
+	mid := time.Now()
+	db.WriteString("a", "3")
+
+	records, err := j.Read(&Filter{ID: e1.ID()})
+	a.Nil(err)
+	a.Len(records, 2)
+
+	records, err = j.Read(&Filter{From: mid})
+	a.Nil(err)
+	a.Len(records, 1)
+	a.Equal(e1.ID(), records[0].ID)
+
+	records, err = j.Read(&Filter{To: mid})
+	a.Nil(err)
+	a.Len(records, 2)
+}
+
+func Test_AuditMiddleware_Rotate(t *testing.T) {
+	a := assert.New(t)
+	j := newJournal(t, 512)
+	db := databank.New(nil, NewMiddleware(j, atomicdb.New()))
+
+	for i := 0; i < 20; i++ {
+		db.WriteString("key", "abc")
+	}
+
+	infos, err := ioutil.ReadDir(j.Dir())
+	a.Nil(err)
+	a.True(len(infos) > 2)
+	for _, info := range infos {
+		a.True(info.Size() <= 512)
+	}
+
+	// records are read across files, in order
+	records, err := Read(j.Dir(), nil)
+	a.Nil(err)
+	a.Len(records, 20)
+	for i := 1; i < len(records); i++ {
+		a.False(records[i].Time.Before(records[i-1].Time))
+	}
+
+	// records are appended after reopening
+	j.Close()
+	j2, err := NewJournal(j.config)
+	a.Nil(err)
+	defer j2.Close()
+	NewMiddleware(j2, atomicdb.New()).Delete("x")
+	records, err = j2.Read(nil)
+	a.Nil(err)
+	a.Len(records, 21)
+}
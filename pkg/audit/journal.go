@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Journal file names.
+// The current file is always named currentFile; rotated files are named with the time of rotation, so that they sort chronologically.
+const (
+	currentFile   = "audit.log"
+	rotatedFormat = "20060102T150405.000000000"
+	rotatedPrefix = "audit-"
+	rotatedSuffix = ".log"
+)
+
+// Config for a Journal.
+type Config struct {
+	// Dir containing journal files.
+	Dir      string
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// MaxSize of a journal file in bytes, after which it is rotated.
+	// If 0, files are never rotated.
+	MaxSize int64
+	// OnError is called with errors encountered writing the journal, if set.
+	// Errors are not returned from driver operations, as the storage operation itself has already been applied.
+	OnError func(err error)
+	// Sync each record to disk after it is written.
+	// This is slower, but ensures records survive a crash.
+	Sync bool
+}
+
+// Journal is an append-only audit journal of JSON-lines files.
+// Records are appended to the current file, which is rotated once it exceeds the maximum size.
+// Rotated files are never modified or removed by the Journal.
+type Journal struct {
+	config *Config
+
+	file *os.File
+	mtx  sync.Mutex
+	size int64
+}
+
+// Record of a single mutating operation.
+type Record struct {
+	Time time.Time   `json:"time"`
+	Op   databank.Op `json:"op"`
+	// ID of the entry, for operations on single entries.
+	ID string `json:"id,omitempty"`
+	// Hash of the entry content written, as hex SHA-256.
+	Hash string `json:"hash,omitempty"`
+	// Size of the entry content written.
+	Size int `json:"size,omitempty"`
+	// N is the number of entries affected, for operations on the whole store.
+	N uint `json:"n,omitempty"`
+	// Identity of the caller, taken from the context. See WithIdentity.
+	Identity string `json:"identity,omitempty"`
+	OK       bool   `json:"ok"`
+	// Error encountered by the operation, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// NewConfig creates a Journal configuration with sensible defaults.
+// Files are rotated at 64 MiB.
+func NewConfig(dir string) *Config {
+	return &Config{
+		Dir:      dir,
+		DirMode:  0755,
+		FileMode: 0640,
+		MaxSize:  64 << 20,
+	}
+}
+
+// NewJournal opens a Journal, creating its directory if necessary.
+// Records are appended to any existing current file.
+func NewJournal(c *Config) (*Journal, error) {
+	if err := os.MkdirAll(c.Dir, c.DirMode); err != nil {
+		return nil, err
+	}
+	j := &Journal{config: c}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Append records to the journal.
+// If the current file would exceed the maximum size, it is rotated first.
+func (j *Journal) Append(records ...*Record) error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if j.file == nil {
+		return os.ErrClosed
+	}
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+		if j.config.MaxSize > 0 && j.size > 0 && j.size+int64(len(b)) > j.config.MaxSize {
+			if err := j.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := j.file.Write(b)
+		j.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	if j.config.Sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Close the journal.
+func (j *Journal) Close() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Dir containing journal files.
+func (j *Journal) Dir() string {
+	return j.config.Dir
+}
+
+// Read records from the journal that match a filter.
+// See Read.
+func (j *Journal) Read(f *Filter) ([]*Record, error) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return Read(j.config.Dir, f)
+}
+
+// error reports an error to OnError, if set.
+func (j *Journal) error(err error) {
+	if j.config.OnError != nil {
+		j.config.OnError(err)
+	}
+}
+
+// open the current file for appending.
+func (j *Journal) open() error {
+	file, err := os.OpenFile(path.Join(j.config.Dir, currentFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, j.config.FileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file = file
+	j.size = info.Size()
+	return nil
+}
+
+// rotate the current file, renaming it with the current time and opening a new one.
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	j.file = nil
+	name := fmt.Sprintf("%s%s%s", rotatedPrefix, time.Now().UTC().Format(rotatedFormat), rotatedSuffix)
+	if err := os.Rename(path.Join(j.config.Dir, currentFile), path.Join(j.config.Dir, name)); err != nil {
+		// keep appending to the current file
+		if openErr := j.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	return j.open()
+}
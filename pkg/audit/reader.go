@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter for reading records from a journal.
+// Zero fields match all records.
+type Filter struct {
+	// ID of the entry.
+	ID string
+	// From is the earliest time of records, inclusive.
+	From time.Time
+	// To is the latest time of records, exclusive.
+	To time.Time
+}
+
+// Read records that match a filter from the journal files in a directory, in the order they were written.
+// This can be used to read a journal that is not open, e.g. from another process.
+func Read(dir string, f *Filter) ([]*Record, error) {
+	if f == nil {
+		f = &Filter{}
+	}
+	files, err := journalFiles(dir, f.From)
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	for _, file := range files {
+		if records, err = readFile(file, f, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// match a record against the filter.
+func (f *Filter) match(r *Record) bool {
+	if f.ID != "" && r.ID != f.ID {
+		return false
+	}
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// journalFiles lists journal files in a directory in chronological order.
+// Rotated files that were rotated before a time are skipped, as all of their records are older.
+func journalFiles(dir string, from time.Time) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	rotated := []string{}
+	current := false
+	for _, info := range infos {
+		name := info.Name()
+		if name == currentFile {
+			current = true
+			continue
+		}
+		if !strings.HasPrefix(name, rotatedPrefix) || !strings.HasSuffix(name, rotatedSuffix) {
+			continue
+		}
+		t, err := time.Parse(rotatedFormat, strings.TrimSuffix(strings.TrimPrefix(name, rotatedPrefix), rotatedSuffix))
+		if err != nil || (!from.IsZero() && t.Before(from)) {
+			continue
+		}
+		rotated = append(rotated, name)
+	}
+	sort.Strings(rotated)
+	if current {
+		rotated = append(rotated, currentFile)
+	}
+	files := []string{}
+	for _, name := range rotated {
+		files = append(files, path.Join(dir, name))
+	}
+	return files, nil
+}
+
+// readFile reads matching records from a journal file, appending them to a list.
+// A truncated final line, e.g. from a crash while writing, is ignored.
+func readFile(file string, f *Filter, records []*Record) ([]*Record, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return records, err
+	}
+	defer fh.Close()
+	r := bufio.NewReader(fh)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if len(b) > 0 && b[len(b)-1] == '\n' {
+			rec := &Record{}
+			if jsonErr := json.Unmarshal(b, rec); jsonErr != nil {
+				return records, fmt.Errorf("%s:%d: %w", file, line, jsonErr)
+			}
+			if f.match(rec) {
+				records = append(records, rec)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,145 @@
+package breaker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// ErrOpen is returned by operations that fail fast because the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Config for a breaker Middleware.
+type Config struct {
+	// ErrorRate is the proportion of failed operations within a window, between 0 and 1, at which the breaker opens.
+	ErrorRate float64
+	// HalfOpenProbes is the number of operations allowed through while half-open.
+	// If all of them succeed, the breaker closes; if any fails, it opens again.
+	HalfOpenProbes int
+	// MinRequests is the minimum number of operations within a window before the breaker can open.
+	MinRequests int
+	// Now gets the current time.
+	// If nil, time.Now is used. This can be replaced to control time in tests.
+	Now func() time.Time
+	// OnStateChange is called whenever the breaker changes state.
+	// It is called synchronously by the operation that caused the change, so it should return quickly.
+	OnStateChange func(from, to State)
+	// OpenDuration is how long the breaker stays open before becoming half-open.
+	OpenDuration time.Duration
+	// ReadMissOnOpen causes Has, OpenReader, Read, ReadMany and ReadRange to return a miss instead of ErrOpen while the breaker is open.
+	// This allows a proxy.SyncDriver to fall through to its next driver.
+	ReadMissOnOpen bool
+	// SlowThreshold is the latency at or above which an operation counts as failed, even if it succeeded.
+	// If 0, latency is not considered.
+	SlowThreshold time.Duration
+	// Window is the duration over which the error rate is measured.
+	Window time.Duration
+}
+
+// Middleware is a circuit breaker middleware that wraps another driver.
+// It opens when the driver fails or is slow too often, failing operations fast rather than waiting on a dead backend.
+// After a while it becomes half-open, allowing a few probe operations through; if they succeed, it closes again.
+//
+// Only errors and slow operations count as failures; a read miss or other unsuccessful operation without error does not.
+// Streams go through the breaker when they are opened; errors writing or reading their content are not counted.
+//
+// Wrap a remote tier of a proxy.SyncDriver with ReadMissOnOpen set to let reads degrade gracefully to other tiers:
+//
+//	c := breaker.NewConfig()
+//	c.ReadMissOnOpen = true
+//	d := proxy.NewSync(atomic.New(), breaker.NewMiddleware(c, remote))
+type Middleware struct {
+	*databank.Intercepted
+
+	circuit *circuit
+	config  *Config
+}
+
+// NewConfig creates a breaker Middleware configuration with sensible defaults.
+// The breaker opens when half of at least 10 operations within 10 seconds fail, and stays open for 5 seconds.
+func NewConfig() *Config {
+	return &Config{
+		ErrorRate:      0.5,
+		HalfOpenProbes: 1,
+		MinRequests:    10,
+		OpenDuration:   5 * time.Second,
+		Window:         10 * time.Second,
+	}
+}
+
+// NewMiddleware creates a new breaker Middleware.
+// It starts closed.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		config: c,
+	}
+	m.circuit = &circuit{
+		config:      c,
+		state:       Closed,
+		windowStart: m.now(),
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// State of the breaker.
+func (m *Middleware) State() State {
+	return m.circuit.current()
+}
+
+// intercept an operation, passing it through the breaker.
+// A transaction conflict does not count as a failure.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	var r *databank.Result
+	m.call(func() error {
+		r = next(c)
+		errs := r.Errors()
+		if len(errs) == 0 || (c.Op == databank.OpTransact && errors.Is(r.Err, databank.ErrTxConflict)) {
+			return nil
+		}
+		return errs[0]
+	})
+	if r != nil {
+		return r
+	}
+	if m.config.ReadMissOnOpen {
+		switch c.Op {
+		case databank.OpHas, databank.OpOpenReader, databank.OpRead, databank.OpReadMany, databank.OpReadRange:
+			return &databank.Result{}
+		}
+	}
+	return &databank.Result{Err: ErrOpen}
+}
+
+// call an operation through the breaker.
+// ErrOpen is returned without calling the operation if the breaker is open.
+// Otherwise, the operation's error is returned.
+func (m *Middleware) call(f func() error) error {
+	ok, t := m.circuit.allow(m.now())
+	m.notify(t)
+	if !ok {
+		return ErrOpen
+	}
+	start := m.now()
+	err := f()
+	now := m.now()
+	failed := err != nil || (m.config.SlowThreshold > 0 && now.Sub(start) >= m.config.SlowThreshold)
+	m.notify(m.circuit.record(now, failed))
+	return err
+}
+
+// notify OnStateChange of a transition.
+func (m *Middleware) notify(t *transition) {
+	if t != nil && m.config.OnStateChange != nil {
+		m.config.OnStateChange(t.from, t.to)
+	}
+}
+
+// now gets the current time from the configured clock.
+func (m *Middleware) now() time.Time {
+	if m.config.Now != nil {
+		return m.config.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,186 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/proxy"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a manually advanced clock.
+type clock struct {
+	now time.Time
+}
+
+// switchDriver fails reads while down, and can delay them.
+type switchDriver struct {
+	databank.Driver
+	clock *clock
+	delay time.Duration
+	down  bool
+	reads int
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (d *switchDriver) Read(id string) (*databank.Entry, bool, error) {
+	d.reads++
+	d.clock.Advance(d.delay)
+	if d.down {
+		return nil, false, errors.New("backend down")
+	}
+	return d.Driver.Read(id)
+}
+
+func setup() (*Config, *clock, *switchDriver, *[]State) {
+	clk := &clock{time.Unix(0, 0)}
+	states := []State{}
+	c := NewConfig()
+	c.MinRequests = 4
+	c.Now = clk.Now
+	c.OnStateChange = func(from, to State) {
+		states = append(states, to)
+	}
+	return c, clk, &switchDriver{Driver: atomicdb.New(), clock: clk}, &states
+}
+
+func Test_BreakerMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware(NewConfig(), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_BreakerMiddleware_Trip(t *testing.T) {
+	a := assert.New(t)
+	c, clk, d, states := setup()
+	m := NewMiddleware(c, d)
+
+	// misses do not count as failures
+	for i := 0; i < 4; i++ {
+		_, _, err := m.Read("x")
+		a.Nil(err)
+	}
+	a.Equal(Closed, m.State())
+
+	d.down = true
+	for i := 0; i < 4; i++ {
+		m.Read("x")
+	}
+	a.Equal(Open, m.State())
+	a.Equal(8, d.reads)
+
+	// fail fast while open
+	_, _, err := m.Read("x")
+	a.Equal(ErrOpen, err)
+	a.Equal(8, d.reads)
+
+	// failed probe reopens
+	clk.Advance(c.OpenDuration)
+	_, _, err = m.Read("x")
+	a.NotEqual(ErrOpen, err)
+	a.Equal(Open, m.State())
+	a.Equal(9, d.reads)
+
+	// successful probe closes
+	d.down = false
+	clk.Advance(c.OpenDuration)
+	_, _, err = m.Read("x")
+	a.Nil(err)
+	a.Equal(Closed, m.State())
+
+	a.Equal([]State{Open, HalfOpen, Open, HalfOpen, Closed}, *states)
+}
+
+func Test_BreakerMiddleware_Slow(t *testing.T) {
+	a := assert.New(t)
+	c, _, d, _ := setup()
+	c.SlowThreshold = 100 * time.Millisecond
+	m := NewMiddleware(c, d)
+
+	d.delay = 50 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		m.Read("x")
+	}
+	a.Equal(Closed, m.State())
+
+	d.delay = 200 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		m.Read("x")
+	}
+	a.Equal(Open, m.State())
+}
+
+func Test_BreakerMiddleware_Window(t *testing.T) {
+	a := assert.New(t)
+	c, clk, d, _ := setup()
+	m := NewMiddleware(c, d)
+
+	// failures spread across windows do not trip the breaker
+	for i := 0; i < 4; i++ {
+		d.down = true
+		m.Read("x")
+		d.down = false
+		m.Read("x")
+		m.Read("x")
+		clk.Advance(c.Window)
+	}
+	a.Equal(Closed, m.State())
+}
+
+func Test_BreakerMiddleware_ReadMissOnOpen(t *testing.T) {
+	a := assert.New(t)
+	c, _, d, _ := setup()
+	c.ReadMissOnOpen = true
+	back := atomicdb.New()
+	db := databank.New(nil, proxy.NewSync(NewMiddleware(c, d), back))
+	databank.New(nil, back).WriteString("key", "abc")
+
+	d.down = true
+	for i := 0; i < 4; i++ {
+		db.ReadString("other")
+	}
+
+	// remote tier is open, so reads fall through without error
+	reads := d.reads
+	v, ok := db.ReadString("key")
+	a.True(ok)
+	a.Equal("abc", v)
+	a.Equal(reads, d.reads)
+}
+
+func Test_BreakerMiddleware_Stream(t *testing.T) {
+	a := assert.New(t)
+	c, _, d, _ := setup()
+	m := NewMiddleware(c, d)
+
+	d.down = true
+	for i := 0; i < 4; i++ {
+		_, _, _, err := m.OpenReader("x")
+		a.NotNil(err)
+	}
+	a.Equal(Open, m.State())
+
+	// streams fail fast while open
+	_, _, _, err := m.OpenReader("x")
+	a.Equal(ErrOpen, err)
+	_, err = m.Create(databank.NewEntry("x", 0))
+	a.Equal(ErrOpen, err)
+	a.Equal(4, d.reads)
+
+	c.ReadMissOnOpen = true
+	_, _, ok, err := m.OpenReader("x")
+	a.False(ok)
+	a.Nil(err)
+}
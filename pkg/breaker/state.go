@@ -0,0 +1,138 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states.
+const (
+	// Closed breakers pass all operations to the next driver.
+	Closed State = iota
+	// Open breakers fail all operations fast, without calling the next driver.
+	Open
+	// HalfOpen breakers pass a limited number of probe operations to the next driver, to test whether it has recovered.
+	HalfOpen
+)
+
+// State of a breaker.
+type State int
+
+// circuit is the state machine of a breaker.
+// It is shared between copies of a Middleware.
+type circuit struct {
+	config *Config
+	mtx    sync.Mutex
+
+	state  State
+	opened time.Time
+
+	// Closed state counters, reset at the start of each window.
+	errors      int
+	requests    int
+	windowStart time.Time
+
+	// HalfOpen state counters.
+	probes    int
+	successes int
+}
+
+// transition between states, reported to OnStateChange.
+type transition struct {
+	from State
+	to   State
+}
+
+// String gets the name of a state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// allow an operation, returning false if it should fail fast.
+// An open circuit becomes half-open once the open duration has elapsed.
+func (c *circuit) allow(now time.Time) (bool, *transition) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var t *transition
+	if c.state == Open {
+		if now.Sub(c.opened) < c.config.OpenDuration {
+			return false, nil
+		}
+		t = c.set(HalfOpen, now)
+	}
+	if c.state == HalfOpen {
+		if c.probes >= c.config.HalfOpenProbes {
+			return false, t
+		}
+		c.probes++
+	}
+	return true, t
+}
+
+// record the outcome of an allowed operation.
+func (c *circuit) record(now time.Time, failed bool) *transition {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	switch c.state {
+	case Closed:
+		if now.Sub(c.windowStart) >= c.config.Window {
+			c.resetWindow(now)
+		}
+		c.requests++
+		if failed {
+			c.errors++
+		}
+		if c.requests >= c.config.MinRequests && float64(c.errors)/float64(c.requests) >= c.config.ErrorRate {
+			return c.set(Open, now)
+		}
+	case HalfOpen:
+		if failed {
+			return c.set(Open, now)
+		}
+		c.successes++
+		if c.successes >= c.config.HalfOpenProbes {
+			return c.set(Closed, now)
+		}
+	}
+	// operations started before the circuit opened are ignored
+	return nil
+}
+
+// resetWindow starts a new window of Closed state counters.
+func (c *circuit) resetWindow(now time.Time) {
+	c.errors = 0
+	c.requests = 0
+	c.windowStart = now
+}
+
+// set the state, resetting counters as necessary.
+func (c *circuit) set(s State, now time.Time) *transition {
+	t := &transition{c.state, s}
+	c.state = s
+	switch s {
+	case Closed:
+		c.resetWindow(now)
+	case Open:
+		c.opened = now
+	case HalfOpen:
+		c.probes = 0
+		c.successes = 0
+	}
+	return t
+}
+
+// current state.
+func (c *circuit) current() State {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.state
+}
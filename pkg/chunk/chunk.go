@@ -0,0 +1,477 @@
+package chunk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/edge/databank"
+)
+
+// readAttempts is the number of times an entry is read if it is rewritten while its chunks are being read.
+const readAttempts = 3
+
+// Config for a chunk Middleware.
+type Config struct {
+	// Size of chunks in bytes.
+	// The last chunk of an entry may be smaller.
+	Size int
+	// Threshold is the content size in bytes above which entries are split into chunks.
+	Threshold int
+}
+
+// Middleware is a chunking middleware that wraps another driver.
+// Entries with content above the threshold are split into fixed-size chunk entries plus a manifest, and reassembled when they are read.
+// This allows large entries to be stored by drivers with size limits, and read in part with ReadRange.
+//
+// The manifest is stored under the entry's ID, and each chunk under the entry's ID suffixed with ".chunk.", the chunk set and the chunk's index (see ChunkID).
+// Each write stores content in a new set of chunks, so concurrent writes never overwrite each other's chunks; the previous set is deleted once the manifest has been replaced.
+//
+// Chunks are marked as such in their metadata, and only marked entries are treated as chunks.
+// They are hidden from Scan, Count and Search, and are deleted along with their entry, or when it is expired.
+// Chunks left behind by an interrupted write, or by a write that lost a race with another, are deleted by Cleanup.
+type Middleware struct {
+	databank.Passthrough
+
+	config *Config
+	// mtx is held exclusively while cleaning up chunks, so that chunks are not cleaned up while their entry is being written.
+	mtx *sync.RWMutex
+}
+
+// NewConfig creates a chunk Middleware configuration with sensible defaults.
+// Entries larger than 1 MiB are split into 1 MiB chunks.
+func NewConfig() *Config {
+	return &Config{
+		Size:      1 << 20,
+		Threshold: 1 << 20,
+	}
+}
+
+// NewMiddleware creates a new chunk Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	return &Middleware{
+		Passthrough: databank.NewPassthrough(next),
+
+		config: c,
+		mtx:    &sync.RWMutex{},
+	}
+}
+
+// Cleanup all expired entries, and their chunks.
+// Chunks of entries that no longer exist, or that have since been rewritten, are also deleted.
+func (m *Middleware) Cleanup() (uint, bool, []error) {
+	n, ok, errs := m.Next.Cleanup()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	ids, _, err := m.Next.Scan()
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	chunks, err := m.chunks(ids)
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	manifests := map[string]*databank.Entry{}
+	orphans := []string{}
+	for cid := range chunks {
+		id, set, i, _ := parseChunkID(cid)
+		e, read := manifests[id]
+		if !read {
+			if e, _, err = m.Next.Read(id); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			manifests[id] = e
+		}
+		if set != chunkSet(e) || i >= chunkCount(e) {
+			orphans = append(orphans, cid)
+		}
+	}
+	_, delErrs := databank.DeleteMany(m.Next, orphans)
+	for _, err := range delErrs {
+		errs = append(errs, err)
+	}
+	return n, ok, errs
+}
+
+// Count total number of entries in storage, excluding chunks.
+func (m *Middleware) Count() (uint, bool, error) {
+	ids, ok, err := m.Scan()
+	return uint(len(ids)), ok, err
+}
+
+// Create an entry whose content is written through the returned writer.
+// Content is buffered in memory, then split into chunks and written when the writer is closed.
+func (m *Middleware) Create(e *databank.Entry) (io.WriteCloser, error) {
+	return databank.CreateBuffered(m, e), nil
+}
+
+// Delete an entry and its chunks.
+func (m *Middleware) Delete(id string) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.delete(id)
+}
+
+// DeleteMany deletes multiple entries and their chunks.
+func (m *Middleware) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, id := range ids {
+		ok, err := m.delete(id)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+// Expire an entry, deleting its chunks.
+// The expired entry is kept without content until it is cleaned up.
+func (m *Middleware) Expire(id string) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	old, ok, err := m.Next.Read(id)
+	if err != nil {
+		return false, err
+	}
+	if !ok || chunkCount(old) == 0 {
+		return m.Next.Expire(id)
+	}
+	e := old.Clone()
+	e.Expire()
+	e.Content = []byte{}
+	e.Size = 0
+	e.Meta.Chunks = 0
+	e.Meta.ChunkSet = ""
+	e.Meta.ChunkSize = 0
+	if ok, err := m.Next.Write(e); !ok || err != nil {
+		return ok, err
+	}
+	if err := m.deleteChunks(old); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// OpenReader opens an entry for reading its content.
+// The entry is read and reassembled in full, then its content is read from memory.
+func (m *Middleware) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenBuffered(m, id)
+}
+
+// Read an entry from storage, reassembling its content from chunks.
+func (m *Middleware) Read(id string) (*databank.Entry, bool, error) {
+	e, ok, err := m.Next.Read(id)
+	if !ok || err != nil {
+		return e, ok, err
+	}
+	return m.load(id, e)
+}
+
+// ReadMany reads multiple entries from storage, reassembling their content from chunks.
+func (m *Middleware) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results, errs := databank.ReadMany(m.Next, ids)
+	for id, e := range results {
+		a, ok, err := m.load(id, e)
+		if !ok || err != nil {
+			delete(results, id)
+			if err != nil {
+				errs[id] = err
+			}
+			continue
+		}
+		results[id] = a
+	}
+	return results, errs
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+// Only the chunks containing the range are read.
+//
+// The range is truncated at the end of the content, so fewer bytes than requested may be returned.
+func (m *Middleware) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	if offset < 0 || length < 0 {
+		return nil, false, databank.ErrInvalidRange
+	}
+	e, ok, err := m.Next.Read(id)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	var b []byte
+	ok, err = m.retry(id, e, func(e *databank.Entry) (err error) {
+		b, err = m.readRange(e, offset, length)
+		return
+	})
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Scan for IDs, excluding chunks.
+func (m *Middleware) Scan() ([]string, bool, error) {
+	ids, ok, err := m.Next.Scan()
+	if err != nil {
+		return ids, ok, err
+	}
+	chunks, err := m.chunks(ids)
+	if err != nil {
+		return []string{}, false, err
+	}
+	entries := []string{}
+	for _, id := range ids {
+		if !chunks[id] {
+			entries = append(entries, id)
+		}
+	}
+	return entries, ok, nil
+}
+
+// Search entries, reassembling their content from chunks.
+func (m *Middleware) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	results, ok, err := m.Next.Search(q)
+	if err != nil {
+		return results, ok, err
+	}
+	assembled := map[string]*databank.Entry{}
+	for id, e := range results {
+		if isChunk(e) {
+			continue
+		}
+		a, found, err := m.load(id, e)
+		if err != nil {
+			return map[string]*databank.Entry{}, false, err
+		}
+		if found {
+			assembled[id] = a
+		}
+	}
+	return assembled, ok, nil
+}
+
+// Transact applies a set of operations, splitting written entries into chunks.
+//
+// Expected versions are calculated from reassembled entries, which differ from those in storage.
+// Each is checked against the reassembled entry in storage, then replaced with the version of the stored manifest, so that the next driver can still detect any conflict atomically.
+func (m *Middleware) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	stored := map[string]string{}
+	for id, v := range expect {
+		e, _, err := m.Next.Read(id)
+		if err != nil {
+			return false, err
+		}
+		a, err := m.assemble(e)
+		if err != nil {
+			return false, err
+		}
+		if databank.Version(a) != v {
+			return false, databank.ErrTxConflict
+		}
+		stored[id] = databank.Version(e)
+	}
+	split := []databank.TxOp{}
+	for _, op := range ops {
+		old, _, err := m.Next.Read(op.ID)
+		if err != nil {
+			return false, err
+		}
+		if op.Entry != nil {
+			manifest, chunks, err := m.split(op.Entry)
+			if err != nil {
+				return false, err
+			}
+			for _, c := range chunks {
+				split = append(split, databank.TxOp{ID: c.ID(), Entry: c})
+			}
+			op.Entry = manifest
+		}
+		split = append(split, op)
+		for _, cid := range chunkIDs(op.ID, chunkSet(old), 0, chunkCount(old)) {
+			split = append(split, databank.TxOp{ID: cid})
+		}
+	}
+	return databank.Transact(m.Next, stored, split)
+}
+
+// WithContext creates a copy of the Middleware with the context bound to the next driver.
+func (m *Middleware) WithContext(ctx context.Context) databank.Driver {
+	c := *m
+	c.Next = databank.WithContext(ctx, m.Next)
+	return &c
+}
+
+// Write an entry to storage, splitting its content into chunks if it is above the threshold.
+//
+// Chunks are written in a new set before the manifest, so the entry is never read with missing chunks.
+// Chunks of the previous entry are deleted afterwards.
+func (m *Middleware) Write(e *databank.Entry) (bool, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.write(e)
+}
+
+// WriteMany writes multiple entries to storage, splitting their content into chunks if necessary.
+func (m *Middleware) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, e := range entries {
+		id := e.ID()
+		ok, err := m.write(e)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+// chunks finds the IDs of chunks among stored IDs.
+// IDs that look like chunk IDs are read to check that they are chunks, so that entries with similar IDs are not mistaken for them.
+func (m *Middleware) chunks(ids []string) (map[string]bool, error) {
+	candidates := []string{}
+	for _, id := range ids {
+		if _, _, _, ok := parseChunkID(id); ok {
+			candidates = append(candidates, id)
+		}
+	}
+	chunks := map[string]bool{}
+	if len(candidates) == 0 {
+		return chunks, nil
+	}
+	entries, errs := databank.ReadMany(m.Next, candidates)
+	for _, err := range errs {
+		return nil, err
+	}
+	for id, e := range entries {
+		if isChunk(e) {
+			chunks[id] = true
+		}
+	}
+	return chunks, nil
+}
+
+// delete an entry and its chunks.
+func (m *Middleware) delete(id string) (bool, error) {
+	old, _, err := m.Next.Read(id)
+	if err != nil {
+		return false, err
+	}
+	if ok, err := m.Next.Delete(id); !ok || err != nil {
+		return ok, err
+	}
+	if err := m.deleteChunks(old); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deleteChunks deletes all chunks of a stored entry.
+func (m *Middleware) deleteChunks(e *databank.Entry) error {
+	n := chunkCount(e)
+	if n == 0 {
+		return nil
+	}
+	_, errs := databank.DeleteMany(m.Next, chunkIDs(e.ID(), chunkSet(e), 0, n))
+	for _, err := range errs {
+		return err
+	}
+	return nil
+}
+
+// load a stored entry, reassembling its content from chunks.
+func (m *Middleware) load(id string, e *databank.Entry) (*databank.Entry, bool, error) {
+	var a *databank.Entry
+	ok, err := m.retry(id, e, func(e *databank.Entry) (err error) {
+		a, err = m.assemble(e)
+		return
+	})
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	return a, true, nil
+}
+
+// readRange reads part of a stored entry's content, starting at an offset.
+func (m *Middleware) readRange(e *databank.Entry, offset, length int) ([]byte, error) {
+	n := chunkCount(e)
+	if n == 0 {
+		return databank.SliceRange(e.Content, offset, length), nil
+	}
+	size := e.Meta.ChunkSize
+	if length == 0 || offset >= n*size {
+		return []byte{}, nil
+	}
+	first := offset / size
+	last := n - 1
+	if length <= n*size-offset {
+		if l := (offset + length - 1) / size; l < last {
+			last = l
+		}
+	}
+	content, err := m.readChunks(e.ID(), chunkSet(e), first, last+1)
+	if err != nil {
+		return nil, err
+	}
+	return databank.SliceRange(content, offset-first*size, length), nil
+}
+
+// retry a read of a stored entry's chunks.
+// If chunks are missing because the entry has since been rewritten and its previous chunks deleted, the entry is read again and f is retried with it.
+// If the entry has since been deleted, false is returned.
+func (m *Middleware) retry(id string, e *databank.Entry, f func(e *databank.Entry) error) (bool, error) {
+	for i := 1; ; i++ {
+		err := f(e)
+		if err == nil || !errors.Is(err, ErrMissingChunk) || i >= readAttempts {
+			return true, err
+		}
+		current, ok, rerr := m.Next.Read(id)
+		if rerr != nil {
+			return false, rerr
+		}
+		if !ok {
+			return false, nil
+		}
+		if chunkSet(current) == chunkSet(e) {
+			return true, err
+		}
+		e = current
+	}
+}
+
+// write an entry and its chunks.
+func (m *Middleware) write(e *databank.Entry) (bool, error) {
+	id := e.ID()
+	old, _, err := m.Next.Read(id)
+	if err != nil {
+		return false, err
+	}
+	manifest, chunks, err := m.split(e)
+	if err != nil {
+		return false, err
+	}
+	results, errs := databank.WriteMany(m.Next, chunks)
+	for _, err := range errs {
+		return false, err
+	}
+	for _, ok := range results {
+		if !ok {
+			return false, nil
+		}
+	}
+	if ok, err := m.Next.Write(manifest); !ok || err != nil {
+		return ok, err
+	}
+	if err := m.deleteChunks(old); err != nil {
+		return false, err
+	}
+	return true, nil
+}
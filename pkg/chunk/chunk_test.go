@@ -0,0 +1,237 @@
+package chunk
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+var alphabet = strings.Repeat("abcdefghijklmnopqrstuvwxyz", 4)
+
+func newConfig() *Config {
+	c := NewConfig()
+	c.Size = 10
+	c.Threshold = 10
+	return c
+}
+
+func Test_ChunkMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		c := NewConfig()
+		c.Size = 4
+		c.Threshold = 4
+		return NewMiddleware(c, atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_ChunkMiddleware_Storage(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	db := databank.New(nil, NewMiddleware(newConfig(), back))
+
+	e, ok := db.WriteString("page", alphabet)
+	a.True(ok)
+	a.Equal(len(alphabet), e.Size)
+
+	manifest, _, _ := back.Read("page")
+	a.Equal(11, manifest.Meta.Chunks)
+	a.Equal(10, manifest.Meta.ChunkSize)
+	a.Empty(manifest.Content)
+	chunk, _, _ := back.Read(ChunkID("page", manifest.Meta.ChunkSet, 10))
+	a.Equal("wxyz", string(chunk.Content))
+	n, _, _ := back.Count()
+	a.Equal(uint(12), n)
+
+	// chunks are hidden
+	ids, _ := db.Scan()
+	a.Equal([]string{"page"}, ids)
+	count, _ := db.Count()
+	a.Equal(uint(1), count)
+
+	// entries that only look like chunks are not hidden
+	db.WriteString(ChunkID("user", "abc", 0), "abc")
+	ids, _ = db.Scan()
+	a.ElementsMatch([]string{"page", ChunkID("user", "abc", 0)}, ids)
+	a.True(db.Delete(ChunkID("user", "abc", 0)))
+
+	v, ok := db.ReadString("page")
+	a.True(ok)
+	a.Equal(alphabet, v)
+
+	// small entries are not chunked
+	db.WriteString("small", "abc")
+	stored, _, _ := back.Read("small")
+	a.Equal(0, stored.Meta.Chunks)
+	a.Equal("abc", string(stored.Content))
+
+	// rewriting with fewer chunks deletes the rest
+	db.WriteString("page", alphabet[:25])
+	n, _, _ = back.Count()
+	a.Equal(uint(5), n)
+	db.WriteString("page", "short")
+	n, _, _ = back.Count()
+	a.Equal(uint(2), n)
+
+	// deleting deletes chunks
+	db.WriteString("page", alphabet)
+	a.True(db.Delete("page"))
+	n, _, _ = back.Count()
+	a.Equal(uint(1), n)
+
+	// expiring deletes chunks, keeping the manifest until it is cleaned up
+	db.WriteString("page", alphabet)
+	a.True(db.Expire("page"))
+	n, _, _ = back.Count()
+	a.Equal(uint(2), n)
+	manifest, _, _ = back.Read("page")
+	a.True(manifest.Meta.Expired)
+	a.Equal(0, manifest.Meta.Chunks)
+}
+
+func Test_ChunkMiddleware_Concurrency(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	m := NewMiddleware(newConfig(), back)
+	db := databank.New(nil, m)
+
+	values := []string{alphabet, strings.ToUpper(alphabet)}
+	wg := sync.WaitGroup{}
+	for _, v := range values {
+		wg.Add(1)
+		go func(v string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				db.WriteString("page", v)
+			}
+		}(v)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			// reads see one write or the other, never a mix of both
+			if v, ok := db.ReadString("page"); ok {
+				a.Contains(values, v)
+			}
+		}
+	}()
+	wg.Wait()
+
+	v, ok := db.ReadString("page")
+	a.True(ok)
+	a.Contains(values, v)
+
+	// chunks of writes that lost a race are cleaned up
+	_, ok = db.Cleanup()
+	a.True(ok)
+	n, _, _ := back.Count()
+	a.Equal(uint(12), n)
+}
+
+func Test_ChunkMiddleware_ReadRange(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	m := NewMiddleware(newConfig(), back)
+	db := databank.New(nil, m)
+	db.WriteString("page", alphabet)
+	db.WriteString("small", "abc")
+
+	for _, r := range [][2]int{{0, 5}, {8, 4}, {10, 10}, {95, 10}, {100, 5}, {200, 1}, {0, 1000}} {
+		b, ok, err := m.ReadRange("page", r[0], r[1])
+		a.True(ok)
+		a.Nil(err)
+		want := alphabet[min(r[0], len(alphabet)):min(r[0]+r[1], len(alphabet))]
+		a.Equal(want, string(b))
+	}
+
+	b, ok, _ := m.ReadRange("small", 1, 5)
+	a.True(ok)
+	a.Equal("bc", string(b))
+
+	_, ok, _ = m.ReadRange("missing", 0, 1)
+	a.False(ok)
+	_, _, err := m.ReadRange("page", -1, 1)
+	a.True(errors.Is(err, databank.ErrInvalidRange))
+
+	// ranges are read through the next driver's ReadRange, if it has one
+	b, ok, err = databank.ReadRange(databank.NewPassthrough(m), "page", 8, 4)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal("ijkl", string(b))
+
+	// only the chunks in range are read
+	manifest, _, _ := back.Read("page")
+	back.Delete(ChunkID("page", manifest.Meta.ChunkSet, 0))
+	b, _, err = m.ReadRange("page", 10, 5)
+	a.Nil(err)
+	a.Equal("klmno", string(b))
+	_, _, err = m.ReadRange("page", 0, 5)
+	a.True(errors.Is(err, ErrMissingChunk))
+	_, ok = db.Read("page")
+	a.False(ok)
+}
+
+func Test_ChunkMiddleware_Cleanup(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	db := databank.New(nil, NewMiddleware(newConfig(), back))
+
+	e := db.NewEntry("page")
+	e.WriteString(alphabet)
+	db.Write(e)
+	a.True(db.Expire("page"))
+
+	// orphaned by an interrupted write
+	orphan := databank.NewEntry(ChunkID("gone", "abc", 0), 0)
+	orphan.Meta.Internal = internal
+	back.Write(orphan)
+
+	// entries that only look like chunks are not collected
+	db.WriteString(ChunkID("user", "abc", 0), "abc")
+
+	n, ok := db.Cleanup()
+	a.True(ok)
+	a.Equal(uint(1), n)
+	ids, _, _ := back.Scan()
+	a.Equal([]string{ChunkID("user", "abc", 0)}, ids)
+}
+
+func Test_ChunkMiddleware_Transaction(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	db := databank.New(nil, NewMiddleware(newConfig(), back))
+	db.WriteString("page", alphabet)
+
+	tx := db.Begin()
+	e, ok, err := tx.Read("page")
+	a.True(ok)
+	a.Nil(err)
+	e.WriteString(strings.ToUpper(alphabet[:15]))
+	tx.Write(e)
+	a.Nil(tx.Commit())
+
+	v, _ := db.ReadString("page")
+	a.Equal(strings.ToUpper(alphabet[:15]), v)
+	n, _, _ := back.Count()
+	a.Equal(uint(3), n)
+
+	tx = db.Begin()
+	tx.Delete("page")
+	a.Nil(tx.Commit())
+	n, _, _ = back.Count()
+	a.Equal(uint(0), n)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
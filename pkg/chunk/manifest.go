@@ -0,0 +1,169 @@
+package chunk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/edge/databank"
+)
+
+const (
+	// chunkSeparator separates an entry's ID from the set and index of one of its chunks.
+	chunkSeparator = ".chunk."
+	// internal marks chunk entries in their metadata (see databank.EntryMetadata.Internal).
+	internal = "chunk"
+	// setSize is the size in bytes of the random part of a chunk set.
+	setSize = 8
+)
+
+// ErrMissingChunk is returned when a chunk of an entry cannot be found in storage.
+var ErrMissingChunk = errors.New("missing chunk")
+
+// ChunkID gets the ID of a chunk of an entry, in a set of chunks.
+func ChunkID(id, set string, i int) string {
+	return id + chunkSeparator + set + "." + strconv.Itoa(i)
+}
+
+// chunkCount gets the number of chunks of a stored entry.
+func chunkCount(e *databank.Entry) int {
+	if e == nil || e.Meta == nil {
+		return 0
+	}
+	return e.Meta.Chunks
+}
+
+// chunkIDs gets the IDs of a range of chunks of an entry, in a set of chunks.
+func chunkIDs(id, set string, from, to int) []string {
+	ids := []string{}
+	for i := from; i < to; i++ {
+		ids = append(ids, ChunkID(id, set, i))
+	}
+	return ids
+}
+
+// chunkSet gets the set of chunks of a stored entry.
+func chunkSet(e *databank.Entry) string {
+	if e == nil || e.Meta == nil {
+		return ""
+	}
+	return e.Meta.ChunkSet
+}
+
+// isChunk checks whether a stored entry is a chunk.
+func isChunk(e *databank.Entry) bool {
+	return e != nil && e.Meta != nil && e.Meta.Internal == internal
+}
+
+// newChunkSet creates a random chunk set.
+func newChunkSet() (string, error) {
+	b := make([]byte, setSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseChunkID gets the entry ID, set and index of a chunk from its ID.
+// An ID that parses is not necessarily a chunk's; check the entry with isChunk.
+func parseChunkID(cid string) (string, string, int, bool) {
+	n := strings.LastIndex(cid, chunkSeparator)
+	if n < 0 {
+		return "", "", 0, false
+	}
+	rest := cid[n+len(chunkSeparator):]
+	dot := strings.LastIndex(rest, ".")
+	if dot < 0 {
+		return "", "", 0, false
+	}
+	i, err := strconv.Atoi(rest[dot+1:])
+	if err != nil || i < 0 {
+		return "", "", 0, false
+	}
+	return cid[:n], rest[:dot], i, true
+}
+
+// assemble the content of a stored entry from its chunks.
+// If the entry is not stored in chunks, it is returned as-is.
+// The stored entry is not modified.
+func (m *Middleware) assemble(e *databank.Entry) (*databank.Entry, error) {
+	n := chunkCount(e)
+	if n == 0 {
+		return e, nil
+	}
+	content, err := m.readChunks(e.ID(), chunkSet(e), 0, n)
+	if err != nil {
+		return nil, err
+	}
+	a := e.Clone()
+	a.Content = content
+	a.Size = len(content)
+	a.Meta.Chunks = 0
+	a.Meta.ChunkSet = ""
+	a.Meta.ChunkSize = 0
+	return a, nil
+}
+
+// readChunks reads a range of chunks of an entry, in a set of chunks, and joins their content.
+func (m *Middleware) readChunks(id, set string, from, to int) ([]byte, error) {
+	ids := chunkIDs(id, set, from, to)
+	chunks, errs := databank.ReadMany(m.Next, ids)
+	content := []byte{}
+	for _, cid := range ids {
+		if err := errs[cid]; err != nil {
+			return nil, err
+		}
+		c, ok := chunks[cid]
+		if !ok || !isChunk(c) {
+			return nil, fmt.Errorf("%w: %s", ErrMissingChunk, cid)
+		}
+		content = append(content, c.Content...)
+	}
+	return content, nil
+}
+
+// split an entry into a manifest and chunks for storage.
+// If the entry's content is not above the threshold, it is returned without chunks.
+// The original entry is not modified.
+//
+// The manifest is the entry itself, without content; its metadata records the set, number and size of chunks.
+// Chunks are stored as separate entries in a new set, that never expire by themselves, and are cleaned up along with their manifest.
+func (m *Middleware) split(e *databank.Entry) (*databank.Entry, []*databank.Entry, error) {
+	c := e.Clone()
+	c.Size = len(e.Content)
+	if c.Meta == nil {
+		return c, nil, nil
+	}
+	c.Meta.Chunks = 0
+	c.Meta.ChunkSet = ""
+	c.Meta.ChunkSize = 0
+	size := m.config.Size
+	if size <= 0 || len(c.Content) <= m.config.Threshold {
+		return c, nil, nil
+	}
+	set, err := newChunkSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	id := c.ID()
+	chunks := []*databank.Entry{}
+	for off := 0; off < len(c.Content); off += size {
+		end := off + size
+		if end > len(c.Content) {
+			end = len(c.Content)
+		}
+		chunk := databank.NewEntry(ChunkID(id, set, len(chunks)), 0)
+		chunk.Content = c.Content[off:end:end]
+		chunk.Size = end - off
+		chunk.Meta.Internal = internal
+		chunks = append(chunks, chunk)
+	}
+	c.Content = []byte{}
+	c.Meta.Chunks = len(chunks)
+	c.Meta.ChunkSet = set
+	c.Meta.ChunkSize = size
+	return c, chunks, nil
+}
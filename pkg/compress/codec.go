@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+)
+
+// Built-in codecs, at default compression level where applicable.
+var (
+	Deflate Codec = &FlateCodec{Level: flate.DefaultCompression}
+	Gzip    Codec = &GzipCodec{Level: gzip.DefaultCompression}
+	Snappy  Codec = &SnappyCodec{}
+	Zlib    Codec = &ZlibCodec{Level: zlib.DefaultCompression}
+)
+
+// Codec compresses and decompresses content.
+// Implement it to use other algorithms, such as zstd.
+type Codec interface {
+	// Name of the codec, recorded in entry metadata so that content can be decompressed.
+	// It must be unique, and must not change once content has been stored with it.
+	Name() string
+	Compress(b []byte) ([]byte, error)
+	Decompress(b []byte) ([]byte, error)
+}
+
+// FlateCodec compresses content with raw DEFLATE.
+type FlateCodec struct {
+	Level int
+}
+
+// GzipCodec compresses content with gzip.
+type GzipCodec struct {
+	Level int
+}
+
+// ZlibCodec compresses content with zlib.
+type ZlibCodec struct {
+	Level int
+}
+
+// Compress content.
+func (c *FlateCodec) Compress(b []byte) ([]byte, error) {
+	return compress(b, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, c.Level)
+	})
+}
+
+// Decompress content.
+func (c *FlateCodec) Decompress(b []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Name of the codec.
+func (c *FlateCodec) Name() string {
+	return "deflate"
+}
+
+// Compress content.
+func (c *GzipCodec) Compress(b []byte) ([]byte, error) {
+	return compress(b, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, c.Level)
+	})
+}
+
+// Decompress content.
+func (c *GzipCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Name of the codec.
+func (c *GzipCodec) Name() string {
+	return "gzip"
+}
+
+// Compress content.
+func (c *ZlibCodec) Compress(b []byte) ([]byte, error) {
+	return compress(b, func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, c.Level)
+	})
+}
+
+// Decompress content.
+func (c *ZlibCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Name of the codec.
+func (c *ZlibCodec) Name() string {
+	return "zlib"
+}
+
+// compress content with a writer.
+func compress(b []byte, newWriter func(w io.Writer) (io.WriteCloser, error)) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := newWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,252 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/edge/databank"
+)
+
+// ErrUnknownCodec is returned when reading an entry compressed with a codec that is not configured.
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// Config for a compress Middleware.
+type Config struct {
+	// Codec used to compress content.
+	// If nil, content is not compressed, but compressed content can still be read.
+	Codec Codec
+	// Codecs that can be read, in addition to Codec.
+	// Include any codecs previously used with the same storage.
+	Codecs []Codec
+	// Threshold is the minimum content size in bytes to compress.
+	// Small content rarely compresses well enough to be worth the overhead.
+	Threshold int
+}
+
+// Middleware is a compression middleware that wraps another driver.
+// Entry content is compressed before it is written, and decompressed when it is read, so that compression is transparent to callers.
+//
+// The codec used is recorded in the entry's metadata.
+// Content is stored uncompressed if it is smaller than the threshold, or if compression would not make it smaller.
+//
+// Entry.Size always reports the logical, uncompressed size of content, while Meta.StoredSize reports the size of compressed content in storage.
+type Middleware struct {
+	databank.Passthrough
+
+	codecs map[string]Codec
+	config *Config
+}
+
+// NewConfig creates a compress Middleware configuration with sensible defaults.
+// Content of 1 KiB or more is compressed with gzip, and all built-in codecs can be read.
+func NewConfig() *Config {
+	return &Config{
+		Codec:     Gzip,
+		Codecs:    []Codec{Deflate, Gzip, Snappy, Zlib},
+		Threshold: 1024,
+	}
+}
+
+// NewMiddleware creates a new compress Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		Passthrough: databank.NewPassthrough(next),
+
+		codecs: map[string]Codec{},
+		config: c,
+	}
+	for _, codec := range c.Codecs {
+		m.codecs[codec.Name()] = codec
+	}
+	if c.Codec != nil {
+		m.codecs[c.Codec.Name()] = c.Codec
+	}
+	return m
+}
+
+// Create an entry whose content is written through the returned writer.
+// Content is buffered in memory, then compressed and written when the writer is closed.
+func (m *Middleware) Create(e *databank.Entry) (io.WriteCloser, error) {
+	return databank.CreateBuffered(m, e), nil
+}
+
+// OpenReader opens an entry for reading its content.
+// The entry is read and decompressed in full, then its content is read from memory.
+func (m *Middleware) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenBuffered(m, id)
+}
+
+// Read an entry from storage, decompressing its content.
+func (m *Middleware) Read(id string) (*databank.Entry, bool, error) {
+	e, ok, err := m.Next.Read(id)
+	if !ok || err != nil {
+		return e, ok, err
+	}
+	if e, err = m.decode(e); err != nil {
+		return nil, false, err
+	}
+	return e, true, nil
+}
+
+// ReadMany reads multiple entries from storage, decompressing their content.
+func (m *Middleware) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results, errs := databank.ReadMany(m.Next, ids)
+	for id, e := range results {
+		d, err := m.decode(e)
+		if err != nil {
+			delete(results, id)
+			errs[id] = err
+			continue
+		}
+		results[id] = d
+	}
+	return results, errs
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+// The entry is read and decompressed in full, then the range is sliced from its content.
+func (m *Middleware) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRangeFull(m, id, offset, length)
+}
+
+// Search entries, decompressing their content.
+func (m *Middleware) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	results, ok, err := m.Next.Search(q)
+	if err != nil {
+		return results, ok, err
+	}
+	decoded := map[string]*databank.Entry{}
+	for id, e := range results {
+		if decoded[id], err = m.decode(e); err != nil {
+			return map[string]*databank.Entry{}, false, err
+		}
+	}
+	return decoded, ok, nil
+}
+
+// Transact applies a set of operations, compressing written entries.
+//
+// Expected versions are calculated from decompressed entries, which differ from those in storage.
+// Each is checked against the decompressed entry in storage, then replaced with the version of the stored entry, so that the next driver can still detect any conflict atomically.
+func (m *Middleware) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	stored := map[string]string{}
+	for id, v := range expect {
+		e, _, err := m.Next.Read(id)
+		if err != nil {
+			return false, err
+		}
+		d, err := m.decode(e)
+		if err != nil {
+			return false, err
+		}
+		if databank.Version(d) != v {
+			return false, databank.ErrTxConflict
+		}
+		stored[id] = databank.Version(e)
+	}
+	encoded := []databank.TxOp{}
+	for _, op := range ops {
+		if op.Entry != nil {
+			e, err := m.encode(op.Entry)
+			if err != nil {
+				return false, err
+			}
+			op.Entry = e
+		}
+		encoded = append(encoded, op)
+	}
+	return databank.Transact(m.Next, stored, encoded)
+}
+
+// WithContext creates a copy of the Middleware with the context bound to the next driver.
+func (m *Middleware) WithContext(ctx context.Context) databank.Driver {
+	c := *m
+	c.Next = databank.WithContext(ctx, m.Next)
+	return &c
+}
+
+// Write an entry to storage, compressing its content.
+// The entry's Meta.StoredSize is updated to reflect the size in storage.
+func (m *Middleware) Write(e *databank.Entry) (bool, error) {
+	stored, err := m.encode(e)
+	if err != nil {
+		return false, err
+	}
+	ok, err := m.Next.Write(stored)
+	if ok && err == nil && e.Meta != nil {
+		e.Meta.StoredSize = stored.Meta.StoredSize
+	}
+	return ok, err
+}
+
+// WriteMany writes multiple entries to storage, compressing their content.
+func (m *Middleware) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	encoded := []*databank.Entry{}
+	errs := map[string]error{}
+	for _, e := range entries {
+		stored, err := m.encode(e)
+		if err != nil {
+			errs[e.ID()] = err
+			continue
+		}
+		encoded = append(encoded, stored)
+	}
+	results, writeErrs := databank.WriteMany(m.Next, encoded)
+	for id, err := range writeErrs {
+		errs[id] = err
+	}
+	for id := range errs {
+		results[id] = false
+	}
+	return results, errs
+}
+
+// decode an entry read from storage, decompressing its content if necessary.
+// The stored entry is not modified.
+func (m *Middleware) decode(e *databank.Entry) (*databank.Entry, error) {
+	if e == nil || e.Meta == nil || e.Meta.Compression == "" {
+		return e, nil
+	}
+	codec, ok := m.codecs[e.Meta.Compression]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, e.Meta.Compression)
+	}
+	content, err := codec.Decompress(e.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", e.ID(), err)
+	}
+	d := e.Clone()
+	d.Content = content
+	d.Size = len(content)
+	d.Meta.Compression = ""
+	d.Meta.StoredSize = len(e.Content)
+	return d, nil
+}
+
+// encode an entry for storage, compressing its content if worthwhile.
+// The original entry is not modified.
+func (m *Middleware) encode(e *databank.Entry) (*databank.Entry, error) {
+	if e.Meta == nil {
+		return e, nil
+	}
+	c := e.Clone()
+	c.Size = len(e.Content)
+	c.Meta.Compression = ""
+	c.Meta.StoredSize = 0
+	if m.config.Codec == nil || len(e.Content) < m.config.Threshold {
+		return c, nil
+	}
+	content, err := m.config.Codec.Compress(e.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %w", e.ID(), err)
+	}
+	if len(content) >= len(e.Content) {
+		return c, nil
+	}
+	c.Content = content
+	c.Meta.Compression = m.config.Codec.Name()
+	c.Meta.StoredSize = len(content)
+	return c, nil
+}
@@ -0,0 +1,148 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+var html = strings.Repeat("<div class=\"item\"><span>Hello, world!</span></div>\n", 100)
+
+func Test_CompressMiddleware(t *testing.T) {
+	for _, codec := range []Codec{Deflate, Gzip, Snappy, Zlib} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			dt := tests.NewTester(func() databank.Driver {
+				c := NewConfig()
+				c.Codec = codec
+				c.Threshold = 0
+				return NewMiddleware(c, atomicdb.New())
+			})
+			dt.Run(t)
+		})
+	}
+}
+
+func Test_CompressMiddleware_Sizes(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	db := databank.New(nil, NewMiddleware(NewConfig(), back))
+
+	e, ok := db.WriteString("page", html)
+	a.True(ok)
+	a.Equal(len(html), e.Size)
+	a.True(e.Meta.StoredSize < len(html)/5)
+
+	stored, _, _ := back.Read(e.ID())
+	a.Equal("gzip", stored.Meta.Compression)
+	a.Equal(len(html), stored.Size)
+	a.Equal(e.Meta.StoredSize, len(stored.Content))
+
+	read, ok := db.Read(e.ID())
+	a.True(ok)
+	a.Equal(html, string(read.Content))
+	a.Equal(len(html), read.Size)
+	a.Equal(e.Meta.StoredSize, read.Meta.StoredSize)
+	a.Equal("", read.Meta.Compression)
+
+	// stored entry is unchanged by reading
+	a.Equal("gzip", stored.Meta.Compression)
+}
+
+func Test_CompressMiddleware_Threshold(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	db := databank.New(nil, NewMiddleware(NewConfig(), back))
+
+	// too small
+	e, _ := db.WriteString("small", "abc")
+	stored, _, _ := back.Read(e.ID())
+	a.Equal("", stored.Meta.Compression)
+	a.Equal("abc", string(stored.Content))
+
+	// incompressible
+	random := "RWRnZSBuZXR3b3JrIGlzIGJlc3QgbmV0d29yayEhITE="
+	c := NewConfig()
+	c.Threshold = 0
+	db = databank.New(nil, NewMiddleware(c, back))
+	e, _ = db.WriteString("random", random)
+	stored, _, _ = back.Read(e.ID())
+	a.Equal("", stored.Meta.Compression)
+	a.Equal(random, string(stored.Content))
+}
+
+func Test_CompressMiddleware_Codecs(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	c := NewConfig()
+	c.Codec = Zlib
+	e, _ := databank.New(nil, NewMiddleware(c, back)).WriteString("page", html)
+
+	// previously used codecs can still be read
+	v, ok := databank.New(nil, NewMiddleware(NewConfig(), back)).ReadString(e.ID())
+	a.True(ok)
+	a.Equal(html, v)
+
+	// unknown codecs cannot
+	c = NewConfig()
+	c.Codecs = []Codec{}
+	_, _, err := NewMiddleware(c, back).Read(e.ID())
+	a.True(errors.Is(err, ErrUnknownCodec))
+}
+
+func Test_CompressMiddleware_Transaction(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, NewMiddleware(NewConfig(), atomicdb.New()))
+	db.WriteString("page", html)
+
+	tx := db.Begin()
+	e, ok, err := tx.Read("page")
+	a.True(ok)
+	a.Nil(err)
+	e.WriteString(strings.ToUpper(html))
+	tx.Write(e)
+	a.Nil(tx.Commit())
+
+	v, _ := db.ReadString("page")
+	a.Equal(strings.ToUpper(html), v)
+}
+
+func Test_SnappyCodec(t *testing.T) {
+	a := assert.New(t)
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("abc"),
+		"html":   []byte(html),
+		"run":    []byte(strings.Repeat("a", 1000)),
+		"random": random,
+		"mixed":  append(append([]byte(html), random...), html...),
+	}
+	for name, b := range inputs {
+		c, err := Snappy.Compress(b)
+		a.Nil(err, name)
+		d, err := Snappy.Decompress(c)
+		a.Nil(err, name)
+		a.Equal(len(b), len(d), name)
+		a.True(bytes.Equal(b, d), name)
+	}
+
+	// compatible with the snappy block format
+	c, _ := Snappy.Compress([]byte("abc"))
+	a.Equal([]byte{3, 2 << 2, 'a', 'b', 'c'}, c)
+	c, _ = Snappy.Compress([]byte(html))
+	a.True(len(c) < len(html)/5)
+
+	// corrupt content is rejected
+	for _, b := range [][]byte{{}, {3, 2 << 2, 'a'}, {8, 0, 'a', 6<<2 | 1, 2}, {0xff}} {
+		_, err := Snappy.Decompress(b)
+		a.NotNil(err)
+	}
+}
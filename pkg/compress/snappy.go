@@ -0,0 +1,171 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errCorrupt is returned when decompressing content that is not valid snappy.
+var errCorrupt = errors.New("corrupt snappy content")
+
+const (
+	// snappyHashBits is the size of the match table, in bits.
+	snappyHashBits = 14
+	// snappyMaxLiteral is the longest literal emitted in one element.
+	snappyMaxLiteral = 1 << 16
+	// snappyMaxOffset is the furthest back a match is looked for.
+	snappyMaxOffset = 1<<16 - 1
+	// snappyMaxRatio is the most a snappy block can expand when decompressed, used to reject corrupt lengths before allocating.
+	snappyMaxRatio = 32
+)
+
+// SnappyCodec compresses content with the snappy block format.
+// It is much faster than the DEFLATE-based codecs, at the cost of a lower compression ratio, so suits hot or frequently rewritten entries.
+//
+// Content is compatible with other implementations of the snappy block format, but not the framed stream format.
+type SnappyCodec struct{}
+
+// Compress content.
+func (c *SnappyCodec) Compress(b []byte) ([]byte, error) {
+	dst := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(b)+len(b)/6)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(b)))]
+
+	table := [1 << snappyHashBits]int{}
+	lit, s := 0, 0
+	for s+4 <= len(b) {
+		h := snappyHash(b[s:])
+		cand := table[h] - 1
+		table[h] = s + 1
+		if cand < 0 || s-cand > snappyMaxOffset || binary.LittleEndian.Uint32(b[cand:]) != binary.LittleEndian.Uint32(b[s:]) {
+			// skip ahead faster the longer there has been no match
+			s += 1 + (s-lit)>>5
+			continue
+		}
+		length := 4
+		for s+length < len(b) && b[cand+length] == b[s+length] {
+			length++
+		}
+		dst = snappyLiteral(dst, b[lit:s])
+		dst = snappyCopy(dst, s-cand, length)
+		s += length
+		lit = s
+	}
+	return snappyLiteral(dst, b[lit:]), nil
+}
+
+// Decompress content.
+func (c *SnappyCodec) Decompress(b []byte) ([]byte, error) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b))*snappyMaxRatio {
+		return nil, errCorrupt
+	}
+	dst := make([]byte, 0, n)
+	for s := k; s < len(b); {
+		tag := b[s]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			s++
+			if length >= 60 {
+				size := length - 59
+				if s+size > len(b) {
+					return nil, errCorrupt
+				}
+				length = 0
+				for i := size - 1; i >= 0; i-- {
+					length = length<<8 | int(b[s+i])
+				}
+				s += size
+			}
+			length++
+			if length <= 0 || s+length > len(b) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, b[s:s+length]...)
+			s += length
+			continue
+		case 1:
+			if s+2 > len(b) {
+				return nil, errCorrupt
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(b[s+1])
+			s += 2
+		case 2:
+			if s+3 > len(b) {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(b[s+1:]))
+			s += 3
+		case 3:
+			if s+5 > len(b) {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(b[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > n {
+			return nil, errCorrupt
+		}
+		// copy byte by byte, as a match may overlap the content it produces
+		from := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[from+i])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
+
+// Name of the codec.
+func (c *SnappyCodec) Name() string {
+	return "snappy"
+}
+
+// snappyCopy appends copy elements for a match.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+}
+
+// snappyHash hashes the next four bytes of content.
+func snappyHash(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b) * 0x1e35a7bd >> (32 - snappyHashBits)
+}
+
+// snappyLiteral appends literal elements for content.
+func snappyLiteral(dst, lit []byte) []byte {
+	for len(lit) > 0 {
+		chunk := lit
+		if len(chunk) > snappyMaxLiteral {
+			chunk = chunk[:snappyMaxLiteral]
+		}
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			dst = append(dst, byte(n)<<2)
+		case n < 1<<8:
+			dst = append(dst, 60<<2, byte(n))
+		default:
+			dst = append(dst, 61<<2, byte(n), byte(n>>8))
+		}
+		dst = append(dst, chunk...)
+		lit = lit[len(chunk):]
+	}
+	return dst
+}
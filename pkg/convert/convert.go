@@ -2,116 +2,304 @@ package convert
 
 import (
 	"encoding/binary"
+	"errors"
+	"time"
 
 	"github.com/edge/databank/pkg/endian"
 )
 
+// ErrInvalid is returned when bytes cannot be converted to a value because they are not a valid encoding of it.
+var ErrInvalid = errors.New("invalid encoding")
+
+// Canonical byte order of numeric values.
+// The package-level conversion functions use this order, so that values converted on one architecture can be read on any other.
+var Canonical binary.ByteOrder = binary.LittleEndian
+
+// Endian returns the byte order of the host machine.
+// If it cannot be detected, the canonical byte order is returned instead.
 func Endian() binary.ByteOrder {
 	e, err := endian.HostEndian()
 	if err != nil {
-		panic(err)
+		return Canonical
 	}
 	return e
 }
 
+// OrderName returns the name of a byte order, for storing alongside converted values.
+func OrderName(o binary.ByteOrder) string {
+	switch o {
+	case binary.BigEndian:
+		return "be"
+	case binary.LittleEndian:
+		return "le"
+	}
+	return ""
+}
+
+// ParseOrder returns the byte order for a name produced by OrderName.
+func ParseOrder(name string) (binary.ByteOrder, bool) {
+	switch name {
+	case "be":
+		return binary.BigEndian, true
+	case "le":
+		return binary.LittleEndian, true
+	}
+	return nil, false
+}
+
+// ToBytes converts a value of any supported type to bytes.
+// Numeric values are converted in the canonical byte order.
 func ToBytes(i interface{}) (o []byte, ok bool) {
 	ok = true
-	switch i.(type) {
+	switch v := i.(type) {
 	case []byte:
-		o = i.([]byte)
-		break
+		o = v
+	case bool:
+		o = BoolToBytes(v)
+	case float32:
+		b := Float32ToBytes(v)
+		o = b[0:4]
+	case float64:
+		b := Float64ToBytes(v)
+		o = b[0:8]
+	case int8:
+		o = Int8ToBytes(v)
 	case int16:
-		b := Int16ToBytes(i.(int16))
+		b := Int16ToBytes(v)
 		o = b[0:2]
-		break
 	case int32:
-		b := Int32ToBytes(i.(int32))
+		b := Int32ToBytes(v)
 		o = b[0:4]
-		break
 	case int64:
-		b := Int64ToBytes(i.(int64))
+		b := Int64ToBytes(v)
 		o = b[0:8]
-		break
+	case []string:
+		o = StringsToBytes(v)
 	case string:
-		o = StringToBytes(i.(string))
-		break
+		o = StringToBytes(v)
+	case time.Duration:
+		b := DurationToBytes(v)
+		o = b[0:8]
+	case time.Time:
+		b, err := TimeToBytes(v)
+		o, ok = b, err == nil
+	case uint8:
+		o = Uint8ToBytes(v)
 	case uint16:
-		b := Uint16ToBytes(i.(uint16))
+		b := Uint16ToBytes(v)
 		o = b[0:2]
-		break
 	case uint32:
-		b := Uint32ToBytes(i.(uint32))
+		b := Uint32ToBytes(v)
 		o = b[0:4]
-		break
 	case uint64:
-		b := Uint64ToBytes(i.(uint64))
+		b := Uint64ToBytes(v)
 		o = b[0:8]
-		break
 	default:
 		ok = false
-		break
 	}
 	return
 }
 
+// FromBytes converts bytes to a value of any type supported by ToBytes.
+// i must be a pointer to the value, which is set only if the bytes are a valid encoding of its type.
+func FromBytes(b []byte, i interface{}) (ok bool) {
+	size := func(n int) bool {
+		return len(b) == n
+	}
+	switch v := i.(type) {
+	case *[]byte:
+		*v, ok = append([]byte{}, b...), true
+	case *bool:
+		if ok = size(1); ok {
+			*v = BytesToBool(b[0])
+		}
+	case *float32:
+		if ok = size(4); ok {
+			*v = BytesToFloat32([4]byte{b[0], b[1], b[2], b[3]})
+		}
+	case *float64:
+		if ok = size(8); ok {
+			*v = BytesToFloat64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+		}
+	case *int8:
+		if ok = size(1); ok {
+			*v = BytesToInt8(b[0])
+		}
+	case *int16:
+		if ok = size(2); ok {
+			*v = BytesToInt16([2]byte{b[0], b[1]})
+		}
+	case *int32:
+		if ok = size(4); ok {
+			*v = BytesToInt32([4]byte{b[0], b[1], b[2], b[3]})
+		}
+	case *int64:
+		if ok = size(8); ok {
+			*v = BytesToInt64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+		}
+	case *[]string:
+		s, err := BytesToStrings(b)
+		if ok = err == nil; ok {
+			*v = s
+		}
+	case *string:
+		*v, ok = BytesToString(b), true
+	case *time.Duration:
+		if ok = size(8); ok {
+			*v = BytesToDuration([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+		}
+	case *time.Time:
+		t, err := BytesToTime(b)
+		if ok = err == nil; ok {
+			*v = t
+		}
+	case *uint8:
+		if ok = size(1); ok {
+			*v = BytesToUint8(b[0])
+		}
+	case *uint16:
+		if ok = size(2); ok {
+			*v = BytesToUint16([2]byte{b[0], b[1]})
+		}
+	case *uint32:
+		if ok = size(4); ok {
+			*v = BytesToUint32([4]byte{b[0], b[1], b[2], b[3]})
+		}
+	case *uint64:
+		if ok = size(8); ok {
+			*v = BytesToUint64([8]byte{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7]})
+		}
+	}
+	return
+}
+
+func BoolToBytes(i bool) []byte {
+	if i {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func BytesToBool(i byte) bool {
+	return i != 0
+}
+
+func BytesToDuration(i [8]byte) time.Duration {
+	return NewConverter(Canonical).BytesToDuration(i)
+}
+
+func BytesToFloat32(i [4]byte) float32 {
+	return NewConverter(Canonical).BytesToFloat32(i)
+}
+
+func BytesToFloat64(i [8]byte) float64 {
+	return NewConverter(Canonical).BytesToFloat64(i)
+}
+
+func BytesToInt8(i byte) int8 {
+	return int8(i)
+}
+
 func BytesToInt16(i [2]byte) int16 {
-	return int16(Endian().Uint16(i[0:2]))
+	return NewConverter(Canonical).BytesToInt16(i)
 }
 
 func BytesToInt32(i [4]byte) int32 {
-	return int32(Endian().Uint32(i[0:4]))
+	return NewConverter(Canonical).BytesToInt32(i)
 }
 
 func BytesToInt64(i [8]byte) int64 {
-	return int64(Endian().Uint64(i[0:8]))
+	return NewConverter(Canonical).BytesToInt64(i)
 }
 
 func BytesToString(i []byte) string {
 	return string(i)
 }
 
+func BytesToStrings(i []byte) ([]string, error) {
+	return NewConverter(Canonical).BytesToStrings(i)
+}
+
+// BytesToTime converts bytes produced by TimeToBytes to a time.
+func BytesToTime(i []byte) (time.Time, error) {
+	t := time.Time{}
+	if err := t.UnmarshalBinary(i); err != nil {
+		return t, ErrInvalid
+	}
+	return t, nil
+}
+
+func BytesToUint8(i byte) uint8 {
+	return i
+}
+
 func BytesToUint16(i [2]byte) uint16 {
-	return Endian().Uint16(i[0:2])
+	return NewConverter(Canonical).BytesToUint16(i)
 }
 
 func BytesToUint32(i [4]byte) uint32 {
-	return Endian().Uint32(i[0:4])
+	return NewConverter(Canonical).BytesToUint32(i)
 }
 
 func BytesToUint64(i [8]byte) uint64 {
-	return Endian().Uint64(i[0:8])
+	return NewConverter(Canonical).BytesToUint64(i)
 }
 
-func Int16ToBytes(i int16) (o [2]byte) {
-	Endian().PutUint16(o[0:2], uint16(i))
-	return
+func DurationToBytes(i time.Duration) [8]byte {
+	return NewConverter(Canonical).DurationToBytes(i)
 }
 
-func Int32ToBytes(i int32) (o [4]byte) {
-	Endian().PutUint32(o[0:4], uint32(i))
-	return
+func Float32ToBytes(i float32) [4]byte {
+	return NewConverter(Canonical).Float32ToBytes(i)
 }
 
-func Int64ToBytes(i int64) (o [8]byte) {
-	Endian().PutUint64(o[0:8], uint64(i))
-	return
+func Float64ToBytes(i float64) [8]byte {
+	return NewConverter(Canonical).Float64ToBytes(i)
+}
+
+func Int8ToBytes(i int8) []byte {
+	return []byte{byte(i)}
+}
+
+func Int16ToBytes(i int16) [2]byte {
+	return NewConverter(Canonical).Int16ToBytes(i)
+}
+
+func Int32ToBytes(i int32) [4]byte {
+	return NewConverter(Canonical).Int32ToBytes(i)
+}
+
+func Int64ToBytes(i int64) [8]byte {
+	return NewConverter(Canonical).Int64ToBytes(i)
 }
 
 func StringToBytes(i string) []byte {
 	return []byte(i)
 }
 
-func Uint16ToBytes(i uint16) (o [2]byte) {
-	Endian().PutUint16(o[0:2], i)
-	return
+func StringsToBytes(i []string) []byte {
+	return NewConverter(Canonical).StringsToBytes(i)
 }
 
-func Uint32ToBytes(i uint32) (o [4]byte) {
-	Endian().PutUint32(o[0:4], i)
-	return
+// TimeToBytes converts a time to bytes, including its location offset.
+// The encoding is independent of byte order.
+// This fails only if the location offset is not a whole number of minutes, which no real time zone has.
+func TimeToBytes(i time.Time) ([]byte, error) {
+	return i.MarshalBinary()
 }
 
-func Uint64ToBytes(i uint64) (o [8]byte) {
-	Endian().PutUint64(o[0:8], i)
-	return
+func Uint8ToBytes(i uint8) []byte {
+	return []byte{i}
+}
+
+func Uint16ToBytes(i uint16) [2]byte {
+	return NewConverter(Canonical).Uint16ToBytes(i)
+}
+
+func Uint32ToBytes(i uint32) [4]byte {
+	return NewConverter(Canonical).Uint32ToBytes(i)
+}
+
+func Uint64ToBytes(i uint64) [8]byte {
+	return NewConverter(Canonical).Uint64ToBytes(i)
 }
@@ -0,0 +1,42 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bytes(t *testing.T) {
+	a := assert.New(t)
+
+	values := []interface{}{
+		[]byte("abc"), true, float32(1.5), -0.1, int8(-8), int16(-16), int32(-32), int64(-64),
+		[]string{"a", "", "bc"}, "abc", 90 * time.Second, time.Unix(1625583845, 0).UTC(),
+		uint8(8), uint16(16), uint32(32), uint64(64),
+	}
+	targets := []interface{}{
+		new([]byte), new(bool), new(float32), new(float64), new(int8), new(int16), new(int32), new(int64),
+		new([]string), new(string), new(time.Duration), new(time.Time),
+		new(uint8), new(uint16), new(uint32), new(uint64),
+	}
+	for i, v := range values {
+		b, ok := ToBytes(v)
+		a.True(ok)
+		a.True(FromBytes(b, targets[i]))
+		a.Equal(v, reflect.ValueOf(targets[i]).Elem().Interface())
+	}
+
+	// canonical byte order
+	b, _ := ToBytes(uint32(0x01020304))
+	a.Equal([]byte{4, 3, 2, 1}, b)
+
+	// invalid encodings
+	a.False(FromBytes([]byte{1, 2, 3}, new(int64)))
+	a.False(FromBytes([]byte{2, 0, 0, 0, 1, 0, 0, 0}, new([]string)))
+	a.False(FromBytes([]byte{1}, new(time.Time)))
+	a.False(FromBytes([]byte{1}, new(complex64)))
+	_, ok := ToBytes(complex64(1))
+	a.False(ok)
+}
@@ -0,0 +1,144 @@
+package convert
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Converter converts numeric values and string lists to and from bytes in a specific byte order.
+type Converter struct {
+	Order binary.ByteOrder
+}
+
+// NewConverter creates a converter for a byte order.
+func NewConverter(o binary.ByteOrder) Converter {
+	return Converter{Order: o}
+}
+
+func (c Converter) BytesToDuration(i [8]byte) time.Duration {
+	return time.Duration(c.Order.Uint64(i[0:8]))
+}
+
+func (c Converter) BytesToFloat32(i [4]byte) float32 {
+	return math.Float32frombits(c.Order.Uint32(i[0:4]))
+}
+
+func (c Converter) BytesToFloat64(i [8]byte) float64 {
+	return math.Float64frombits(c.Order.Uint64(i[0:8]))
+}
+
+func (c Converter) BytesToInt16(i [2]byte) int16 {
+	return int16(c.Order.Uint16(i[0:2]))
+}
+
+func (c Converter) BytesToInt32(i [4]byte) int32 {
+	return int32(c.Order.Uint32(i[0:4]))
+}
+
+func (c Converter) BytesToInt64(i [8]byte) int64 {
+	return int64(c.Order.Uint64(i[0:8]))
+}
+
+// BytesToStrings converts bytes produced by StringsToBytes to a list of strings.
+func (c Converter) BytesToStrings(i []byte) ([]string, error) {
+	if len(i) < 4 {
+		return nil, ErrInvalid
+	}
+	n := c.Order.Uint32(i[0:4])
+	i = i[4:]
+	if uint64(n)*4 > uint64(len(i)) {
+		return nil, ErrInvalid
+	}
+	o := make([]string, 0, n)
+	for ; n > 0; n-- {
+		if len(i) < 4 {
+			return nil, ErrInvalid
+		}
+		l := c.Order.Uint32(i[0:4])
+		i = i[4:]
+		if uint64(l) > uint64(len(i)) {
+			return nil, ErrInvalid
+		}
+		o = append(o, string(i[:l]))
+		i = i[l:]
+	}
+	if len(i) > 0 {
+		return nil, ErrInvalid
+	}
+	return o, nil
+}
+
+func (c Converter) BytesToUint16(i [2]byte) uint16 {
+	return c.Order.Uint16(i[0:2])
+}
+
+func (c Converter) BytesToUint32(i [4]byte) uint32 {
+	return c.Order.Uint32(i[0:4])
+}
+
+func (c Converter) BytesToUint64(i [8]byte) uint64 {
+	return c.Order.Uint64(i[0:8])
+}
+
+func (c Converter) DurationToBytes(i time.Duration) (o [8]byte) {
+	c.Order.PutUint64(o[0:8], uint64(i))
+	return
+}
+
+func (c Converter) Float32ToBytes(i float32) (o [4]byte) {
+	c.Order.PutUint32(o[0:4], math.Float32bits(i))
+	return
+}
+
+func (c Converter) Float64ToBytes(i float64) (o [8]byte) {
+	c.Order.PutUint64(o[0:8], math.Float64bits(i))
+	return
+}
+
+func (c Converter) Int16ToBytes(i int16) (o [2]byte) {
+	c.Order.PutUint16(o[0:2], uint16(i))
+	return
+}
+
+func (c Converter) Int32ToBytes(i int32) (o [4]byte) {
+	c.Order.PutUint32(o[0:4], uint32(i))
+	return
+}
+
+func (c Converter) Int64ToBytes(i int64) (o [8]byte) {
+	c.Order.PutUint64(o[0:8], uint64(i))
+	return
+}
+
+// StringsToBytes converts a list of strings to bytes.
+// The list is encoded as its length followed by each string prefixed with its length, each length being a uint32.
+func (c Converter) StringsToBytes(i []string) []byte {
+	n := 4
+	for _, s := range i {
+		n += 4 + len(s)
+	}
+	o := make([]byte, 4, n)
+	c.Order.PutUint32(o[0:4], uint32(len(i)))
+	l := [4]byte{}
+	for _, s := range i {
+		c.Order.PutUint32(l[0:4], uint32(len(s)))
+		o = append(append(o, l[0:4]...), s...)
+	}
+	return o
+}
+
+func (c Converter) Uint16ToBytes(i uint16) (o [2]byte) {
+	c.Order.PutUint16(o[0:2], i)
+	return
+}
+
+func (c Converter) Uint32ToBytes(i uint32) (o [4]byte) {
+	c.Order.PutUint32(o[0:4], i)
+	return
+}
+
+func (c Converter) Uint64ToBytes(i uint64) (o [8]byte) {
+	c.Order.PutUint64(o[0:8], i)
+	return
+}
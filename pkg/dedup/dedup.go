@@ -0,0 +1,371 @@
+package dedup
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/edge/databank"
+)
+
+// Config for a dedup Driver.
+type Config struct {
+	// Threshold is the minimum content size in bytes to deduplicate.
+	// Smaller content is stored inline, as the overhead of a separate blob outweighs any saving.
+	Threshold int
+}
+
+// Driver is a deduplicating implementation of databank.Driver.
+// It wraps another driver, storing each distinct content once by its SHA-256 hash, so that entries with identical content share storage.
+//
+// Entries are stored as pointers to their content hash, with content stored in a separate blob entry with a reference count.
+// Blobs that are no longer referenced are deleted by Cleanup, which also corrects any reference counts left inaccurate by an interrupted write.
+//
+// Blobs and reference counts are stored in internal entries with IDs prefixed "dedup.", which are marked as such in their metadata and hidden from Scan, Count and Search.
+// Entries written by users with similar IDs are not marked, so are left alone.
+// Reference counts are kept consistent within a process; multiple processes should not write to the same storage through separate Drivers.
+type Driver struct {
+	databank.Passthrough
+
+	config *Config
+	// mtx is held while updating reference counts.
+	mtx *sync.Mutex
+}
+
+// Stats of deduplicated content.
+type Stats struct {
+	// Blobs of distinct content.
+	Blobs uint
+	// LogicalSize of deduplicated content, i.e. the sum of the size of every entry's content.
+	LogicalSize uint64
+	// StoredSize of deduplicated content, i.e. the sum of the size of every blob.
+	StoredSize uint64
+}
+
+// New deduplicating Driver.
+func New(c *Config, next databank.Driver) *Driver {
+	return &Driver{
+		Passthrough: databank.NewPassthrough(next),
+
+		config: c,
+		mtx:    &sync.Mutex{},
+	}
+}
+
+// NewConfig creates a dedup Driver configuration with sensible defaults.
+// Content of 64 bytes or more is deduplicated.
+func NewConfig() *Config {
+	return &Config{
+		Threshold: 64,
+	}
+}
+
+// Cleanup all expired entries with the next driver, then delete any blobs that are no longer referenced by the entries that remain.
+//
+// Blobs are found through their reference counts, so that their content is not read.
+// Only blobs without a reference count, left by an interrupted write, are read to check that they are internal, and then without content if the next driver can stream it.
+func (d *Driver) Cleanup() (uint, bool, []error) {
+	n, ok, errs := d.Next.Cleanup()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	ids, _, err := d.Next.Scan()
+	if err != nil {
+		return n, false, append(errs, err)
+	}
+	live := map[string]int{}
+	hashes := map[string]bool{}
+	blobs := []string{}
+	classify := func(id string, e *databank.Entry) {
+		if isInternal(e) {
+			if hash, ok := internalHash(id); ok {
+				hashes[hash] = true
+			}
+			return
+		}
+		if hash := pointsTo(e); hash != "" {
+			live[hash]++
+		}
+	}
+	for _, id := range ids {
+		if strings.HasPrefix(id, blobPrefix) {
+			blobs = append(blobs, id)
+			continue
+		}
+		e, found, err := d.Next.Read(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if found {
+			classify(id, e)
+		}
+	}
+	for _, id := range blobs {
+		if hash, _ := internalHash(id); hashes[hash] {
+			continue
+		}
+		e, found, err := d.readMeta(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if found {
+			classify(id, e)
+		}
+	}
+	for hash := range hashes {
+		if err := d.collect(hash, live[hash]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, ok, errs
+}
+
+// Count total number of entries in storage, excluding blobs.
+func (d *Driver) Count() (uint, bool, error) {
+	ids, ok, err := d.Scan()
+	return uint(len(ids)), ok, err
+}
+
+// Create an entry whose content is written through the returned writer.
+// Content is buffered in memory, then deduplicated and written when the writer is closed.
+func (d *Driver) Create(e *databank.Entry) (io.WriteCloser, error) {
+	return databank.CreateBuffered(d, e), nil
+}
+
+// Delete an entry.
+// Its content is deleted by Cleanup if no other entry references it.
+func (d *Driver) Delete(id string) (bool, error) {
+	return d.apply([]databank.TxOp{{ID: id}})
+}
+
+// DeleteMany deletes multiple entries.
+func (d *Driver) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, id := range ids {
+		ok, err := d.Delete(id)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+// OpenReader opens an entry for reading its content.
+// The entry is read and resolved in full, then its content is read from memory.
+func (d *Driver) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenBuffered(d, id)
+}
+
+// Ratio of the logical size of deduplicated content to its stored size.
+// For example, a ratio of 3 means that deduplication has saved two thirds of the storage deduplicated content would otherwise use.
+// If there is no deduplicated content, the ratio is 1.
+func (d *Driver) Ratio() (float64, error) {
+	s, err := d.Stats()
+	if err != nil || s.StoredSize == 0 {
+		return 1, err
+	}
+	return float64(s.LogicalSize) / float64(s.StoredSize), nil
+}
+
+// Read an entry from storage, resolving its content.
+func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
+	e, ok, err := d.Next.Read(id)
+	if !ok || err != nil {
+		return e, ok, err
+	}
+	if e, err = d.resolve(e); err != nil {
+		return nil, false, err
+	}
+	return e, true, nil
+}
+
+// ReadMany reads multiple entries from storage, resolving their content.
+func (d *Driver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results, errs := databank.ReadMany(d.Next, ids)
+	for id, e := range results {
+		r, err := d.resolve(e)
+		if err != nil {
+			delete(results, id)
+			errs[id] = err
+			continue
+		}
+		results[id] = r
+	}
+	return results, errs
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+// The entry is read and resolved in full, then the range is sliced from its content.
+func (d *Driver) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRangeFull(d, id, offset, length)
+}
+
+// Scan for IDs, excluding blobs.
+func (d *Driver) Scan() ([]string, bool, error) {
+	ids, ok, err := d.Next.Scan()
+	if err != nil {
+		return ids, ok, err
+	}
+	internals, err := d.internalIDs(ids)
+	if err != nil {
+		return []string{}, false, err
+	}
+	entries := []string{}
+	for _, id := range ids {
+		if !internals[id] {
+			entries = append(entries, id)
+		}
+	}
+	return entries, ok, nil
+}
+
+// Search entries, resolving their content.
+func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	results, ok, err := d.Next.Search(q)
+	if err != nil {
+		return results, ok, err
+	}
+	resolved := map[string]*databank.Entry{}
+	for id, e := range results {
+		if isInternal(e) {
+			continue
+		}
+		if resolved[id], err = d.resolve(e); err != nil {
+			return map[string]*databank.Entry{}, false, err
+		}
+	}
+	return resolved, ok, nil
+}
+
+// Stats of deduplicated content, read from the reference counts of blobs.
+func (d *Driver) Stats() (*Stats, error) {
+	ids, _, err := d.Next.Scan()
+	if err != nil {
+		return nil, err
+	}
+	s := &Stats{}
+	for _, id := range ids {
+		hash, ok := internalHash(id)
+		if !ok || id != refsID(hash) {
+			continue
+		}
+		r, err := d.readRefs(hash)
+		if err != nil {
+			return nil, err
+		}
+		if r.Count == 0 {
+			continue
+		}
+		s.Blobs++
+		s.LogicalSize += uint64(r.Count * r.Size)
+		s.StoredSize += uint64(r.Size)
+	}
+	return s, nil
+}
+
+// Transact applies a set of operations, deduplicating written entries.
+//
+// Expected versions are calculated from entries with their content, which differ from the pointers in storage.
+// Each is checked against the resolved entry in storage, then replaced with the version of the stored pointer, so that the next driver can still detect any conflict atomically.
+func (d *Driver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	stored := map[string]string{}
+	for id, v := range expect {
+		e, _, err := d.Next.Read(id)
+		if err != nil {
+			return false, err
+		}
+		r, err := d.resolve(e)
+		if err != nil {
+			return false, err
+		}
+		if databank.Version(r) != v {
+			return false, databank.ErrTxConflict
+		}
+		stored[id] = databank.Version(e)
+	}
+	planned, err := d.plan(ops)
+	if err != nil {
+		return false, err
+	}
+	return databank.Transact(d.Next, stored, planned)
+}
+
+// WithContext creates a copy of the Driver with the context bound to the next driver.
+func (d *Driver) WithContext(ctx context.Context) databank.Driver {
+	c := *d
+	c.Next = databank.WithContext(ctx, d.Next)
+	return &c
+}
+
+// Write an entry to storage, deduplicating its content.
+func (d *Driver) Write(e *databank.Entry) (bool, error) {
+	return d.apply([]databank.TxOp{{ID: e.ID(), Entry: e}})
+}
+
+// WriteMany writes multiple entries to storage, deduplicating their content.
+func (d *Driver) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	errs := map[string]error{}
+	for _, e := range entries {
+		id := e.ID()
+		ok, err := d.Write(e)
+		if err != nil {
+			errs[id] = err
+		}
+		results[id] = ok
+	}
+	return results, errs
+}
+
+// apply a set of entry operations one at a time, along with their blob and reference count operations.
+func (d *Driver) apply(ops []databank.TxOp) (bool, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	planned, err := d.plan(ops)
+	if err != nil {
+		return false, err
+	}
+	for _, op := range planned {
+		var ok bool
+		if op.Entry != nil {
+			ok, err = d.Next.Write(op.Entry)
+		} else {
+			ok, err = d.Next.Delete(op.ID)
+		}
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+// collect a blob if it is no longer referenced, or correct its reference count if it is inaccurate.
+func (d *Driver) collect(hash string, live int) error {
+	if live == 0 {
+		_, errs := databank.DeleteMany(d.Next, []string{blobID(hash), refsID(hash)})
+		for _, err := range errs {
+			return err
+		}
+		return nil
+	}
+	r, err := d.readRefs(hash)
+	if err != nil {
+		return err
+	}
+	if r.Count == live {
+		return nil
+	}
+	r.Count = live
+	op, err := refsOp(hash, r)
+	if err != nil {
+		return err
+	}
+	_, err = d.Next.Write(op.Entry)
+	return err
+}
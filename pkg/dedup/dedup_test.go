@@ -0,0 +1,191 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+var asset = strings.Repeat("<svg><path d=\"M0 0h24v24H0z\"/></svg>", 10)
+
+// readSpy records the ID of every entry read from it.
+type readSpy struct {
+	databank.Passthrough
+	read []string
+}
+
+func (d *readSpy) Read(id string) (*databank.Entry, bool, error) {
+	d.read = append(d.read, id)
+	return d.Next.Read(id)
+}
+
+func Test_DedupDriver(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		c := NewConfig()
+		c.Threshold = 0
+		return New(c, atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_DedupDriver_Dedup(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	d := New(NewConfig(), back)
+	db := databank.New(nil, d)
+
+	for _, region := range []string{"eu", "us", "asia"} {
+		e := db.NewEntry("logo")
+		e.Tags["region"] = region
+		e.WriteString(asset)
+		a.True(db.Write(e))
+	}
+
+	// content is stored once
+	hash := hashContent([]byte(asset))
+	blob, ok, _ := back.Read(blobID(hash))
+	a.True(ok)
+	a.Equal(asset, string(blob.Content))
+	r, _ := d.readRefs(hash)
+	a.Equal(3, r.Count)
+
+	ids, _ := db.Scan()
+	a.Len(ids, 3)
+	n, _ := db.Count()
+	a.Equal(uint(3), n)
+	for _, id := range ids {
+		stored, _, _ := back.Read(id)
+		a.Equal(hash, stored.Meta.ContentHash)
+		a.Empty(stored.Content)
+
+		e, ok := db.Read(id)
+		a.True(ok)
+		a.Equal(asset, string(e.Content))
+		a.Equal(len(asset), e.Size)
+		a.Equal("", e.Meta.ContentHash)
+	}
+
+	ratio, err := d.Ratio()
+	a.Nil(err)
+	a.Equal(3.0, ratio)
+
+	// small content is stored inline
+	e, _ := db.WriteString("small", "abc")
+	stored, _, _ := back.Read(e.ID())
+	a.Equal("abc", string(stored.Content))
+	a.Equal("", stored.Meta.ContentHash)
+
+	// modifying read content does not affect other entries
+	e, _ = db.Read(ids[0])
+	e.Content[0] = 'X'
+	e, _ = db.Read(ids[1])
+	a.Equal(asset, string(e.Content))
+}
+
+func Test_DedupDriver_Cleanup(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	d := New(NewConfig(), back)
+	db := databank.New(nil, d)
+
+	db.WriteString("a", asset)
+	db.WriteString("b", asset)
+	hash := hashContent([]byte(asset))
+
+	// unreferenced blobs are kept until cleanup
+	a.True(db.Delete("a"))
+	r, _ := d.readRefs(hash)
+	a.Equal(1, r.Count)
+	db.WriteString("b", strings.ToUpper(asset))
+	r, _ = d.readRefs(hash)
+	a.Equal(0, r.Count)
+	a.True(db.Has(blobID(hash)))
+
+	ratio, _ := d.Ratio()
+	a.Equal(1.0, ratio)
+
+	// expired entries are cleaned up along with their content
+	db.WriteString("c", strings.ToLower(asset))
+	a.True(db.Expire("c"))
+
+	n, ok := db.Cleanup()
+	a.True(ok)
+	a.Equal(uint(1), n)
+	a.False(db.Has(blobID(hash)))
+	a.False(db.Has(refsID(hash)))
+	a.False(db.Has(blobID(hashContent([]byte(strings.ToLower(asset))))))
+	v, _ := db.ReadString("b")
+	a.Equal(strings.ToUpper(asset), v)
+
+	// inaccurate reference counts are corrected
+	upper := hashContent([]byte(strings.ToUpper(asset)))
+	op, _ := refsOp(upper, &refs{Count: 5, Size: len(asset)})
+	back.Write(op.Entry)
+	db.Cleanup()
+	r, _ = d.readRefs(upper)
+	a.Equal(1, r.Count)
+	count, _, _ := back.Count()
+	a.Equal(uint(3), count)
+
+	// entries that only look internal are neither hidden nor collected
+	db.WriteString(blobID(hash), "abc")
+	db.WriteString(refsID(hash), "def")
+	db.Cleanup()
+	ids, _ := db.Scan()
+	a.ElementsMatch([]string{"b", blobID(hash), refsID(hash)}, ids)
+	v, _ = db.ReadString(refsID(hash))
+	a.Equal("def", v)
+}
+
+func Test_DedupDriver_CleanupBlobs(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	spy := &readSpy{Passthrough: databank.NewPassthrough(back)}
+	db := databank.New(nil, New(NewConfig(), spy))
+
+	db.WriteString("a", asset)
+	db.WriteString("b", strings.ToUpper(asset))
+	a.True(db.Delete("b"))
+	// a blob left without a reference count by an interrupted write
+	orphan := hashContent([]byte(strings.ToLower(asset)))
+	back.Write(blobOp(orphan, []byte(strings.ToLower(asset))).Entry)
+
+	spy.read = []string{}
+	db.Cleanup()
+	for _, id := range spy.read {
+		a.False(strings.HasPrefix(id, blobPrefix), id)
+	}
+	a.True(db.Has(blobID(hashContent([]byte(asset)))))
+	a.False(db.Has(blobID(hashContent([]byte(strings.ToUpper(asset))))))
+	a.False(db.Has(blobID(orphan)))
+}
+
+func Test_DedupDriver_Transaction(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	d := New(NewConfig(), back)
+	db := databank.New(nil, d)
+	db.WriteString("a", asset)
+
+	tx := db.Begin()
+	e, ok, err := tx.Read("a")
+	a.True(ok)
+	a.Nil(err)
+	b := db.NewEntry("b")
+	b.WriteString(asset)
+	tx.Write(b)
+	tx.Delete("a")
+	e.WriteString(asset)
+	a.Nil(tx.Commit())
+
+	hash := hashContent([]byte(asset))
+	r, _ := d.readRefs(hash)
+	a.Equal(1, r.Count)
+	v, _ := db.ReadString("b")
+	a.Equal(asset, v)
+	a.False(db.Has("a"))
+}
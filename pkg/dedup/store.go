@@ -0,0 +1,262 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/edge/databank"
+)
+
+// Prefixes of the IDs of internal entries.
+const (
+	blobPrefix     = internalPrefix + "blob."
+	internalPrefix = "dedup."
+	refsPrefix     = internalPrefix + "refs."
+)
+
+// internal marks internal entries in their metadata (see databank.EntryMetadata.Internal).
+const internal = "dedup"
+
+// ErrMissingContent is returned when the content an entry points to cannot be found in storage.
+var ErrMissingContent = errors.New("missing content")
+
+// refs records the number of entries referencing a blob, and its size.
+type refs struct {
+	Count int `json:"count"`
+	Size  int `json:"size"`
+}
+
+// blobID gets the ID of the blob entry storing content by hash.
+func blobID(hash string) string {
+	return blobPrefix + hash
+}
+
+// blobOp creates an operation writing content to a blob entry.
+func blobOp(hash string, content []byte) databank.TxOp {
+	e := databank.NewEntry(blobID(hash), 0)
+	e.Content = append([]byte{}, content...)
+	e.Size = len(content)
+	e.Meta.Internal = internal
+	return databank.TxOp{ID: e.ID(), Entry: e}
+}
+
+// hashContent gets the SHA-256 hash of content, hex-encoded.
+func hashContent(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// internalHash gets the hash of an internal blob or refs entry from its ID.
+// An ID that has a hash is not necessarily an internal entry's; check the entry with isInternal.
+func internalHash(id string) (string, bool) {
+	for _, prefix := range []string{blobPrefix, refsPrefix} {
+		if strings.HasPrefix(id, prefix) {
+			return strings.TrimPrefix(id, prefix), true
+		}
+	}
+	return "", false
+}
+
+// isInternal checks whether a stored entry is an internal entry.
+func isInternal(e *databank.Entry) bool {
+	return e != nil && e.Meta != nil && e.Meta.Internal == internal
+}
+
+// isInternalID checks whether an ID may be of an internal entry.
+func isInternalID(id string) bool {
+	return strings.HasPrefix(id, internalPrefix)
+}
+
+// pointsTo gets the content hash an entry points to, if any.
+func pointsTo(e *databank.Entry) string {
+	if e == nil || e.Meta == nil {
+		return ""
+	}
+	return e.Meta.ContentHash
+}
+
+// refsID gets the ID of the entry recording references to a blob by hash.
+func refsID(hash string) string {
+	return refsPrefix + hash
+}
+
+// refsOp creates an operation writing the references to a blob.
+func refsOp(hash string, r *refs) (databank.TxOp, error) {
+	e := databank.NewEntry(refsID(hash), 0)
+	if err := e.WriteValue(databank.JSON, r); err != nil {
+		return databank.TxOp{}, err
+	}
+	e.CalculateSize()
+	e.Meta.Internal = internal
+	return databank.TxOp{ID: e.ID(), Entry: e}, nil
+}
+
+// plan the operations to store a set of entry operations.
+//
+// Written entries are replaced with pointers to their content, and blob and reference count operations are added around them.
+// New blobs and increased reference counts come first, and decreased reference counts last, so that if the operations are interrupted a blob is never referenced by more entries than its count.
+// Unreferenced blobs are kept until Cleanup.
+func (d *Driver) plan(ops []databank.TxOp) ([]databank.TxOp, error) {
+	deltas := map[string]int{}
+	contents := map[string][]byte{}
+	entryOps := []databank.TxOp{}
+	// current content hash of each entry, as of the operations planned so far
+	current := map[string]string{}
+	for _, op := range ops {
+		old, planned := current[op.ID]
+		if !planned {
+			e, _, err := d.Next.Read(op.ID)
+			if err != nil {
+				return nil, err
+			}
+			old = pointsTo(e)
+		}
+		if old != "" {
+			deltas[old]--
+		}
+		current[op.ID] = ""
+		if op.Entry != nil {
+			p, hash := d.pointer(op.Entry)
+			if hash != "" {
+				deltas[hash]++
+				contents[hash] = op.Entry.Content
+			}
+			op.Entry = p
+			current[op.ID] = hash
+		}
+		entryOps = append(entryOps, op)
+	}
+
+	hashes := []string{}
+	for hash := range deltas {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	before := []databank.TxOp{}
+	after := []databank.TxOp{}
+	for _, hash := range hashes {
+		delta := deltas[hash]
+		if delta == 0 {
+			continue
+		}
+		r, err := d.readRefs(hash)
+		if err != nil {
+			return nil, err
+		}
+		if content, ok := contents[hash]; ok {
+			if r.Count == 0 {
+				// the blob may be awaiting cleanup, but writing it again is harmless
+				before = append(before, blobOp(hash, content))
+			}
+			r.Size = len(content)
+		}
+		r.Count += delta
+		if r.Count < 0 {
+			r.Count = 0
+		}
+		op, err := refsOp(hash, r)
+		if err != nil {
+			return nil, err
+		}
+		if delta > 0 {
+			before = append(before, op)
+		} else {
+			after = append(after, op)
+		}
+	}
+	return append(append(before, entryOps...), after...), nil
+}
+
+// pointer creates an entry for storage that points to the hash of its content, and returns the hash.
+// If the content is below the threshold, it is stored inline and the hash is empty.
+// The original entry is not modified.
+func (d *Driver) pointer(e *databank.Entry) (*databank.Entry, string) {
+	p := e.Clone()
+	p.Size = len(e.Content)
+	if p.Meta == nil {
+		return p, ""
+	}
+	p.Meta.ContentHash = ""
+	if len(e.Content) < d.config.Threshold {
+		return p, ""
+	}
+	hash := hashContent(e.Content)
+	p.Content = []byte{}
+	p.Meta.ContentHash = hash
+	return p, hash
+}
+
+// readRefs reads the references to a blob by hash.
+// If there is no record of references, the count is zero.
+func (d *Driver) readRefs(hash string) (*refs, error) {
+	r := &refs{}
+	e, ok, err := d.Next.Read(refsID(hash))
+	if err != nil || !ok || !isInternal(e) {
+		return r, err
+	}
+	if err := e.ReadValue(databank.JSON, r); err != nil {
+		return nil, fmt.Errorf("invalid references to %s: %w", hash, err)
+	}
+	return r, nil
+}
+
+// readMeta reads a stored entry without its content, if the next driver can stream it.
+// Otherwise, the entry is read in full.
+func (d *Driver) readMeta(id string) (*databank.Entry, bool, error) {
+	e, r, ok, err := databank.OpenReader(d.Next, id)
+	if r != nil {
+		r.Close()
+	}
+	return e, ok, err
+}
+
+// resolve the content of a stored entry that points to a blob.
+// If the entry stores its content inline, it is returned as-is.
+// The stored entry is not modified.
+func (d *Driver) resolve(e *databank.Entry) (*databank.Entry, error) {
+	hash := pointsTo(e)
+	if hash == "" {
+		return e, nil
+	}
+	blob, ok, err := d.Next.Read(blobID(hash))
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !isInternal(blob) {
+		return nil, fmt.Errorf("%w: %s", ErrMissingContent, hash)
+	}
+	r := e.Clone()
+	r.Content = append([]byte{}, blob.Content...)
+	r.Size = len(r.Content)
+	r.Meta.ContentHash = ""
+	return r, nil
+}
+
+// internalIDs finds the IDs of internal entries among stored IDs.
+// IDs that may be of internal entries are read to check that they are, so that entries with similar IDs are not mistaken for them.
+func (d *Driver) internalIDs(ids []string) (map[string]bool, error) {
+	candidates := []string{}
+	for _, id := range ids {
+		if isInternalID(id) {
+			candidates = append(candidates, id)
+		}
+	}
+	found := map[string]bool{}
+	if len(candidates) == 0 {
+		return found, nil
+	}
+	entries, errs := databank.ReadMany(d.Next, candidates)
+	for _, err := range errs {
+		return nil, err
+	}
+	for id, e := range entries {
+		if isInternal(e) {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
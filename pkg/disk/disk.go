@@ -8,6 +8,8 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sync"
+	"time"
 
 	"github.com/edge/databank"
 )
@@ -16,11 +18,19 @@ import (
 type Config struct {
 	DirMode os.FileMode
 	Path    string
+	// StaleBlobAge after which Cleanup removes the temporary blob of a streamed entry whose writer was never closed, measured from when it was last written to.
+	// If zero, temporary blobs are never removed.
+	StaleBlobAge time.Duration
 }
 
 // Driver is the disk implementation of databank.Driver.
 type Driver struct {
 	config *Config
+
+	// mtx is held exclusively while committing a transaction, and shared by all other writes.
+	mtx sync.RWMutex
+	// seq distinguishes journal files.
+	seq uint64
 }
 
 var filesafeRegexp = regexp.MustCompile("[^A-z0-9\\-\\_\\.]")
@@ -33,18 +43,22 @@ func New(c *Config) (*Driver, error) {
 	if err := d.checkPath(); err != nil {
 		return nil, err
 	}
+	if err := d.recover(); err != nil {
+		return nil, err
+	}
 	return d, nil
 }
 
 // NewConfig creates a disk Driver configuration with sensible defaults.
 func NewConfig(path string) *Config {
 	return &Config{
-		DirMode: 0755,
-		Path:    path,
+		DirMode:      0755,
+		Path:         path,
+		StaleBlobAge: time.Hour,
 	}
 }
 
-// Cleanup all expired entries.
+// Cleanup all expired entries, and stale temporary blobs (see Config.StaleBlobAge).
 //
 // TODO improve performance
 func (d *Driver) Cleanup() (uint, bool, []error) {
@@ -57,7 +71,7 @@ func (d *Driver) Cleanup() (uint, bool, []error) {
 	if ok {
 		for _, id := range ids {
 			// TODO can improve reporting
-			e, ok2, err := d.Read(id)
+			e, ok2, err := d.readMeta(id)
 			if err != nil {
 				errs = append(errs, err)
 			}
@@ -75,6 +89,7 @@ func (d *Driver) Cleanup() (uint, bool, []error) {
 			}
 		}
 	}
+	errs = append(errs, d.removeStaleBlobs()...)
 	return deleted, ok, errs
 }
 
@@ -83,11 +98,8 @@ func (d *Driver) Cleanup() (uint, bool, []error) {
 func (d *Driver) Count() (uint, bool, error) {
 	var n uint
 	// TODO see comments for filepath.Walk; investigate faster counting methods
-	err := filepath.Walk(d.config.Path, func(path string, info os.FileInfo, err error) error {
-		if info.Mode().IsRegular() {
-			n++
-		}
-		return nil
+	err := d.walk(func(path string) {
+		n++
 	})
 	return n, true, err
 }
@@ -96,23 +108,16 @@ func (d *Driver) Count() (uint, bool, error) {
 // The bool return reflects the entry's nonexistence in storage when this function returns.
 // Ergo, if the ID is not found, this function still returns true.
 func (d *Driver) Delete(id string) (bool, error) {
-	ok, err := d.Has(id)
-	if err != nil {
-		return false, err
-	}
-	if !ok {
-		return true, nil
-	}
-	fn := d.FilepathByID(id)
-	err = os.Remove(fn)
-	return err == nil, err
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.delete(id)
 }
 
 // Expire an entry.
 // The bool return reflects whether the entry is in an expired or otherwise unreachable state when this function returns.
 // Ergo, if the ID is not found, this function still returns true.
 func (d *Driver) Expire(id string) (bool, error) {
-	e, ok, err := d.Read(id)
+	e, ok, err := d.readMeta(id)
 	if err != nil {
 		return false, err
 	}
@@ -146,6 +151,11 @@ func (d *Driver) Flush() (bool, []error) {
 			errs = append(errs, err)
 		}
 	}
+	for _, dir := range []string{blobsDir, tagsDir} {
+		if err := os.RemoveAll(path.Join(d.config.Path, dir)); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	return true, errs
 }
 
@@ -170,21 +180,26 @@ func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
 	if ok, err := d.Has(id); !ok {
 		return nil, ok, err
 	}
-	f := d.FilepathByID(id)
-	b, err := ioutil.ReadFile(f)
-	if err != nil {
-		return nil, false, err
-	}
-	if os.IsNotExist(err) {
-		return nil, false, nil
-	} else if err != nil {
-		return nil, false, err
-	}
-	e := databank.NewEntry("", 0)
-	if err := json.Unmarshal(b, e); err != nil {
-		return nil, false, err
+	return d.readFile(d.FilepathByID(id), true)
+}
+
+// ReadMany reads multiple entries from storage.
+//
+// Unlike Read, this does not check each entry exists beforehand, saving a filesystem operation per entry.
+func (d *Driver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results := map[string]*databank.Entry{}
+	errs := map[string]error{}
+	for _, id := range ids {
+		e, ok, err := d.readFile(d.FilepathByID(id), true)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		if ok {
+			results[id] = e
+		}
 	}
-	return e, true, err
+	return results, errs
 }
 
 // Review entries, automatically expiring them as necessary.
@@ -198,7 +213,7 @@ func (d *Driver) Review() (uint, bool, []error) {
 	if ok {
 		for _, id := range ids {
 			// TODO can improve reporting
-			e, ok2, err := d.Read(id)
+			e, ok2, err := d.readMeta(id)
 			if err != nil {
 				errs = append(errs, err)
 				continue
@@ -223,11 +238,8 @@ func (d *Driver) Review() (uint, bool, []error) {
 // Scan for IDs.
 func (d *Driver) Scan() ([]string, bool, error) {
 	keys := []string{}
-	err := filepath.Walk(d.config.Path, func(path string, info os.FileInfo, err error) error {
-		if info.Mode().IsRegular() {
-			keys = append(keys, filepath.Base(path))
-		}
-		return nil
+	err := d.walk(func(path string) {
+		keys = append(keys, filepath.Base(path))
 	})
 	return keys, true, err
 }
@@ -241,6 +253,118 @@ func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, er
 
 // Write an entry to storage.
 func (d *Driver) Write(e *databank.Entry) (bool, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.write(e)
+}
+
+// checkPath verifies that the storage path exists in disk.
+// If the path doesn't already exist, it will attempt to create it.
+func (d *Driver) checkPath() error {
+	stat, err := os.Stat(d.config.Path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(d.config.Path, d.config.DirMode); err != nil {
+			return err
+		}
+	} else {
+		if stat.Mode().IsRegular() {
+			return fmt.Errorf("%s is a file", d.config.Path)
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("%s is not a directory", d.config.Path)
+		}
+	}
+	return nil
+}
+
+// delete an entry and its index records.
+func (d *Driver) delete(id string) (bool, error) {
+	ok, err := d.Has(id)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return true, nil
+	}
+	// the entry is only needed to clean up its index records, so it doesn't matter if it can't be read
+	e, _, _ := d.readMeta(id)
+	fn := d.FilepathByID(id)
+	if err := os.Remove(fn); err != nil {
+		return false, err
+	}
+	if err := d.removeBlob(id); err != nil {
+		return false, err
+	}
+	if e != nil {
+		if err := d.unindex(e); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// readFile reads an entry from a file.
+// If the file does not exist, no error is returned.
+//
+// If content is false, the content of a streamed entry is not read, and the entry is returned with only its metadata.
+func (d *Driver) readFile(f string, content bool) (*databank.Entry, bool, error) {
+	b, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	e := databank.NewEntry("", 0)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, false, err
+	}
+	if content && e.Meta.Blob {
+		if err := d.readBlob(e); err != nil {
+			return nil, false, err
+		}
+	}
+	return e, true, nil
+}
+
+// readMeta reads an entry without the content of a streamed entry.
+// This is sufficient to update its metadata, such as when expiring it.
+func (d *Driver) readMeta(id string) (*databank.Entry, bool, error) {
+	return d.readFile(d.FilepathByID(id), false)
+}
+
+// walk the storage path, calling fn for each entry file.
+// Internal directories such as the tag index are skipped.
+func (d *Driver) walk(fn func(path string)) error {
+	return filepath.Walk(d.config.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files may be deleted mid-walk; ignore them
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != d.config.Path {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			fn(path)
+		}
+		return nil
+	})
+}
+
+// write an entry and its index records.
+//
+// If the entry only carries the metadata of a streamed entry, its stored content is kept.
+// Otherwise, its content is stored inline, replacing any streamed content.
+func (d *Driver) write(e *databank.Entry) (bool, error) {
+	if e.Meta != nil && e.Meta.Blob && len(e.Content) > 0 {
+		e = e.Clone()
+		e.Meta.Blob = false
+	}
 	file, err := os.Create(d.Filepath(e))
 	if err != nil {
 		return false, err
@@ -259,26 +383,15 @@ func (d *Driver) Write(e *databank.Entry) (bool, error) {
 		err := fmt.Errorf("Written length %d does not match data length %d", n, lb)
 		return false, err
 	}
-	return true, nil
-}
-
-// checkPath verifies that the storage path exists in disk.
-// If the path doesn't already exist, it will attempt to create it.
-func (d *Driver) checkPath() error {
-	stat, err := os.Stat(d.config.Path)
-	if os.IsNotExist(err) {
-		if err := os.MkdirAll(d.config.Path, d.config.DirMode); err != nil {
-			return err
-		}
-	} else {
-		if stat.Mode().IsRegular() {
-			return fmt.Errorf("%s is a file", d.config.Path)
-		}
-		if !stat.IsDir() {
-			return fmt.Errorf("%s is not a directory", d.config.Path)
+	if e.Meta == nil || !e.Meta.Blob {
+		if err := d.removeBlob(e.ID()); err != nil {
+			return false, err
 		}
 	}
-	return nil
+	if err := d.index(e); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // filesafe provides a one-way transformation from an ID to a path-safe filename.
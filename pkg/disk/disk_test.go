@@ -2,12 +2,18 @@ package disk
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/edge/databank"
 	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_DiskDriver(t *testing.T) {
@@ -23,3 +29,105 @@ func Test_DiskDriver(t *testing.T) {
 	})
 	dt.Run(t)
 }
+
+func Test_DiskDriver_RecoverJournal(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	d, err := New(NewConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := databank.New(nil, d)
+	db.WriteString("deleted", "abc")
+
+	// simulate a crash after journaling a transaction, but before applying it
+	e := db.NewEntry("written")
+	e.WriteString("def")
+	e.CalculateSize()
+	if _, err := d.writeJournal([]databank.TxOp{{ID: e.ID(), Entry: e}, {ID: "deleted"}}); err != nil {
+		t.Fatal(err)
+	}
+	a.Equal(false, db.Has("written"))
+
+	d, err = New(NewConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = databank.New(nil, d)
+	v, ok := db.ReadString("written")
+	a.Equal(true, ok)
+	a.Equal("def", v)
+	a.Equal(false, db.Has("deleted"))
+	ids, _ := db.Scan()
+	a.Equal([]string{"written"}, ids)
+}
+
+func Test_DiskDriver_Stream(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	d, err := New(NewConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := databank.New(nil, d)
+
+	content := strings.Repeat("x", 1<<20)
+	w := db.Create("large")
+	io.Copy(w, strings.NewReader(content))
+	a.Nil(w.Close())
+
+	// content is stored separately from metadata
+	meta, err := ioutil.ReadFile(d.FilepathByID("large"))
+	a.Nil(err)
+	a.True(len(meta) < 1024)
+	blob, err := ioutil.ReadFile(d.blobPath("large"))
+	a.Nil(err)
+	a.Equal(content, string(blob))
+	e, ok, _ := d.readMeta("large")
+	a.True(ok)
+	a.True(e.Meta.Blob)
+	a.Equal(len(content), e.Size)
+
+	// updating metadata keeps content
+	a.True(db.Expire("large"))
+	e, ok = db.Read("large")
+	a.True(ok)
+	a.True(e.Meta.Expired)
+	a.False(e.Meta.Blob)
+	a.Equal(content, string(e.Content))
+
+	// writing content inline replaces the blob
+	e.WriteString("small")
+	a.True(db.Write(e))
+	_, err = os.Stat(d.blobPath("large"))
+	a.True(os.IsNotExist(err))
+	v, _ := db.ReadString("large")
+	a.Equal("small", v)
+
+	// deleting removes the blob
+	w = db.Create("deleted")
+	w.Write([]byte("abc"))
+	a.Nil(w.Close())
+	a.True(db.Delete("deleted"))
+	_, err = os.Stat(d.blobPath("deleted"))
+	a.True(os.IsNotExist(err))
+
+	// unclosed writers store nothing
+	w = db.Create("unclosed")
+	w.Write([]byte("abc"))
+	a.False(db.Has("unclosed"))
+	n, _ := db.Count()
+	a.Equal(uint(1), n)
+
+	// their temporary blobs are removed by cleanup once stale
+	tmps, _ := filepath.Glob(path.Join(dir, blobsDir, "*.tmp"))
+	a.Equal(1, len(tmps))
+	db.Cleanup()
+	_, err = os.Stat(tmps[0])
+	a.Nil(err)
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(tmps[0], old, old)
+	db.Cleanup()
+	_, err = os.Stat(tmps[0])
+	a.True(os.IsNotExist(err))
+}
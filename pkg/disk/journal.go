@@ -0,0 +1,147 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// journalDir is the name of the directory, within the storage path, containing transaction journals.
+const journalDir = ".journal"
+
+// journal of a transaction.
+type journal struct {
+	Ops []databank.TxOp `json:"ops"`
+}
+
+// Atomic reports that transactions are applied atomically, as described by Transact.
+func (d *Driver) Atomic() bool {
+	return true
+}
+
+// Transact applies a set of operations atomically.
+//
+// The operations are first written to a journal file, which is only removed once they have all been applied.
+// If the process stops partway through, the journal is recovered the next time a Driver is created with the same storage path.
+//
+// Transactions are atomic with respect to writes made through this Driver.
+// Readers may observe a transaction partway through being applied, and other processes sharing the storage path are not synchronised.
+func (d *Driver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for id, v := range expect {
+		e, _, err := d.Read(id)
+		if err != nil {
+			return false, err
+		}
+		if databank.Version(e) != v {
+			return false, databank.ErrTxConflict
+		}
+	}
+	fn, err := d.writeJournal(ops)
+	if err != nil {
+		return false, err
+	}
+	if err := d.applyJournal(fn); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyJournal applies the operations in a journal file, then removes it.
+// As writes and deletes are idempotent, it doesn't matter if some of the operations were already applied.
+func (d *Driver) applyJournal(fn string) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	j := &journal{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return err
+	}
+	for _, op := range j.Ops {
+		var err error
+		if op.Entry != nil {
+			_, err = d.write(op.Entry)
+		} else {
+			_, err = d.delete(op.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(fn)
+}
+
+// recover any transactions that were journaled but not fully applied.
+// Incomplete journals are discarded, as their transactions were never applied.
+func (d *Driver) recover() error {
+	dir := path.Join(d.config.Path, journalDir)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := path.Join(dir, name)
+		if !strings.HasSuffix(name, ".json") {
+			if err := os.Remove(fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.applyJournal(fn); err != nil {
+			return fmt.Errorf("failed to recover journal %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// writeJournal writes operations to a new journal file and returns its path.
+// The journal is written under a temporary name and renamed once complete, so a journal is never recovered partially.
+func (d *Driver) writeJournal(ops []databank.TxOp) (string, error) {
+	dir := path.Join(d.config.Path, journalDir)
+	if err := os.MkdirAll(dir, d.config.DirMode); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(&journal{Ops: ops})
+	if err != nil {
+		return "", err
+	}
+	d.seq++
+	name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), d.seq)
+	tmp := path.Join(dir, name+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(b); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	fn := path.Join(dir, name+".json")
+	if err := os.Rename(tmp, fn); err != nil {
+		return "", err
+	}
+	return fn, nil
+}
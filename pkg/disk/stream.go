@@ -0,0 +1,153 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// blobsDir is the name of the directory, within the storage path, containing the content of streamed entries.
+const blobsDir = ".blobs"
+
+// blobWriter streams content to a temporary blob file, then stores the entry when closed.
+type blobWriter struct {
+	closed bool
+	d      *Driver
+	e      *databank.Entry
+	file   *os.File
+	size   int
+}
+
+// Create an entry whose content is written through the returned writer.
+//
+// Content is streamed to a blob file, separately from the entry's metadata, so it is never held in memory.
+// The blob is moved into place and the entry is stored when the writer is closed.
+func (d *Driver) Create(e *databank.Entry) (io.WriteCloser, error) {
+	dir := path.Join(d.config.Path, blobsDir)
+	if err := os.MkdirAll(dir, d.config.DirMode); err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(dir, filesafe(e.ID())+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &blobWriter{d: d, e: e, file: file}, nil
+}
+
+// OpenReader opens an entry for reading its content.
+// Streamed entries are read from their blob file; the content of other entries is read from memory.
+func (d *Driver) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	e, ok, err := d.readMeta(id)
+	if err != nil || !ok {
+		return nil, nil, ok, err
+	}
+	if !e.Meta.Blob {
+		r := ioutil.NopCloser(bytes.NewReader(e.Content))
+		e.Content = []byte{}
+		return e, r, true, nil
+	}
+	file, err := os.Open(d.blobPath(id))
+	if os.IsNotExist(err) {
+		// deleted since its metadata was read
+		return nil, nil, false, nil
+	} else if err != nil {
+		return nil, nil, false, err
+	}
+	return e, file, true, nil
+}
+
+// Close the writer and store the entry.
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return databank.ErrClosed
+	}
+	w.closed = true
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	w.d.mtx.RLock()
+	defer w.d.mtx.RUnlock()
+	id := w.e.ID()
+	if err := os.Rename(w.file.Name(), w.d.blobPath(id)); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	w.e.Content = []byte{}
+	w.e.Size = w.size
+	w.e.Meta.Blob = true
+	ok, err := w.d.write(w.e)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", databank.ErrWriteFailed, id)
+	}
+	return nil
+}
+
+// Write content to the blob file.
+func (w *blobWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, databank.ErrClosed
+	}
+	n, err := w.file.Write(b)
+	w.size += n
+	return n, err
+}
+
+// blobPath gets the storage path on disk for the content of a streamed entry.
+func (d *Driver) blobPath(id string) string {
+	return path.Join(d.config.Path, blobsDir, filesafe(id))
+}
+
+// readBlob reads the content of a streamed entry into it, so that it can be handled like any other entry.
+func (d *Driver) readBlob(e *databank.Entry) error {
+	b, err := ioutil.ReadFile(d.blobPath(e.ID()))
+	if err != nil {
+		return err
+	}
+	e.Content = b
+	e.Meta.Blob = false
+	return nil
+}
+
+// removeStaleBlobs removes temporary blobs that have not been written to for longer than Config.StaleBlobAge.
+// These are left behind by writers that were never closed, such as when a process exits mid-stream.
+func (d *Driver) removeStaleBlobs() []error {
+	if d.config.StaleBlobAge <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(path.Join(d.config.Path, blobsDir))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	stale := time.Now().Add(-d.config.StaleBlobAge)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".tmp") || f.ModTime().After(stale) {
+			continue
+		}
+		if err := os.Remove(path.Join(d.config.Path, blobsDir, f.Name())); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// removeBlob removes the content of a streamed entry, if there is any.
+func (d *Driver) removeBlob(id string) error {
+	if err := os.Remove(d.blobPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
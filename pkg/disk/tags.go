@@ -0,0 +1,107 @@
+package disk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/edge/databank"
+)
+
+// tagsDir is the name of the directory, within the storage path, containing the tag index.
+const tagsDir = ".tags"
+
+// Reindex rebuilds the tag index from scratch.
+// This is only necessary if the storage path has been populated by other means, such as an older version of this driver.
+func (d *Driver) Reindex() (uint, bool, []error) {
+	var indexed uint
+	if err := os.RemoveAll(path.Join(d.config.Path, tagsDir)); err != nil {
+		return indexed, false, []error{err}
+	}
+	ids, ok, err := d.Scan()
+	if err != nil {
+		return indexed, false, []error{err}
+	}
+	errs := []error{}
+	for _, id := range ids {
+		e, ok2, err := d.readMeta(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok2 {
+			continue
+		}
+		if err := d.index(e); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		indexed++
+	}
+	return indexed, ok, errs
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+//
+// Index records of entries that no longer exist are removed as they are encountered.
+func (d *Driver) Tagged(tag, value string) ([]string, bool, error) {
+	dir := d.tagPath(tag, value)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, true, nil
+	} else if err != nil {
+		return []string{}, false, err
+	}
+	ids := []string{}
+	for _, file := range files {
+		id := file.Name()
+		ok, err := d.Has(id)
+		if err != nil {
+			return []string{}, false, err
+		}
+		if !ok {
+			os.Remove(path.Join(dir, id))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, true, nil
+}
+
+// index the tags of an entry.
+//
+// Since tags are hashed into an entry's ID, rewriting an ID cannot change its tags, so there is no need to remove the index records of an entry being overwritten.
+func (d *Driver) index(e *databank.Entry) error {
+	for tag, value := range e.Tags {
+		dir := d.tagPath(tag, value)
+		if err := os.MkdirAll(dir, d.config.DirMode); err != nil {
+			return err
+		}
+		file, err := os.Create(path.Join(dir, filesafe(e.ID())))
+		if err != nil {
+			return err
+		}
+		file.Close()
+	}
+	return nil
+}
+
+// tagPath gets the index directory for a tag value.
+// Tags and values are hashed together to ensure the directory name is path-safe and unique.
+func (d *Driver) tagPath(tag, value string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s", tag, value)))
+	return path.Join(d.config.Path, tagsDir, fmt.Sprintf("%x", sum))
+}
+
+// unindex the tags of an entry.
+func (d *Driver) unindex(e *databank.Entry) error {
+	for tag, value := range e.Tags {
+		err := os.Remove(path.Join(d.tagPath(tag, value), filesafe(e.ID())))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
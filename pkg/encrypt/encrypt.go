@@ -0,0 +1,480 @@
+package encrypt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/edge/databank"
+)
+
+// ErrTampered is returned when stored content fails authentication, i.e. it has been modified or corrupted, or moved to another entry.
+var ErrTampered = errors.New("entry authentication failed")
+
+// Config for an encrypt Middleware.
+type Config struct {
+	// AllowPlaintext reads entries stored without encryption as-is, so that existing storage can be encrypted gradually.
+	// Otherwise, they are rejected with ErrTampered, as an attacker with access to storage could replace encrypted entries with plaintext.
+	AllowPlaintext bool
+	// EncryptKeys encrypts entry keys and tags as well as content.
+	// Entries are stored under an opaque ID derived from their real ID, and their key and tags are encrypted with their content.
+	//
+	// Lookups by ID still work, but Tagged must read and decrypt every entry.
+	// Requires IDKey.
+	EncryptKeys bool
+	// IDKey is a 32-byte key used to derive stored IDs when EncryptKeys is set.
+	// It must never change, otherwise existing entries cannot be found.
+	IDKey []byte
+	// Keyring of encryption keys.
+	Keyring *Keyring
+	// RotateOnRead re-encrypts entries with the primary key when they are read, if they were encrypted with another key.
+	RotateOnRead bool
+}
+
+// Middleware is an encryption middleware that wraps another driver.
+// Entry content is encrypted at rest with AES-GCM, and authenticated when it is read: if stored content has been tampered with, ErrTampered is returned.
+//
+// The ID of the key used is recorded in each entry's metadata, so that keys can be rotated without re-encrypting everything at once.
+// See Keyring, Config.RotateOnRead and Rotate.
+//
+// Entry metadata is not encrypted, so that drivers can still expire and clean up entries.
+// Entries stored without encryption are rejected, unless Config.AllowPlaintext is set.
+//
+// When combined with compress.Middleware, compression must be outside encryption, as encrypted content does not compress:
+//
+//	d := compress.NewMiddleware(compress.NewConfig(), encryptMiddleware)
+type Middleware struct {
+	databank.Passthrough
+
+	config *Config
+	ids    *idCipher
+}
+
+// envelope of an entry's key, tags and content, encrypted together when keys are encrypted.
+type envelope struct {
+	Content []byte            `json:"content"`
+	Key     string            `json:"key"`
+	Tags    map[string]string `json:"tags"`
+}
+
+// NewConfig creates an encrypt Middleware configuration with a keyring.
+// Only content is encrypted by default.
+func NewConfig(k *Keyring) *Config {
+	return &Config{
+		Keyring: k,
+	}
+}
+
+// NewMiddleware creates a new encrypt Middleware.
+func NewMiddleware(c *Config, next databank.Driver) (*Middleware, error) {
+	if c.Keyring == nil {
+		return nil, errors.New("keyring is required")
+	}
+	m := &Middleware{
+		Passthrough: databank.NewPassthrough(next),
+
+		config: c,
+	}
+	if c.EncryptKeys {
+		ids, err := newIDCipher(c.IDKey)
+		if err != nil {
+			return nil, err
+		}
+		m.ids = ids
+	}
+	return m, nil
+}
+
+// Create an entry whose content is written through the returned writer.
+// Content is buffered in memory, then encrypted and written when the writer is closed.
+func (m *Middleware) Create(e *databank.Entry) (io.WriteCloser, error) {
+	return databank.CreateBuffered(m, e), nil
+}
+
+// Delete an entry.
+func (m *Middleware) Delete(id string) (bool, error) {
+	return m.Next.Delete(m.storedID(id))
+}
+
+// DeleteMany deletes multiple entries.
+func (m *Middleware) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results, errs := databank.DeleteMany(m.Next, m.storedIDs(ids))
+	return m.logicalResults(results), m.logicalErrs(errs)
+}
+
+// Expire an entry.
+func (m *Middleware) Expire(id string) (bool, error) {
+	return m.Next.Expire(m.storedID(id))
+}
+
+// Has an ID, i.e. entry exists in storage?
+func (m *Middleware) Has(id string) (bool, error) {
+	return m.Next.Has(m.storedID(id))
+}
+
+// OpenReader opens an entry for reading its content.
+// The entry is read and decrypted in full, then its content is read from memory.
+func (m *Middleware) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenBuffered(m, id)
+}
+
+// Read an entry from storage, decrypting it.
+func (m *Middleware) Read(id string) (*databank.Entry, bool, error) {
+	stored, ok, err := m.Next.Read(m.storedID(id))
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	e, err := m.open(stored)
+	if err != nil {
+		return nil, false, err
+	}
+	m.maybeRotate(stored)
+	return e, true, nil
+}
+
+// ReadMany reads multiple entries from storage, decrypting them.
+func (m *Middleware) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	stored, storedErrs := databank.ReadMany(m.Next, m.storedIDs(ids))
+	results := map[string]*databank.Entry{}
+	errs := m.logicalErrs(storedErrs)
+	for sid, s := range stored {
+		id := m.logicalID(sid)
+		e, err := m.open(s)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		m.maybeRotate(s)
+		results[id] = e
+	}
+	return results, errs
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+// The entry is read and decrypted in full, then the range is sliced from its content.
+func (m *Middleware) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRangeFull(m, id, offset, length)
+}
+
+// Rotate re-encrypts all entries that were encrypted with a key other than the primary key.
+// Entries that are not encrypted are left as they are.
+//
+// The number of entries re-encrypted is returned.
+// Entries that change while they are being re-encrypted are skipped; run Rotate again to catch them.
+func (m *Middleware) Rotate() (uint, []error) {
+	var n uint
+	errs := []error{}
+	ids, _, err := m.Next.Scan()
+	if err != nil {
+		return 0, []error{err}
+	}
+	primary := m.config.Keyring.Primary()
+	stored, readErrs := databank.ReadMany(m.Next, ids)
+	for _, err := range readErrs {
+		errs = append(errs, err)
+	}
+	for _, s := range stored {
+		if s.Meta == nil || s.Meta.KeyID == "" || s.Meta.KeyID == primary {
+			continue
+		}
+		ok, err := m.reseal(s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, errs
+}
+
+// Scan for IDs.
+func (m *Middleware) Scan() ([]string, bool, error) {
+	ids, ok, err := m.Next.Scan()
+	if err != nil || m.ids == nil {
+		return ids, ok, err
+	}
+	logical := []string{}
+	for _, id := range ids {
+		logical = append(logical, m.logicalID(id))
+	}
+	return logical, ok, nil
+}
+
+// Search entries, decrypting them.
+func (m *Middleware) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	stored, ok, err := m.Next.Search(q)
+	if err != nil {
+		return stored, ok, err
+	}
+	results := map[string]*databank.Entry{}
+	for sid, s := range stored {
+		e, err := m.open(s)
+		if err != nil {
+			return map[string]*databank.Entry{}, false, err
+		}
+		results[m.logicalID(sid)] = e
+	}
+	return results, ok, nil
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+// If keys are encrypted, every entry must be read and decrypted.
+func (m *Middleware) Tagged(tag, value string) ([]string, bool, error) {
+	if m.ids == nil {
+		return databank.FindTagged(m.Next, tag, value)
+	}
+	ids, _, err := m.Next.Scan()
+	if err != nil {
+		return []string{}, false, err
+	}
+	stored, errs := databank.ReadMany(m.Next, ids)
+	for _, err := range errs {
+		return []string{}, false, err
+	}
+	tagged := []string{}
+	for _, s := range stored {
+		e, err := m.open(s)
+		if err != nil {
+			return []string{}, false, err
+		}
+		if v, ok := e.Tags[tag]; ok && v == value {
+			tagged = append(tagged, e.ID())
+		}
+	}
+	return tagged, true, nil
+}
+
+// Transact applies a set of operations, encrypting written entries.
+//
+// Expected versions are calculated from decrypted entries, which differ from those in storage.
+// Each is checked against the decrypted entry in storage, then replaced with the version of the stored entry, so that the next driver can still detect any conflict atomically.
+func (m *Middleware) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	stored := map[string]string{}
+	for id, v := range expect {
+		sid := m.storedID(id)
+		s, _, err := m.Next.Read(sid)
+		if err != nil {
+			return false, err
+		}
+		e, err := m.open(s)
+		if err != nil {
+			return false, err
+		}
+		if databank.Version(e) != v {
+			return false, databank.ErrTxConflict
+		}
+		stored[sid] = databank.Version(s)
+	}
+	sealed := []databank.TxOp{}
+	for _, op := range ops {
+		if op.Entry != nil {
+			s, err := m.seal(op.Entry)
+			if err != nil {
+				return false, err
+			}
+			op.Entry = s
+		}
+		op.ID = m.storedID(op.ID)
+		sealed = append(sealed, op)
+	}
+	return databank.Transact(m.Next, stored, sealed)
+}
+
+// WithContext creates a copy of the Middleware with the context bound to the next driver.
+func (m *Middleware) WithContext(ctx context.Context) databank.Driver {
+	c := *m
+	c.Next = databank.WithContext(ctx, m.Next)
+	return &c
+}
+
+// Write an entry to storage, encrypting it.
+func (m *Middleware) Write(e *databank.Entry) (bool, error) {
+	s, err := m.seal(e)
+	if err != nil {
+		return false, err
+	}
+	return m.Next.Write(s)
+}
+
+// WriteMany writes multiple entries to storage, encrypting them.
+func (m *Middleware) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	sealed := []*databank.Entry{}
+	errs := map[string]error{}
+	for _, e := range entries {
+		s, err := m.seal(e)
+		if err != nil {
+			errs[e.ID()] = err
+			continue
+		}
+		sealed = append(sealed, s)
+	}
+	storedResults, storedErrs := databank.WriteMany(m.Next, sealed)
+	results := m.logicalResults(storedResults)
+	for id, err := range m.logicalErrs(storedErrs) {
+		errs[id] = err
+	}
+	for id := range errs {
+		results[id] = false
+	}
+	return results, errs
+}
+
+// logicalErrs maps batch errors by stored ID to real IDs.
+func (m *Middleware) logicalErrs(errs map[string]error) map[string]error {
+	logical := map[string]error{}
+	for id, err := range errs {
+		logical[m.logicalID(id)] = err
+	}
+	return logical
+}
+
+// logicalID gets the real ID of an entry from its stored ID.
+func (m *Middleware) logicalID(id string) string {
+	if m.ids == nil {
+		return id
+	}
+	if logical, ok := m.ids.decode(id); ok {
+		return logical
+	}
+	return id
+}
+
+// logicalResults maps batch results by stored ID to real IDs.
+func (m *Middleware) logicalResults(results map[string]bool) map[string]bool {
+	logical := map[string]bool{}
+	for id, ok := range results {
+		logical[m.logicalID(id)] = ok
+	}
+	return logical
+}
+
+// maybeRotate re-encrypts a stored entry with the primary key, if configured and necessary.
+// This is best-effort: errors are ignored, as the entry can still be read with its current key.
+func (m *Middleware) maybeRotate(s *databank.Entry) {
+	if !m.config.RotateOnRead || s.Meta == nil || s.Meta.KeyID == "" || s.Meta.KeyID == m.config.Keyring.Primary() {
+		return
+	}
+	m.reseal(s)
+}
+
+// open a stored entry, decrypting and authenticating it.
+// Unencrypted entries are returned as-is. The stored entry is not modified.
+func (m *Middleware) open(s *databank.Entry) (*databank.Entry, error) {
+	if s == nil {
+		return s, nil
+	}
+	if s.Meta == nil || s.Meta.KeyID == "" {
+		if !m.config.AllowPlaintext {
+			return nil, fmt.Errorf("%w: %s is not encrypted", ErrTampered, s.ID())
+		}
+		return s, nil
+	}
+	aead, err := m.config.Keyring.get(s.Meta.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Content) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %s", ErrTampered, s.ID())
+	}
+	nonce, ciphertext := s.Content[:aead.NonceSize()], s.Content[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(s.ID()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTampered, s.ID())
+	}
+
+	e := s.Clone()
+	if isToken(s.Key) {
+		env := &envelope{}
+		if err := json.Unmarshal(plaintext, env); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTampered, s.ID(), err)
+		}
+		e.Content = env.Content
+		e.Key = env.Key
+		e.Tags = env.Tags
+		if e.Tags == nil {
+			e.Tags = map[string]string{}
+		}
+	} else {
+		e.Content = plaintext
+	}
+	e.Size = len(e.Content)
+	e.Meta.KeyID = ""
+	e.Meta.StoredSize = len(s.Content)
+	return e, nil
+}
+
+// reseal a stored entry with the primary key.
+// The entry is only replaced if it has not changed since it was read; if it has, false is returned.
+func (m *Middleware) reseal(s *databank.Entry) (bool, error) {
+	e, err := m.open(s)
+	if err != nil {
+		return false, err
+	}
+	resealed, err := m.seal(e)
+	if err != nil {
+		return false, err
+	}
+	expect := map[string]string{s.ID(): databank.Version(s)}
+	ok, err := databank.Transact(m.Next, expect, []databank.TxOp{{ID: resealed.ID(), Entry: resealed}})
+	if errors.Is(err, databank.ErrTxConflict) {
+		return false, nil
+	}
+	return ok, err
+}
+
+// seal an entry for storage, encrypting it with the primary key.
+// The original entry is not modified.
+func (m *Middleware) seal(e *databank.Entry) (*databank.Entry, error) {
+	keyID, aead := m.config.Keyring.primaryKey()
+	if aead == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	s := e.Clone()
+	plaintext := e.Content
+	if m.ids != nil {
+		b, err := json.Marshal(&envelope{Content: e.Content, Key: e.Key, Tags: e.Tags})
+		if err != nil {
+			return nil, err
+		}
+		plaintext = b
+		s.Key = m.ids.encode(e.ID())
+		s.Tags = map[string]string{}
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	s.Content = aead.Seal(nonce, nonce, plaintext, []byte(s.ID()))
+	s.Size = len(e.Content)
+	if s.Meta == nil {
+		s.Meta = &databank.EntryMetadata{}
+	}
+	s.Meta.KeyID = keyID
+	s.Meta.StoredSize = len(s.Content)
+	return s, nil
+}
+
+// storedID gets the stored ID of an entry from its real ID.
+func (m *Middleware) storedID(id string) string {
+	if m.ids == nil {
+		return id
+	}
+	return m.ids.encode(id)
+}
+
+// storedIDs gets the stored IDs of multiple entries.
+func (m *Middleware) storedIDs(ids []string) []string {
+	if m.ids == nil {
+		return ids
+	}
+	stored := []string{}
+	for _, id := range ids {
+		stored = append(stored, m.ids.encode(id))
+	}
+	return stored
+}
@@ -0,0 +1,173 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	idKey = bytes.Repeat([]byte{7}, 32)
+	key1  = bytes.Repeat([]byte{1}, 32)
+	key2  = bytes.Repeat([]byte{2}, 16)
+)
+
+func newMiddleware(t *testing.T, c *Config, next databank.Driver) *Middleware {
+	m, err := NewMiddleware(c, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func newKeyring(t *testing.T) *Keyring {
+	k, err := NewKeyring("k1", key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func Test_EncryptMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return newMiddleware(t, NewConfig(newKeyring(t)), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_EncryptMiddleware_EncryptKeys(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		c := NewConfig(newKeyring(t))
+		c.EncryptKeys = true
+		c.IDKey = idKey
+		return newMiddleware(t, c, atomicdb.New())
+	})
+	dt.Run(t)
+
+	a := assert.New(t)
+	back := atomicdb.New()
+	c := NewConfig(newKeyring(t))
+	c.EncryptKeys = true
+	c.IDKey = idKey
+	db := databank.New(nil, newMiddleware(t, c, back))
+
+	e := db.NewEntry("customer@example.com")
+	e.Tags["region"] = "eu"
+	e.WriteString("secret")
+	a.True(db.Write(e))
+
+	ids, _, _ := back.Scan()
+	a.Len(ids, 1)
+	a.True(strings.HasPrefix(ids[0], tokenPrefix))
+	stored, _, _ := back.Read(ids[0])
+	a.Equal(ids[0], stored.Key)
+	a.Empty(stored.Tags)
+	a.NotContains(string(stored.Content), "customer")
+
+	read, ok := db.Read(e.ID())
+	a.True(ok)
+	a.Equal("customer@example.com", read.Key)
+	a.Equal("eu", read.Tags["region"])
+	a.Equal([]byte("secret"), read.Content)
+
+	tagged, ok := db.Tagged("region", "eu")
+	a.True(ok)
+	a.Equal([]string{e.ID()}, tagged)
+	scanned, _ := db.Scan()
+	a.Equal([]string{e.ID()}, scanned)
+}
+
+func Test_EncryptMiddleware_Tampered(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	m := newMiddleware(t, NewConfig(newKeyring(t)), back)
+	db := databank.New(nil, m)
+
+	e, _ := db.WriteString("key", "abc")
+	stored, _, _ := back.Read(e.ID())
+	a.Equal("k1", stored.Meta.KeyID)
+	a.Equal(3, stored.Size)
+	a.Equal(len(stored.Content), stored.Meta.StoredSize)
+	a.NotContains(string(stored.Content), "abc")
+
+	stored.Content[len(stored.Content)-1] ^= 1
+	_, _, err := m.Read(e.ID())
+	a.True(errors.Is(err, ErrTampered))
+
+	// content moved to another entry fails too
+	e2, _ := db.WriteString("other", "def")
+	stored2, _, _ := back.Read(e2.ID())
+	moved := stored2.Clone()
+	moved.Key = "moved"
+	back.Write(moved)
+	_, _, err = m.Read("moved")
+	a.True(errors.Is(err, ErrTampered))
+}
+
+func Test_EncryptMiddleware_Rotate(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	k := newKeyring(t)
+	m := newMiddleware(t, NewConfig(k), back)
+	db := databank.New(nil, m)
+
+	db.WriteString("a", "1")
+	db.WriteString("b", "2")
+	db.WriteString("c", "3")
+
+	a.Nil(k.Add("k2", key2))
+	a.Nil(k.SetPrimary("k2"))
+	a.True(errors.Is(k.SetPrimary("k3"), ErrUnknownKey))
+
+	// old keys can still be read
+	v, ok := db.ReadString("a")
+	a.True(ok)
+	a.Equal("1", v)
+	stored, _, _ := back.Read("a")
+	a.Equal("k1", stored.Meta.KeyID)
+
+	// rotate on read
+	m.config.RotateOnRead = true
+	db.ReadString("a")
+	stored, _, _ = back.Read("a")
+	a.Equal("k2", stored.Meta.KeyID)
+
+	// batch rotation
+	n, errs := m.Rotate()
+	a.Empty(errs)
+	a.Equal(uint(2), n)
+	for _, id := range []string{"a", "b", "c"} {
+		stored, _, _ := back.Read(id)
+		a.Equal("k2", stored.Meta.KeyID)
+	}
+	v, _ = db.ReadString("c")
+	a.Equal("3", v)
+
+	// unknown keys cannot be read
+	k2, _ := NewKeyring("k1", key1)
+	_, _, err := newMiddleware(t, NewConfig(k2), back).Read("a")
+	a.True(errors.Is(err, ErrUnknownKey))
+}
+
+func Test_EncryptMiddleware_Plaintext(t *testing.T) {
+	a := assert.New(t)
+	back := atomicdb.New()
+	databank.New(nil, back).WriteString("legacy", "abc")
+
+	// plaintext is rejected by default
+	_, _, err := newMiddleware(t, NewConfig(newKeyring(t)), back).Read("legacy")
+	a.True(errors.Is(err, ErrTampered))
+
+	c := NewConfig(newKeyring(t))
+	c.AllowPlaintext = true
+	db := databank.New(nil, newMiddleware(t, c, back))
+	v, ok := db.ReadString("legacy")
+	a.True(ok)
+	a.Equal("abc", v)
+}
@@ -0,0 +1,78 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// tokenPrefix marks a stored key as an encrypted ID token.
+const tokenPrefix = "enc_"
+
+// idCipher deterministically encrypts IDs into tokens, so that entries can still be looked up by ID.
+//
+// The nonce is derived from an HMAC of the ID, so the same ID always produces the same token, and different IDs produce different nonces.
+// This reveals only whether two tokens are for the same ID.
+type idCipher struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// newIDCipher creates an ID cipher from a 32-byte key.
+// Separate encryption and nonce keys are derived from it.
+func newIDCipher(key []byte) (*idCipher, error) {
+	if len(key) != 32 {
+		return nil, errors.New("ID key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(derive(key, "databank id encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &idCipher{
+		aead: aead,
+		mac:  derive(key, "databank id nonce"),
+	}, nil
+}
+
+// decode a token into an ID.
+func (c *idCipher) decode(token string) (string, bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+	if err != nil || len(b) < c.aead.NonceSize() {
+		return "", false
+	}
+	id, err := c.aead.Open(nil, b[:c.aead.NonceSize()], b[c.aead.NonceSize():], nil)
+	if err != nil {
+		return "", false
+	}
+	return string(id), true
+}
+
+// encode an ID into a token.
+func (c *idCipher) encode(id string) string {
+	nonce := derive(c.mac, id)[:c.aead.NonceSize()]
+	b := c.aead.Seal(nonce, nonce, []byte(id), nil)
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// derive a 32-byte value from a key and a message.
+func derive(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+// isToken checks whether a stored key is an encrypted ID token.
+func isToken(key string) bool {
+	return strings.HasPrefix(key, tokenPrefix)
+}
@@ -0,0 +1,93 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownKey is returned when a key ID is not in the keyring.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds encryption keys by ID.
+// New entries are encrypted with the primary key; entries encrypted with any other key in the keyring can still be decrypted.
+//
+// To rotate keys, add a new key and make it primary.
+// Keep the old key in the keyring until all entries have been re-encrypted with the new one.
+type Keyring struct {
+	aeads   map[string]cipher.AEAD
+	mtx     sync.RWMutex
+	primary string
+}
+
+// NewKeyring creates a keyring with a primary key.
+// The key must be 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256 respectively.
+func NewKeyring(id string, key []byte) (*Keyring, error) {
+	k := &Keyring{
+		aeads: map[string]cipher.AEAD{},
+	}
+	if err := k.Add(id, key); err != nil {
+		return nil, err
+	}
+	k.primary = id
+	return k, nil
+}
+
+// Add a key to the keyring.
+// The key must be 16, 24 or 32 bytes long.
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("key ID must not be empty")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.aeads[id] = aead
+	return nil
+}
+
+// Primary key ID.
+func (k *Keyring) Primary() string {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	return k.primary
+}
+
+// SetPrimary sets the primary key by ID.
+// The key must already be in the keyring.
+func (k *Keyring) SetPrimary(id string) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if _, ok := k.aeads[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	k.primary = id
+	return nil
+}
+
+// get a key by ID.
+func (k *Keyring) get(id string) (cipher.AEAD, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return aead, nil
+}
+
+// primaryKey gets the primary key and its ID.
+func (k *Keyring) primaryKey() (string, cipher.AEAD) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	return k.primary, k.aeads[k.primary]
+}
@@ -0,0 +1,275 @@
+package invalidate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// maxMessageSize is the size of the buffer used to receive messages.
+// Messages are split by their encoded size, so that each fits in it.
+const maxMessageSize = 1 << 16
+
+// socketExt is the file extension of peer sockets.
+const socketExt = ".sock"
+
+// ErrMessageTooLarge is returned when a message cannot be published because a single ID is too long to fit in it.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// Bus broadcasts invalidation messages between peers on the same host.
+//
+// Each peer listens on a Unix datagram socket in a shared directory, and publishes messages by sending them to every other socket in that directory.
+// Peers can be in different processes or the same process.
+// Delivery is best-effort: messages are not retried, and a peer that is not listening when a message is published will not receive it.
+type Bus struct {
+	config *Config
+	conn   *net.UnixConn
+	name   string
+
+	closed   bool
+	handlers []func(m *Message)
+	mtx      sync.RWMutex
+}
+
+// Config for a Bus.
+type Config struct {
+	// Dir containing peer sockets. All peers that share storage must use the same directory.
+	Dir     string
+	DirMode os.FileMode
+	// OnError is called with errors encountered sending or receiving messages, if set.
+	OnError func(err error)
+}
+
+// Message describes entries that have changed in storage and should be invalidated by other peers.
+type Message struct {
+	// Origin is the name of the peer that published the message.
+	Origin string   `json:"origin"`
+	Op     Op       `json:"op"`
+	IDs    []string `json:"ids,omitempty"`
+}
+
+// Op describes the operation that caused an invalidation.
+type Op string
+
+// Invalidation operations.
+const (
+	Delete Op = "delete"
+	Expire Op = "expire"
+	Flush  Op = "flush"
+	Write  Op = "write"
+)
+
+// NewBus creates a Bus and starts listening for messages.
+func NewBus(c *Config) (*Bus, error) {
+	if err := os.MkdirAll(c.Dir, c.DirMode); err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%d-%s", os.Getpid(), hex.EncodeToString(suffix))
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{
+		Name: path.Join(c.Dir, name+socketExt),
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := &Bus{
+		config: c,
+		conn:   conn,
+		name:   name,
+
+		handlers: []func(m *Message){},
+	}
+	go b.listen()
+	return b, nil
+}
+
+// NewConfig creates a Bus configuration with sensible defaults.
+func NewConfig(dir string) *Config {
+	return &Config{
+		Dir:     dir,
+		DirMode: 0755,
+	}
+}
+
+// Close the bus.
+// The peer stops listening and its socket is removed.
+func (b *Bus) Close() error {
+	b.mtx.Lock()
+	b.closed = true
+	b.mtx.Unlock()
+	err := b.conn.Close()
+	if rmErr := os.Remove(b.socketPath(b.name)); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Handle messages received from other peers.
+func (b *Bus) Handle(fn func(m *Message)) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Name of the peer.
+func (b *Bus) Name() string {
+	return b.name
+}
+
+// Publish a message to all other peers.
+//
+// Sockets left behind by peers that stopped without closing their Bus are removed as they are encountered.
+// Other errors do not stop the message being sent to other peers, but only the last one is returned.
+func (b *Bus) Publish(op Op, ids ...string) error {
+	peers, err := b.peers()
+	if err != nil {
+		return err
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	messages, err := b.split(op, ids)
+	if err != nil {
+		return err
+	}
+	var errResult error
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if len(data) > maxMessageSize {
+			errResult = fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(data))
+			continue
+		}
+		for _, peer := range peers {
+			addr := &net.UnixAddr{Name: b.socketPath(peer), Net: "unixgram"}
+			if _, err := b.conn.WriteToUnix(data, addr); err != nil {
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					os.Remove(addr.Name)
+					continue
+				}
+				if errors.Is(err, syscall.ENOENT) {
+					continue
+				}
+				errResult = err
+			}
+		}
+	}
+	return errResult
+}
+
+// listen for messages until the bus is closed.
+func (b *Bus) listen() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := b.conn.ReadFromUnix(buf)
+		if err != nil {
+			b.mtx.RLock()
+			closed := b.closed
+			b.mtx.RUnlock()
+			if closed {
+				return
+			}
+			b.error(err)
+			continue
+		}
+		m := &Message{}
+		if err := json.Unmarshal(buf[:n], m); err != nil {
+			b.error(err)
+			continue
+		}
+		if m.Origin == b.name {
+			continue
+		}
+		b.mtx.RLock()
+		handlers := b.handlers
+		b.mtx.RUnlock()
+		for _, fn := range handlers {
+			fn(m)
+		}
+	}
+}
+
+// error reporting shorthand.
+func (b *Bus) error(err error) {
+	if b.config.OnError != nil {
+		b.config.OnError(err)
+	}
+}
+
+// peers gets the names of all other peers.
+func (b *Bus) peers() ([]string, error) {
+	files, err := ioutil.ReadDir(b.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	peers := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, socketExt) {
+			continue
+		}
+		name = strings.TrimSuffix(name, socketExt)
+		if name != b.name {
+			peers = append(peers, name)
+		}
+	}
+	return peers, nil
+}
+
+// socketPath gets the path of a peer's socket.
+func (b *Bus) socketPath(name string) string {
+	return path.Join(b.config.Dir, name+socketExt)
+}
+
+// split IDs into messages that each fit in the receive buffer once encoded.
+// An ID too long to fit in a message by itself is put in a message of its own, which cannot be delivered.
+func (b *Bus) split(op Op, ids []string) ([]*Message, error) {
+	// size of a message without IDs, less the quotes of a single empty ID
+	data, err := json.Marshal(&Message{Origin: b.name, Op: op, IDs: []string{""}})
+	if err != nil {
+		return nil, err
+	}
+	base := len(data) - 2
+
+	messages := []*Message{}
+	m := &Message{Origin: b.name, Op: op, IDs: []string{}}
+	size := base
+	for _, id := range ids {
+		data, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		n := len(data)
+		if len(m.IDs) > 0 {
+			// separating comma
+			n++
+			if size+n > maxMessageSize {
+				messages = append(messages, m)
+				m = &Message{Origin: b.name, Op: op, IDs: []string{}}
+				size = base
+				n--
+			}
+		}
+		m.IDs = append(m.IDs, id)
+		size += n
+	}
+	if len(m.IDs) > 0 || len(messages) == 0 {
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
@@ -0,0 +1,335 @@
+package invalidate
+
+import (
+	"context"
+	"io"
+
+	"github.com/edge/databank"
+)
+
+// reviewBatchSize is the number of entries read at once to find those that should be expired on review.
+const reviewBatchSize = 100
+
+// Driver is an invalidating implementation of databank.Driver.
+// It wraps another driver, publishing the IDs of entries changed through it to a Bus, and evicts local copies of entries changed by other peers.
+//
+// A typical setup gives each process a proxy.SyncDriver with its own in-memory driver in front of shared persistent storage.
+// Wrap the SyncDriver with a Driver, passing the in-memory driver as a local driver:
+//
+//   mem := atomic.New()
+//   d := invalidate.New(bus, proxy.NewSync(mem, disk), mem)
+//
+// When another peer changes an entry, it is deleted from mem, so that the next read falls through to the shared storage.
+//
+// Errors encountered publishing or evicting are not returned from driver operations, as the storage operation itself succeeded.
+// They are reported to the Bus's OnError function instead.
+type Driver struct {
+	bus   *Bus
+	local []databank.Driver
+	next  databank.Driver
+}
+
+// writer publishes an invalidation when it is closed and its entry is stored.
+type writer struct {
+	io.WriteCloser
+
+	closed bool
+	d      *Driver
+	e      *databank.Entry
+}
+
+// New invalidating Driver.
+// Entries changed by other peers are evicted from each local driver.
+func New(bus *Bus, next databank.Driver, local ...databank.Driver) *Driver {
+	d := &Driver{
+		bus:   bus,
+		local: local,
+		next:  next,
+	}
+	bus.Handle(d.evict)
+	return d
+}
+
+// Atomic reports whether the next driver applies transactions atomically.
+func (d *Driver) Atomic() bool {
+	return databank.Atomic(d.next)
+}
+
+// Cleanup all expired entries.
+// The IDs of entries deleted are published, as other peers may still hold unexpired copies of them.
+//
+// The entries deleted are found by comparing the IDs in storage before and after.
+func (d *Driver) Cleanup() (uint, bool, []error) {
+	before, _, err := d.next.Scan()
+	n, ok, errs := d.next.Cleanup()
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	if n == 0 {
+		return n, ok, errs
+	}
+	after, _, err := d.next.Scan()
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	remaining := map[string]bool{}
+	for _, id := range after {
+		remaining[id] = true
+	}
+	deleted := []string{}
+	for _, id := range before {
+		if !remaining[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	d.publish(Delete, deleted...)
+	return n, ok, errs
+}
+
+// Count total number of entries in storage.
+// Note that this includes expired entries.
+func (d *Driver) Count() (uint, bool, error) {
+	return d.next.Count()
+}
+
+// Create an entry whose content is written through the returned writer.
+// Its ID is published once the writer is closed and the entry is stored.
+func (d *Driver) Create(e *databank.Entry) (io.WriteCloser, error) {
+	w, err := databank.Create(d.next, e)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, d: d, e: e}, nil
+}
+
+// Delete an entry.
+func (d *Driver) Delete(id string) (bool, error) {
+	ok, err := d.next.Delete(id)
+	if ok && err == nil {
+		d.publish(Delete, id)
+	}
+	return ok, err
+}
+
+// DeleteMany deletes multiple entries.
+func (d *Driver) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results, errs := databank.DeleteMany(d.next, ids)
+	d.publish(Delete, succeeded(ids, results, errs)...)
+	return results, errs
+}
+
+// Expire an entry.
+func (d *Driver) Expire(id string) (bool, error) {
+	ok, err := d.next.Expire(id)
+	if ok && err == nil {
+		d.publish(Expire, id)
+	}
+	return ok, err
+}
+
+// Flush all entries.
+func (d *Driver) Flush() (bool, []error) {
+	ok, errs := d.next.Flush()
+	d.publish(Flush)
+	return ok, errs
+}
+
+// Has an ID, i.e. entry exists in storage?
+// Note that an expired entry still 'exists' until it is deleted or flushed out.
+func (d *Driver) Has(id string) (bool, error) {
+	return d.next.Has(id)
+}
+
+// OpenReader opens an entry for reading its content.
+func (d *Driver) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenReader(d.next, id)
+}
+
+// Read an entry from storage.
+func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
+	return d.next.Read(id)
+}
+
+// ReadMany reads multiple entries from storage.
+func (d *Driver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	return databank.ReadMany(d.next, ids)
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+func (d *Driver) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRange(d.next, id, offset, length)
+}
+
+// Review entries, automatically expiring them as necessary.
+// The IDs of entries expired are published, as other peers may not have reviewed their own copies yet, or may not expire them on read.
+//
+// The entries expired are found by reading every entry before and after, so Review is more costly than that of the next driver.
+// If the next driver is a proxy with an authority driver, such as proxy.SyncDriver, entries are read from the authority driver only, so that they are not written back into its other drivers.
+func (d *Driver) Review() (uint, bool, []error) {
+	candidates, err := d.expiring()
+	n, ok, errs := d.next.Review()
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	if n == 0 || len(candidates) == 0 {
+		return n, ok, errs
+	}
+	after, readErrs := databank.ReadMany(d.authority(), candidates)
+	for _, err := range readErrs {
+		errs = append(errs, err)
+	}
+	expired := []string{}
+	for _, id := range candidates {
+		if e, ok := after[id]; ok && e.Meta.Expired {
+			expired = append(expired, id)
+		}
+	}
+	d.publish(Expire, expired...)
+	return n, ok, errs
+}
+
+// Scan for IDs.
+func (d *Driver) Scan() ([]string, bool, error) {
+	return d.next.Scan()
+}
+
+// Search entries.
+func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	return d.next.Search(q)
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+func (d *Driver) Tagged(tag, value string) ([]string, bool, error) {
+	return databank.FindTagged(d.next, tag, value)
+}
+
+// Transact applies a set of operations.
+// Once the transaction is committed, all IDs it changed are published.
+func (d *Driver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	ok, err := databank.Transact(d.next, expect, ops)
+	if ok && err == nil {
+		ids := []string{}
+		for _, op := range ops {
+			ids = append(ids, op.ID)
+		}
+		d.publish(Write, ids...)
+	}
+	return ok, err
+}
+
+// WithContext creates a copy of the Driver with the context bound to the next driver.
+// The copy publishes to the same Bus, but does not handle messages itself, as the original already evicts local copies.
+func (d *Driver) WithContext(ctx context.Context) databank.Driver {
+	c := *d
+	c.next = databank.WithContext(ctx, d.next)
+	return &c
+}
+
+// Write an entry to storage.
+func (d *Driver) Write(e *databank.Entry) (bool, error) {
+	ok, err := d.next.Write(e)
+	if ok && err == nil {
+		d.publish(Write, e.ID())
+	}
+	return ok, err
+}
+
+// WriteMany writes multiple entries to storage.
+func (d *Driver) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID())
+	}
+	results, errs := databank.WriteMany(d.next, entries)
+	d.publish(Write, succeeded(ids, results, errs)...)
+	return results, errs
+}
+
+// evict local copies of entries changed by another peer.
+func (d *Driver) evict(m *Message) {
+	for _, local := range d.local {
+		if m.Op == Flush {
+			_, errs := local.Flush()
+			for _, err := range errs {
+				d.bus.error(err)
+			}
+			continue
+		}
+		_, errs := databank.DeleteMany(local, m.IDs)
+		for _, err := range errs {
+			d.bus.error(err)
+		}
+	}
+}
+
+// authority gets the driver that entries are reviewed in.
+// This is the authority driver of a proxy, or otherwise the next driver.
+func (d *Driver) authority() databank.Driver {
+	if p, ok := d.next.(interface{ Authority() databank.Driver }); ok {
+		return p.Authority()
+	}
+	return d.next
+}
+
+// expiring finds the IDs of entries that should be expired on review.
+// Entries are read in batches, so that the whole store is not held in memory at once.
+func (d *Driver) expiring() ([]string, error) {
+	authority := d.authority()
+	ids, _, err := authority.Scan()
+	if err != nil {
+		return nil, err
+	}
+	expiring := []string{}
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > reviewBatchSize {
+			batch = ids[:reviewBatchSize]
+		}
+		ids = ids[len(batch):]
+		entries, errs := databank.ReadMany(authority, batch)
+		for _, err := range errs {
+			return nil, err
+		}
+		for _, id := range batch {
+			if e, ok := entries[id]; ok && e.ShouldExpire() {
+				expiring = append(expiring, id)
+			}
+		}
+	}
+	return expiring, nil
+}
+
+// publish an invalidation.
+// Nothing is published for an empty list of IDs, unless the operation is a flush.
+func (d *Driver) publish(op Op, ids ...string) {
+	if len(ids) == 0 && op != Flush {
+		return
+	}
+	if err := d.bus.Publish(op, ids...); err != nil {
+		d.bus.error(err)
+	}
+}
+
+// Close the writer, publishing the entry's ID if it is stored.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	if err == nil {
+		w.d.publish(Write, w.e.ID())
+	}
+	return err
+}
+
+// succeeded filters IDs to those for which a batch operation succeeded.
+func succeeded(ids []string, results map[string]bool, errs map[string]error) []string {
+	ok := []string{}
+	for _, id := range ids {
+		if _, failed := errs[id]; results[id] && !failed {
+			ok = append(ok, id)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,238 @@
+package invalidate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/disk"
+	"github.com/edge/databank/pkg/proxy"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+type peer struct {
+	bus *Bus
+	db  databank.Databank
+	mem *atomicdb.Driver
+
+	// received counts messages received by the peer.
+	received int64
+}
+
+func newPeer(t *testing.T, busDir string, shared databank.Driver) *peer {
+	bus, err := NewBus(NewConfig(busDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bus.Close()
+	})
+	mem := atomicdb.New()
+	p := &peer{
+		bus: bus,
+		db:  databank.New(nil, New(bus, proxy.NewSync(mem, shared), mem)),
+		mem: mem,
+	}
+	bus.Handle(func(m *Message) {
+		atomic.AddInt64(&p.received, 1)
+	})
+	return p
+}
+
+// await a number of messages being received by a peer, or fail the test after a second.
+func (p *peer) await(t *testing.T, n int64) {
+	eventually(t, func() bool {
+		return atomic.LoadInt64(&p.received) >= n
+	})
+}
+
+// eventually waits for a condition to become true, or fails the test after a second.
+func eventually(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func Test_InvalidateDriver(t *testing.T) {
+	busDir := t.TempDir()
+	dt := tests.NewTester(func() databank.Driver {
+		return newPeer(t, busDir, atomicdb.New()).db.Driver()
+	})
+	dt.Run(t)
+}
+
+func Test_InvalidateDriver_Peers(t *testing.T) {
+	a := assert.New(t)
+	busDir := t.TempDir()
+	shared, err := disk.New(disk.NewConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1 := newPeer(t, busDir, shared)
+	p2 := newPeer(t, busDir, shared)
+	p3 := newPeer(t, busDir, shared)
+
+	p1.db.WriteString("key", "abc")
+	for _, p := range []*peer{p2, p3} {
+		p.await(t, 1)
+		v, _ := p.db.ReadString("key")
+		a.Equal("abc", v)
+		ok, _ := p.mem.Has("key")
+		a.Equal(true, ok)
+	}
+
+	// stale copies are evicted from other peers, but not the publisher
+	p1.db.WriteString("key", "def")
+	for _, p := range []*peer{p2, p3} {
+		p.await(t, 2)
+		ok, _ := p.mem.Has("key")
+		a.Equal(false, ok)
+		v, _ := p.db.ReadString("key")
+		a.Equal("def", v)
+	}
+	ok, _ := p1.mem.Has("key")
+	a.Equal(true, ok)
+
+	// closed peers receive nothing
+	p3.bus.Close()
+	p2.db.Delete("key")
+	p1.await(t, 1)
+	ok, _ = p1.mem.Has("key")
+	a.Equal(false, ok)
+	ok, _ = p3.mem.Has("key")
+	a.Equal(true, ok)
+
+	p1.db.WriteString("other", "ghi")
+	p2.await(t, 3)
+	p2.db.ReadString("other")
+	p1.db.Flush()
+	p2.await(t, 4)
+	n, _, _ := p2.mem.Count()
+	a.Equal(uint(0), n)
+}
+
+func Test_InvalidateDriver_Expiry(t *testing.T) {
+	a := assert.New(t)
+	busDir := t.TempDir()
+	shared := atomicdb.New()
+	p1 := newPeer(t, busDir, shared)
+	p2 := newPeer(t, busDir, shared)
+
+	// p2 holds a copy of each entry, which is not expired
+	for _, key := range []string{"cleanup", "review"} {
+		e := databank.NewEntry(key, time.Hour)
+		e.WriteString("abc")
+		shared.Write(e)
+		p2.mem.Write(e.Clone())
+	}
+	shared.Expire("cleanup")
+	other := databank.NewEntry("other", time.Hour)
+	other.WriteString("abc")
+	shared.Write(other)
+	e, _, _ := shared.Read("review")
+	e.Meta.Expires = e.Meta.Created.Add(-time.Second)
+	shared.Write(e)
+
+	n, _ := p1.db.Cleanup()
+	a.Equal(uint(1), n)
+	p2.await(t, 1)
+	ok, _ := p2.mem.Has("cleanup")
+	a.False(ok)
+
+	n, _ = p1.db.Review()
+	a.Equal(uint(1), n)
+	p2.await(t, 2)
+	ok, _ = p2.mem.Has("review")
+	a.False(ok)
+
+	// reviewing does not load unexpired entries into the local driver
+	ok, _ = p1.mem.Has("other")
+	a.False(ok)
+}
+
+func Test_InvalidateDriver_Stream(t *testing.T) {
+	a := assert.New(t)
+	busDir := t.TempDir()
+	shared := atomicdb.New()
+	p1 := newPeer(t, busDir, shared)
+	p2 := newPeer(t, busDir, shared)
+
+	p1.db.WriteString("key", "abc")
+	p2.await(t, 1)
+	p2.db.ReadString("key")
+
+	// streamed writes are published once stored
+	w := p1.db.Create("key")
+	w.Write([]byte("def"))
+	a.Nil(w.Close())
+	p2.await(t, 2)
+	ok, _ := p2.mem.Has("key")
+	a.False(ok)
+	r, ok := p2.db.OpenReader("key")
+	if a.True(ok) {
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		a.Equal("def", string(b))
+	}
+}
+
+func Test_Bus_LongIDs(t *testing.T) {
+	a := assert.New(t)
+	busDir := t.TempDir()
+	b1, err := NewBus(NewConfig(busDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b1.Close()
+	b2, err := NewBus(NewConfig(busDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+	var mtx sync.Mutex
+	received := map[string]bool{}
+	b2.Handle(func(m *Message) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, id := range m.IDs {
+			received[id] = true
+		}
+	})
+
+	// together, the IDs are far larger than a single message
+	ids := []string{}
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("%04d%s", i, strings.Repeat("<x>", 1000)))
+	}
+	messages, err := b1.split(Write, ids)
+	a.Nil(err)
+	a.Greater(len(messages), 1)
+	for _, m := range messages {
+		data, _ := json.Marshal(m)
+		a.LessOrEqual(len(data), maxMessageSize)
+	}
+
+	a.Nil(b1.Publish(Write, ids...))
+	eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(received) == len(ids)
+	})
+
+	// an ID that cannot fit in a message is not published
+	err = b1.Publish(Write, strings.Repeat("x", maxMessageSize))
+	a.True(errors.Is(err, ErrMessageTooLarge))
+}
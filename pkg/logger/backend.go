@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/edge/logger"
+)
+
+// Log levels.
+// Values match those of log/slog, so they can be converted directly.
+const (
+	Trace Level = -8
+	Debug Level = -4
+	Info  Level = 0
+	Warn  Level = 4
+	Error Level = 8
+)
+
+// Attr is a key-value pair attached to a Record.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// Backend outputs log records.
+// Implement it to log through something other than Edge logger, such as a log/slog handler.
+type Backend interface {
+	Log(r *Record)
+}
+
+// BackendFunc adapts an ordinary function to the Backend interface.
+type BackendFunc func(r *Record)
+
+// EdgeBackend outputs log records through Edge logger.
+// Attributes are converted to labels.
+//
+// See https://github.com/edge/logger for more information about Edge logger.
+type EdgeBackend struct {
+	l *logger.Instance
+}
+
+// Level of a Record.
+type Level int
+
+// Record is a single structured log record.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Context string
+	Message string
+	Attrs   []Attr
+}
+
+// NewEdgeBackend creates a Backend that outputs through an Edge logger instance.
+func NewEdgeBackend(l *logger.Instance) *EdgeBackend {
+	return &EdgeBackend{l}
+}
+
+// Log a record.
+func (f BackendFunc) Log(r *Record) {
+	f(r)
+}
+
+// Log a record.
+func (b *EdgeBackend) Log(r *Record) {
+	le := b.l.Context(r.Context)
+	for _, attr := range r.Attrs {
+		le.Label(attr.Key, fmt.Sprint(attr.Value))
+	}
+	le.Severity = r.Level.Severity()
+	le.Message = []interface{}{r.Message}
+	b.l.Log(le)
+}
+
+// Severity converts a level to the nearest Edge logger severity.
+func (l Level) Severity() logger.Severity {
+	switch {
+	case l >= Error:
+		return logger.Error
+	case l >= Warn:
+		return logger.Warn
+	case l >= Info:
+		return logger.Info
+	case l >= Debug:
+		return logger.Debug
+	default:
+		return logger.Trace
+	}
+}
+
+// levelFromSeverity converts an Edge logger severity to a level.
+func levelFromSeverity(s logger.Severity) Level {
+	switch s {
+	case logger.Fatal, logger.Error:
+		return Error
+	case logger.Warn:
+		return Warn
+	case logger.Info:
+		return Info
+	case logger.Debug:
+		return Debug
+	default:
+		return Trace
+	}
+}
@@ -1,125 +1,120 @@
 package logger
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/edge/databank"
 	"github.com/edge/logger"
 )
 
+// Config for a logging Middleware.
+type Config struct {
+	// Context name of all records.
+	Context string
+	// Level of records for operations that complete without error.
+	// Errors are always logged at Error level, and slow operations at Warn level.
+	Level Level
+	// Redact transforms IDs before they are logged, e.g. to avoid logging sensitive keys.
+	// If nil, IDs are logged as-is. See HashID and RedactID.
+	Redact func(id string) string
+	// SampleRate logs only 1 in every N hits, i.e. Has, OpenReader, Read, ReadMany and ReadRange operations that find every entry requested.
+	// All other operations, including misses, errors and slow operations, are always logged.
+	// If 0 or 1, all hits are logged.
+	SampleRate uint64
+	// SlowThreshold is the latency at or above which an operation is considered slow.
+	// If 0, no operations are considered slow.
+	SlowThreshold time.Duration
+}
+
 // Middleware is a logging middleware that wraps another driver.
-// This performs simple activity logging, typically to stdout/stderr.
+// This performs structured activity logging, with optional sampling, slow operation reporting and ID redaction.
 //
+// Records include the operation, latency, and where relevant the ID and entry size or number of entries.
+// Edge logger is used by default, but any Backend can be provided.
 // See https://github.com/edge/logger for more information about Edge logger.
 type Middleware struct {
-	l    *logger.Instance
-	next databank.Driver
-
-	context  string
-	severity logger.Severity
-}
+	*databank.Intercepted
 
-// NewMiddleware creates a new logging Middleware.
-// It must be preconfigured with a context name and severity.
-// INFO, DEBUG or TRACE is suggested, depending on your requirements.
-// This context and severity will be used for all logs except errors, for which ERROR severity is forced.
-func NewMiddleware(c string, s logger.Severity, l *logger.Instance, next databank.Driver) *Middleware {
-	return &Middleware{
-		l:    l,
-		next: next,
+	backend Backend
+	config  *Config
 
-		context:  c,
-		severity: s,
-	}
-}
-
-// Cleanup logs a cleanup operation.
-func (d *Middleware) Cleanup() (uint, bool, []error) {
-	n, ok, errs := d.next.Cleanup()
-	le := d.l.Context(d.context).Label("operation", "cleanup")
-	d.log(le, d.flatten(errs), ok, fmt.Sprintf("%d entries deleted", n), "cleanup fail")
-	return n, ok, errs
+	// sampled counts hits, which are eligible for sampling.
+	sampled *uint64
 }
 
-// Count logs a count operation.
-func (d *Middleware) Count() (uint, bool, error) {
-	n, ok, err := d.next.Count()
-	le := d.l.Context(d.context).Label("operation", "count")
-	d.log(le, err, ok, fmt.Sprintf("counted %d entries", n), "count fail")
-	return n, ok, err
-}
+// writer logs a streamed write when it is closed.
+type writer struct {
+	io.WriteCloser
 
-// Delete logs a delete operation.
-func (d *Middleware) Delete(id string) (bool, error) {
-	ok, err := d.next.Delete(id)
-	le := d.l.Context(d.context).Label("operation", "delete").Label("id", id)
-	d.log(le, err, ok, "ok", "delete fail")
-	return ok, err
+	closed bool
+	d      *Middleware
+	e      *databank.Entry
+	start  time.Time
 }
 
-// Expire logs an expire operation.
-func (d *Middleware) Expire(id string) (bool, error) {
-	ok, err := d.next.Expire(id)
-	le := d.l.Context(d.context).Label("operation", "expire").Label("id", id)
-	d.log(le, err, ok, "ok", "expire fail")
-	return ok, err
+// HashID creates a redaction function that replaces IDs with a salted hash.
+// Records concerning the same ID can still be correlated, without revealing it.
+func HashID(salt string) func(id string) string {
+	return func(id string) string {
+		sum := sha256.Sum256([]byte(salt + id))
+		return fmt.Sprintf("%x", sum[:8])
+	}
 }
 
-// Flush logs a flush operation.
-func (d *Middleware) Flush() (bool, []error) {
-	ok, errs := d.next.Flush()
-	le := d.l.Context(d.context).Label("operation", "flush")
-	d.log(le, d.flatten(errs), ok, "flushed", "flush fail")
-	return ok, errs
+// RedactID is a redaction function that removes IDs entirely.
+func RedactID(id string) string {
+	return "[redacted]"
 }
 
-// Has logs a has operation.
-func (d *Middleware) Has(id string) (bool, error) {
-	ok, err := d.next.Has(id)
-	le := d.l.Context(d.context).Label("operation", "has").Label("id", id)
-	d.log(le, err, ok, "hit", "miss")
-	return ok, err
-}
+// New creates a new logging Middleware with any backend.
+func New(c *Config, b Backend, next databank.Driver) *Middleware {
+	d := &Middleware{
+		backend: b,
+		config:  c,
 
-// Read logs a read operation.
-func (d *Middleware) Read(id string) (*databank.Entry, bool, error) {
-	e, ok, err := d.next.Read(id)
-	le := d.l.Context(d.context).Label("operation", "read").Label("id", id)
-	d.log(le, err, ok, "hit", "miss")
-	return e, ok, err
-}
-
-// Review logs a review operation.
-func (d *Middleware) Review() (uint, bool, []error) {
-	n, ok, errs := d.next.Review()
-	le := d.l.Context(d.context).Label("operation", "review")
-	d.log(le, d.flatten(errs), ok, fmt.Sprintf("%d entries expired", n), "review fail")
-	return n, ok, errs
+		sampled: new(uint64),
+	}
+	d.Intercepted = databank.Intercept(next, d.intercept)
+	return d
 }
 
-// Scan logs a scan operation.
-func (d *Middleware) Scan() ([]string, bool, error) {
-	ids, ok, err := d.next.Scan()
-	le := d.l.Context(d.context).Label("operation", "scan")
-	d.log(le, err, ok, fmt.Sprintf("%d entries found", len(ids)), "scan fail")
-	return ids, ok, err
+// NewConfig creates a logging Middleware configuration with sensible defaults.
+// All operations are logged at INFO level.
+func NewConfig(c string) *Config {
+	return &Config{
+		Context:    c,
+		Level:      Info,
+		SampleRate: 1,
+	}
 }
 
-// Search logs a search operation.
-func (d *Middleware) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
-	entries, ok, err := d.next.Search(q)
-	le := d.l.Context(d.context).Label("operation", "search")
-	d.log(le, err, ok, fmt.Sprintf("%d entries found", len(entries)), "scan fail")
-	return entries, ok, err
+// NewMiddleware creates a new logging Middleware that outputs through Edge logger.
+// It must be preconfigured with a context name and severity.
+// INFO, DEBUG or TRACE is suggested, depending on your requirements.
+// This context and severity will be used for all logs except errors, for which ERROR severity is forced.
+//
+// Use New for more options.
+func NewMiddleware(c string, s logger.Severity, l *logger.Instance, next databank.Driver) *Middleware {
+	config := NewConfig(c)
+	config.Level = levelFromSeverity(s)
+	return New(config, NewEdgeBackend(l), next)
 }
 
-// Write logs a write operation.
-func (d *Middleware) Write(e *databank.Entry) (bool, error) {
-	ok, err := d.next.Write(e)
-	le := d.l.Context(d.context).Label("operation", "write").Label("id", e.ID())
-	d.log(le, err, ok, "ok", "write fail")
-	return ok, err
+// err gets the error of an operation's result, whichever form it takes.
+// Multiple errors are flattened into one.
+func (d *Middleware) err(r *databank.Result) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if len(r.ErrMap) > 0 {
+		return d.flattenMap(r.ErrMap)
+	}
+	return d.flatten(r.Errs)
 }
 
 // flatten an array of errors into one, while keeping all their messages in the original sequence.
@@ -134,18 +129,176 @@ func (d *Middleware) flatten(errs []error) error {
 	return fmt.Errorf("%d errors: %s", len(strs), strings.Join(strs, "; "))
 }
 
-// log an entry. Simple convenience method.
-func (d *Middleware) log(le *logger.Entry, err error, ok bool, okText string, failText string) {
-	if err != nil {
-		le.Severity = logger.Error
-		le.Message = []interface{}{fmt.Sprint(err)}
+// flattenMap flattens a map of errors by ID into one.
+// IDs are redacted as configured.
+func (d *Middleware) flattenMap(errs map[string]error) error {
+	list := []error{}
+	for id, err := range errs {
+		list = append(list, fmt.Errorf("%s: %s", d.id(id).Value, err))
+	}
+	return d.flatten(list)
+}
+
+// id attribute, redacted as configured.
+func (d *Middleware) id(id string) Attr {
+	if d.config.Redact != nil {
+		id = d.config.Redact(id)
+	}
+	return Attr{"id", id}
+}
+
+// intercept logs an operation.
+//
+// Streamed writes are logged when the returned writer is closed, so their latency includes the time taken to write content.
+// Streamed reads are logged once the entry is open, so their latency does not include the time taken to read content.
+func (d *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	start := time.Now()
+	r := next(c)
+	err := d.err(r)
+	ok := r.OK
+	okText, failText := "ok", fmt.Sprintf("%s fail", c.Op)
+	attrs := []Attr{}
+	if c.ID != "" {
+		attrs = append(attrs, d.id(c.ID))
+	} else if c.Entry != nil {
+		attrs = append(attrs, d.id(c.Entry.ID()))
+	}
+
+	switch c.Op {
+	case databank.OpCleanup:
+		okText = fmt.Sprintf("%d entries deleted", r.N)
+		attrs = append(attrs, Attr{"n", r.N})
+	case databank.OpCount:
+		okText = fmt.Sprintf("counted %d entries", r.N)
+		attrs = append(attrs, Attr{"n", r.N})
+	case databank.OpCreate:
+		if err == nil {
+			r.Writer = &writer{WriteCloser: r.Writer, d: d, e: c.Entry, start: start}
+			return r
+		}
+	case databank.OpDeleteMany:
+		n := succeeded(c.IDs, r.Results, r.ErrMap)
+		ok = n == len(c.IDs)
+		okText = fmt.Sprintf("%d entries deleted", n)
+		failText = fmt.Sprintf("%d of %d entries deleted", n, len(c.IDs))
+		attrs = append(attrs, Attr{"n", len(c.IDs)})
+	case databank.OpFlush:
+		okText = "flushed"
+	case databank.OpHas:
+		okText, failText = "hit", "miss"
+	case databank.OpOpenReader, databank.OpRead:
+		okText, failText = "hit", "miss"
+		if r.OK && r.Entry != nil {
+			attrs = append(attrs, Attr{"size", r.Entry.Size})
+		}
+	case databank.OpReadMany:
+		size := 0
+		for _, e := range r.Entries {
+			size += e.Size
+		}
+		ok = len(r.Entries) == len(c.IDs)
+		okText = fmt.Sprintf("%d of %d entries found", len(r.Entries), len(c.IDs))
+		failText = okText
+		attrs = append(attrs, Attr{"n", len(c.IDs)}, Attr{"size", size})
+	case databank.OpReadRange:
+		okText, failText = "hit", "miss"
+		attrs = append(attrs, Attr{"offset", c.Offset}, Attr{"size", len(r.Content)})
+	case databank.OpReview:
+		okText = fmt.Sprintf("%d entries expired", r.N)
+		attrs = append(attrs, Attr{"n", r.N})
+	case databank.OpScan, databank.OpTagged:
+		okText = fmt.Sprintf("%d entries found", len(r.IDs))
+		attrs = append(attrs, Attr{"n", len(r.IDs)})
+	case databank.OpSearch:
+		okText = fmt.Sprintf("%d entries found", len(r.Entries))
+		attrs = append(attrs, Attr{"n", len(r.Entries)})
+	case databank.OpTransact:
+		okText = "committed"
+		attrs = append(attrs, Attr{"n", len(c.TxOps)})
+	case databank.OpWrite:
+		attrs = append(attrs, Attr{"size", c.Entry.Size})
+	case databank.OpWriteMany:
+		ids := []string{}
+		size := 0
+		for _, e := range c.Entries {
+			id := e.ID()
+			ids = append(ids, id)
+			if _, failed := r.ErrMap[id]; r.Results[id] && !failed {
+				size += e.Size
+			}
+		}
+		n := succeeded(ids, r.Results, r.ErrMap)
+		ok = n == len(ids)
+		okText = fmt.Sprintf("%d entries written", n)
+		failText = fmt.Sprintf("%d of %d entries written", n, len(ids))
+		attrs = append(attrs, Attr{"n", len(ids)}, Attr{"size", size})
+	}
+	d.log(c.Op, start, err, ok, okText, failText, attrs...)
+	return r
+}
+
+// log an operation.
+// Hits are sampled as configured; all other operations are always logged.
+func (d *Middleware) log(op databank.Op, start time.Time, err error, ok bool, okText string, failText string, attrs ...Attr) {
+	latency := time.Since(start)
+	r := &Record{
+		Time:    time.Now(),
+		Level:   d.config.Level,
+		Context: d.config.Context,
+		Attrs:   append([]Attr{{"operation", string(op)}}, attrs...),
+	}
+	r.Attrs = append(r.Attrs, Attr{"latency", latency})
+
+	if ok {
+		r.Message = okText
 	} else {
-		le.Severity = d.severity
-		if ok {
-			le.Message = []interface{}{okText}
-		} else {
-			le.Message = []interface{}{failText}
+		r.Message = failText
+	}
+	if err != nil {
+		r.Level = Error
+		r.Message = fmt.Sprint(err)
+	} else if d.config.SlowThreshold > 0 && latency >= d.config.SlowThreshold {
+		r.Level = Warn
+		r.Attrs = append(r.Attrs, Attr{"slow", true})
+	} else if ok && sampled(op) && !d.sample() {
+		return
+	}
+	d.backend.Log(r)
+}
+
+// sample a hit, returning true if it should be logged.
+func (d *Middleware) sample() bool {
+	rate := d.config.SampleRate
+	if rate <= 1 {
+		return true
+	}
+	n := atomic.AddUint64(d.sampled, 1)
+	return (n-1)%rate == 0
+}
+
+// Close the writer and log the write.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	w.d.log(databank.OpCreate, w.start, err, true, "ok", "create fail", w.d.id(w.e.ID()), Attr{"size", w.e.Size})
+	return err
+}
+
+// sampled checks whether an operation is sampled when it hits.
+func sampled(op databank.Op) bool {
+	return op == databank.OpHas || op == databank.OpOpenReader || op == databank.OpRead || op == databank.OpReadMany || op == databank.OpReadRange
+}
+
+// succeeded counts the IDs for which a batch operation succeeded.
+func succeeded(ids []string, results map[string]bool, errs map[string]error) int {
+	n := 0
+	for _, id := range ids {
+		if _, failed := errs[id]; results[id] && !failed {
+			n++
 		}
 	}
-	d.l.Log(le)
+	return n
 }
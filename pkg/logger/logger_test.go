@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// capture collects records for inspection.
+type capture struct {
+	mtx     sync.Mutex
+	records []*Record
+}
+
+// failDriver fails every read.
+type failDriver struct {
+	databank.Driver
+}
+
+// slowDriver delays every read.
+type slowDriver struct {
+	databank.Driver
+	delay time.Duration
+}
+
+func (c *capture) Log(r *Record) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.records = append(c.records, r)
+}
+
+func (c *capture) Records() []*Record {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]*Record{}, c.records...)
+}
+
+func (d *failDriver) Read(id string) (*databank.Entry, bool, error) {
+	return nil, false, errors.New("read failed")
+}
+
+func (d *slowDriver) Read(id string) (*databank.Entry, bool, error) {
+	time.Sleep(d.delay)
+	return d.Driver.Read(id)
+}
+
+func attr(r *Record, key string) (interface{}, bool) {
+	for _, a := range r.Attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+func Test_LoggerMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return New(NewConfig("test"), &capture{}, atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_LoggerMiddleware_Attrs(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	db := databank.New(nil, New(NewConfig("test"), c, atomicdb.New()))
+
+	db.WriteString("key", "abc")
+	db.ReadString("key")
+
+	records := c.Records()
+	a.Len(records, 2)
+	for _, r := range records {
+		a.Equal("test", r.Context)
+		a.Equal(Info, r.Level)
+		_, ok := attr(r, "latency")
+		a.True(ok)
+		size, ok := attr(r, "size")
+		a.True(ok)
+		a.Equal(3, size)
+	}
+	op, _ := attr(records[1], "operation")
+	a.Equal("read", op)
+	a.Equal("hit", records[1].Message)
+}
+
+func Test_LoggerMiddleware_Redact(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	config := NewConfig("test")
+	config.Redact = HashID("salt")
+	db := databank.New(nil, New(config, c, atomicdb.New()))
+
+	db.WriteString("secret", "abc")
+	db.ReadString("secret")
+
+	records := c.Records()
+	a.Len(records, 2)
+	id1, _ := attr(records[0], "id")
+	id2, _ := attr(records[1], "id")
+	a.NotEqual("secret", id1)
+	a.Equal(id1, id2)
+
+	config.Redact = RedactID
+	db.ReadString("secret")
+	id3, _ := attr(c.Records()[2], "id")
+	a.Equal("[redacted]", id3)
+}
+
+func Test_LoggerMiddleware_Sample(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	config := NewConfig("test")
+	config.SampleRate = 10
+	db := databank.New(nil, New(config, c, atomicdb.New()))
+
+	db.WriteString("key", "abc")
+	for i := 0; i < 100; i++ {
+		db.Has("key")
+	}
+	a.Len(c.Records(), 11)
+
+	// misses and writes are always logged
+	for i := 0; i < 5; i++ {
+		db.Has("missing")
+		db.WriteString("key", "abc")
+	}
+	a.Len(c.Records(), 21)
+
+	// errors are always logged
+	c = &capture{}
+	db = databank.New(nil, New(config, c, &failDriver{atomicdb.New()}))
+	for i := 0; i < 5; i++ {
+		db.ReadString("key")
+	}
+	records := c.Records()
+	a.Len(records, 5)
+	for _, r := range records {
+		a.Equal(Error, r.Level)
+		a.Equal("read failed", r.Message)
+	}
+}
+
+func Test_LoggerMiddleware_Batch(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	config := NewConfig("test")
+	config.SampleRate = 1000
+	db := databank.New(nil, New(config, c, atomicdb.New()))
+
+	db.WriteMany([]*databank.Entry{db.NewEntry("a"), db.NewEntry("b")})
+	db.ReadMany([]string{"a", "b"})
+	db.ReadMany([]string{"a", "b"})
+	db.ReadMany([]string{"a", "c"})
+	db.DeleteMany([]string{"a", "b"})
+
+	// only full reads are sampled
+	records := c.Records()
+	a.Len(records, 4)
+	a.Equal("2 entries written", records[0].Message)
+	a.Equal("2 of 2 entries found", records[1].Message)
+	a.Equal("1 of 2 entries found", records[2].Message)
+	a.Equal("2 entries deleted", records[3].Message)
+
+	c = &capture{}
+	db = databank.New(nil, New(config, c, &failDriver{atomicdb.New()}))
+	db.WriteMany([]*databank.Entry{db.NewEntry("a")})
+	db.ReadMany([]string{"a"})
+	records = c.Records()
+	a.Len(records, 2)
+	a.Equal(Error, records[1].Level)
+}
+
+func Test_LoggerMiddleware_Slow(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	config := NewConfig("test")
+	config.SampleRate = 1000
+	config.SlowThreshold = 10 * time.Millisecond
+	db := databank.New(nil, New(config, c, &slowDriver{atomicdb.New(), 20 * time.Millisecond}))
+
+	db.ReadString("a")
+	db.ReadString("b")
+
+	records := c.Records()
+	a.Len(records, 2)
+	for _, r := range records {
+		a.Equal(Warn, r.Level)
+		slow, _ := attr(r, "slow")
+		a.Equal(true, slow)
+	}
+}
+
+func Test_LoggerMiddleware_Stream(t *testing.T) {
+	a := assert.New(t)
+	c := &capture{}
+	db := databank.New(nil, New(NewConfig("test"), c, atomicdb.New()))
+
+	w := db.Create("key")
+	w.Write([]byte("abc"))
+	a.Len(c.Records(), 0)
+	a.Nil(w.Close())
+	r, ok := db.OpenReader("key")
+	a.True(ok)
+	r.Close()
+
+	records := c.Records()
+	if a.Len(records, 2) {
+		ops := []interface{}{}
+		for _, r := range records {
+			op, _ := attr(r, "operation")
+			ops = append(ops, op)
+			size, _ := attr(r, "size")
+			a.Equal(3, size)
+		}
+		a.Equal([]interface{}{"create", "openReader"}, ops)
+		a.Equal("ok", records[0].Message)
+		a.Equal("hit", records[1].Message)
+	}
+}
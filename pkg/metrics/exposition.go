@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/edge/databank"
+)
+
+// contentType of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values in the Prometheus text exposition format.
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// Handler exposes metrics from any number of middlewares in Prometheus text exposition format.
+func Handler(ms ...*Middleware) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		WriteText(w, ms...)
+	})
+}
+
+// WriteText writes metrics from any number of middlewares in Prometheus text exposition format.
+//
+// Latency histograms are only written for operations that have been recorded at least once.
+func WriteText(w io.Writer, ms ...*Middleware) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# HELP databank_operations_total Number of driver operations by type and outcome.")
+	fmt.Fprintln(bw, "# TYPE databank_operations_total counter")
+	for _, m := range ms {
+		for _, op := range databank.Ops {
+			for _, o := range outcomes {
+				if n := m.Counter(op, o); n > 0 {
+					labels := m.labels("op", string(op), "outcome", string(o))
+					fmt.Fprintf(bw, "databank_operations_total%s %d\n", labels, n)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintln(bw, "# HELP databank_operation_duration_seconds Latency of driver operations.")
+	fmt.Fprintln(bw, "# TYPE databank_operation_duration_seconds histogram")
+	for _, m := range ms {
+		for _, op := range databank.Ops {
+			s := m.ops[op].latency.snapshot()
+			if s.count > 0 {
+				m.writeHistogram(bw, "databank_operation_duration_seconds", s, "op", string(op))
+			}
+		}
+	}
+
+	fmt.Fprintln(bw, "# HELP databank_entry_size_bytes Size of entries read and written.")
+	fmt.Fprintln(bw, "# TYPE databank_entry_size_bytes histogram")
+	for _, m := range ms {
+		for _, op := range []databank.Op{databank.OpRead, databank.OpWrite} {
+			m.writeHistogram(bw, "databank_entry_size_bytes", m.sizes[op].snapshot(), "op", string(op))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// labels formats the middleware's configured labels, followed by additional label pairs.
+func (m *Middleware) labels(pairs ...string) string {
+	keys := []string{}
+	for k := range m.config.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ll := []string{}
+	for _, k := range keys {
+		ll = append(ll, fmt.Sprintf("%s=\"%s\"", k, labelEscaper.Replace(m.config.Labels[k])))
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		ll = append(ll, fmt.Sprintf("%s=\"%s\"", pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	if len(ll) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("{%s}", strings.Join(ll, ","))
+}
+
+// writeHistogram writes the buckets, sum and count of a histogram.
+func (m *Middleware) writeHistogram(w io.Writer, name string, s *histogramSnapshot, pairs ...string) {
+	for i, le := range s.buckets {
+		labels := m.labels(append(pairs, "le", formatFloat(le))...)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels, s.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, m.labels(append(pairs, "le", "+Inf")...), s.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, m.labels(pairs...), formatFloat(s.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, m.labels(pairs...), s.count)
+}
+
+// formatFloat formats a float in the Prometheus text exposition format.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// histogram of observed values, with cumulative buckets as in Prometheus.
+type histogram struct {
+	buckets []float64
+
+	counts []uint64
+	count  uint64
+	mtx    sync.Mutex
+	sum    float64
+}
+
+// histogramSnapshot is a consistent copy of a histogram's state.
+type histogramSnapshot struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe a value.
+func (h *histogram) observe(v float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// snapshot the histogram.
+func (h *histogram) snapshot() *histogramSnapshot {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return &histogramSnapshot{
+		buckets: h.buckets,
+		counts:  append([]uint64{}, h.counts...),
+		count:   h.count,
+		sum:     h.sum,
+	}
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Operation outcomes.
+const (
+	// Error raised by the driver.
+	Error Outcome = "error"
+	// Fail without error.
+	Fail Outcome = "fail"
+	// Hit when reading or checking an entry.
+	Hit Outcome = "hit"
+	// Miss when reading or checking an entry.
+	Miss Outcome = "miss"
+	// OK success.
+	OK Outcome = "ok"
+)
+
+// DefaultLatencyBuckets are the default upper bounds of operation latency buckets, in seconds.
+var DefaultLatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// DefaultSizeBuckets are the default upper bounds of entry size buckets, in bytes.
+var DefaultSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// outcomes lists all outcomes, in exposition order.
+var outcomes = []Outcome{Error, Fail, Hit, Miss, OK}
+
+// Config for a metrics Middleware.
+type Config struct {
+	// Labels are added to all metrics.
+	// Use them to distinguish multiple middlewares exposed through the same handler, e.g. {"tier": "memory"}.
+	Labels map[string]string
+	// LatencyBuckets are the upper bounds of operation latency buckets, in seconds.
+	LatencyBuckets []float64
+	// SizeBuckets are the upper bounds of entry size buckets, in bytes.
+	SizeBuckets []float64
+}
+
+// Middleware is a metrics middleware that wraps another driver.
+// It counts operations by type and outcome, and records distributions of operation latency and entry size.
+//
+// Metrics can be exposed in Prometheus text format using Handler.
+type Middleware struct {
+	*databank.Intercepted
+
+	config *Config
+
+	ops   map[databank.Op]*opMetrics
+	sizes map[databank.Op]*histogram
+}
+
+// Outcome of an operation.
+type Outcome string
+
+// opMetrics are the metrics recorded for a single operation.
+type opMetrics struct {
+	counts  map[Outcome]*uint64
+	latency *histogram
+}
+
+// writer records a streamed write when it is closed.
+type writer struct {
+	io.WriteCloser
+
+	closed bool
+	e      *databank.Entry
+	m      *Middleware
+	start  time.Time
+}
+
+// NewConfig creates a metrics Middleware configuration with sensible defaults.
+func NewConfig() *Config {
+	return &Config{
+		Labels:         map[string]string{},
+		LatencyBuckets: DefaultLatencyBuckets,
+		SizeBuckets:    DefaultSizeBuckets,
+	}
+}
+
+// NewMiddleware creates a new metrics Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		config: c,
+
+		ops: map[databank.Op]*opMetrics{},
+		sizes: map[databank.Op]*histogram{
+			databank.OpRead:  newHistogram(c.SizeBuckets),
+			databank.OpWrite: newHistogram(c.SizeBuckets),
+		},
+	}
+	for _, op := range databank.Ops {
+		om := &opMetrics{
+			counts:  map[Outcome]*uint64{},
+			latency: newHistogram(c.LatencyBuckets),
+		}
+		for _, o := range outcomes {
+			om.counts[o] = new(uint64)
+		}
+		m.ops[op] = om
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// Counter gets the number of operations recorded with an outcome.
+func (m *Middleware) Counter(op databank.Op, o Outcome) uint64 {
+	if om, ok := m.ops[op]; ok {
+		if c, ok := om.counts[o]; ok {
+			return atomic.LoadUint64(c)
+		}
+	}
+	return 0
+}
+
+// HitRatio gets the proportion of lookups that were hits for an operation, such as databank.OpRead.
+// If there have been no hits or misses, the ratio is 0.
+func (m *Middleware) HitRatio(op databank.Op) float64 {
+	hits := m.Counter(op, Hit)
+	total := hits + m.Counter(op, Miss)
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// intercept records an operation.
+//
+// Streamed writes are recorded when the returned writer is closed, so their latency includes the time taken to write content.
+// Streamed reads are recorded once the entry is open, so their latency does not include the time taken to read content.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	start := time.Now()
+	r := next(c)
+	if c.Op == databank.OpCreate && r.Err == nil {
+		r.Writer = &writer{WriteCloser: r.Writer, e: c.Entry, m: m, start: start}
+		return r
+	}
+	m.record(c.Op, start, outcome(c.Op, r))
+	m.observe(c, r)
+	return r
+}
+
+// observe the sizes of entries read or written by an operation.
+// For ranged reads, the size observed is that of the range read, not of the entry.
+func (m *Middleware) observe(c *databank.Call, r *databank.Result) {
+	if len(r.Errors()) > 0 {
+		return
+	}
+	switch c.Op {
+	case databank.OpOpenReader, databank.OpRead:
+		if r.OK && r.Entry != nil {
+			m.sizes[databank.OpRead].observe(float64(r.Entry.Size))
+		}
+	case databank.OpReadMany:
+		for _, e := range r.Entries {
+			m.sizes[databank.OpRead].observe(float64(e.Size))
+		}
+	case databank.OpReadRange:
+		if r.OK {
+			m.sizes[databank.OpRead].observe(float64(len(r.Content)))
+		}
+	case databank.OpTransact:
+		if r.OK {
+			for _, op := range c.TxOps {
+				if op.Entry != nil {
+					m.sizes[databank.OpWrite].observe(float64(op.Entry.Size))
+				}
+			}
+		}
+	case databank.OpWrite:
+		if r.OK {
+			m.sizes[databank.OpWrite].observe(float64(c.Entry.Size))
+		}
+	case databank.OpWriteMany:
+		for _, e := range c.Entries {
+			if r.Results[e.ID()] {
+				m.sizes[databank.OpWrite].observe(float64(e.Size))
+			}
+		}
+	}
+}
+
+// record an operation.
+func (m *Middleware) record(op databank.Op, start time.Time, o Outcome) {
+	om, ok := m.ops[op]
+	if !ok {
+		return
+	}
+	atomic.AddUint64(om.counts[o], 1)
+	om.latency.observe(time.Since(start).Seconds())
+}
+
+// Close the writer and record the write.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	w.m.record(databank.OpCreate, w.start, outcome(databank.OpCreate, &databank.Result{OK: true, Err: err}))
+	if err == nil {
+		w.m.sizes[databank.OpWrite].observe(float64(w.e.Size))
+	}
+	return err
+}
+
+// outcome gets the outcome of an operation.
+// Lookups are hits or misses, and batch operations are OK unless they raise an error; individual failures without error are not considered.
+func outcome(op databank.Op, r *databank.Result) Outcome {
+	if len(r.Errors()) > 0 {
+		return Error
+	}
+	switch op {
+	case databank.OpHas, databank.OpOpenReader, databank.OpRead, databank.OpReadRange:
+		if r.OK {
+			return Hit
+		}
+		return Miss
+	case databank.OpDeleteMany, databank.OpReadMany, databank.OpWriteMany:
+		return OK
+	}
+	if r.OK {
+		return OK
+	}
+	return Fail
+}
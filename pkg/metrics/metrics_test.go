@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MetricsMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware(NewConfig(), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_MetricsMiddleware_Handler(t *testing.T) {
+	a := assert.New(t)
+	c := NewConfig()
+	c.Labels["tier"] = "memory"
+	m := NewMiddleware(c, atomicdb.New())
+	db := databank.New(nil, m)
+
+	db.WriteString("abc", "hello")
+	db.ReadString("abc")
+	db.ReadString("abc")
+	db.ReadString("def")
+	a.Equal(uint64(2), m.Counter(databank.OpRead, Hit))
+	a.Equal(uint64(1), m.Counter(databank.OpRead, Miss))
+	a.InDelta(2.0/3.0, m.HitRatio(databank.OpRead), 0.0001)
+
+	// streamed writes are recorded when closed
+	w := db.Create("streamed")
+	w.Write([]byte("hello"))
+	a.Equal(uint64(0), m.Counter(databank.OpCreate, OK))
+	a.Nil(w.Close())
+	a.Equal(uint64(1), m.Counter(databank.OpCreate, OK))
+	r, ok := db.OpenReader("streamed")
+	a.True(ok)
+	r.Close()
+	a.Equal(uint64(1), m.Counter(databank.OpOpenReader, Hit))
+
+	rec := httptest.NewRecorder()
+	Handler(m).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	a.Equal(contentType, rec.Header().Get("Content-Type"))
+	b, _ := ioutil.ReadAll(rec.Body)
+	lines := strings.Split(string(b), "\n")
+	for _, expected := range []string{
+		"# TYPE databank_operations_total counter",
+		`databank_operations_total{tier="memory",op="read",outcome="hit"} 2`,
+		`databank_operations_total{tier="memory",op="read",outcome="miss"} 1`,
+		`databank_operations_total{tier="memory",op="write",outcome="ok"} 1`,
+		"# TYPE databank_operation_duration_seconds histogram",
+		`databank_operation_duration_seconds_bucket{tier="memory",op="read",le="+Inf"} 3`,
+		`databank_operation_duration_seconds_count{tier="memory",op="read"} 3`,
+		"# TYPE databank_entry_size_bytes histogram",
+		`databank_entry_size_bytes_bucket{tier="memory",op="read",le="64"} 3`,
+		`databank_entry_size_bytes_sum{tier="memory",op="read"} 15`,
+		`databank_entry_size_bytes_count{tier="memory",op="write"} 2`,
+	} {
+		a.Contains(lines, expected)
+	}
+	for _, line := range lines {
+		a.NotContains(line, `op="scan"`)
+	}
+}
@@ -0,0 +1,255 @@
+package namespace
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/edge/databank"
+)
+
+// Driver is a namespacing implementation of databank.Driver.
+// It wraps another driver, transparently prefixing IDs so that multiple namespaces can share the same storage without conflict.
+//
+// The prefix is always joined to IDs with Separator, so that sibling namespaces such as "app" and "apple" do not overlap.
+// Operations over the entire storage, such as Count and Flush, are restricted to the namespace.
+// Namespaces can be nested by wrapping one Driver in another, in which case their prefixes are combined.
+// A prefix that contains Separator, such as "app.eu", is nested in the same way, so is also within namespace "app".
+//
+// The prefix should only contain path-safe characters (letters, numbers, '-', '_' and '.') so that it is stored as-is by every driver.
+// For example, the disk driver replaces unsafe characters in filenames, so a prefix such as "app:" would not be recognised when scanning.
+type Driver struct {
+	next   databank.Driver
+	prefix string
+}
+
+// Separator joins a namespace's prefix to the IDs in it.
+const Separator = "."
+
+// writer sets the size of an entry once its prefixed copy is stored.
+type writer struct {
+	io.WriteCloser
+
+	e  *databank.Entry
+	pe *databank.Entry
+}
+
+// New namespacing Driver.
+// Separator is added to the prefix unless it already ends with it, so "app" and "app." are the same namespace.
+func New(prefix string, next databank.Driver) *Driver {
+	if !strings.HasSuffix(prefix, Separator) {
+		prefix += Separator
+	}
+	return &Driver{
+		next:   next,
+		prefix: prefix,
+	}
+}
+
+// Cleanup all expired entries in the namespace.
+func (d *Driver) Cleanup() (uint, bool, []error) {
+	var deleted uint
+	ids, ok, err := d.Scan()
+	if err != nil {
+		return deleted, false, []error{err}
+	}
+	errs := []error{}
+	for _, id := range ids {
+		e, ok2, err := d.next.Read(d.ID(id))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok2 || !e.Meta.Expired {
+			continue
+		}
+		ok3, err := d.next.Delete(d.ID(id))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok3 {
+			deleted++
+		}
+	}
+	return deleted, ok, errs
+}
+
+// Count total number of entries in the namespace.
+// Note that this includes expired entries.
+func (d *Driver) Count() (uint, bool, error) {
+	ids, ok, err := d.Scan()
+	return uint(len(ids)), ok, err
+}
+
+// Create an entry whose content is written through the returned writer.
+// The entry itself is not modified, other than its size; as with Write, a copy is stored with the namespace prefix added to its key.
+func (d *Driver) Create(e *databank.Entry) (io.WriteCloser, error) {
+	pe := *e
+	pe.Key = d.prefix + e.Key
+	w, err := databank.Create(d.next, &pe)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, e: e, pe: &pe}, nil
+}
+
+// Delete an entry.
+func (d *Driver) Delete(id string) (bool, error) {
+	return d.next.Delete(d.ID(id))
+}
+
+// Expire an entry.
+func (d *Driver) Expire(id string) (bool, error) {
+	return d.next.Expire(d.ID(id))
+}
+
+// Flush all entries in the namespace.
+func (d *Driver) Flush() (bool, []error) {
+	ids, ok, err := d.Scan()
+	if err != nil {
+		return ok, []error{err}
+	}
+	errs := []error{}
+	for _, id := range ids {
+		if _, err := d.next.Delete(d.ID(id)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return true, errs
+}
+
+// Has an ID, i.e. entry exists in storage?
+// Note that an expired entry still 'exists' until it is deleted or flushed out.
+func (d *Driver) Has(id string) (bool, error) {
+	return d.next.Has(d.ID(id))
+}
+
+// ID gets the underlying storage ID for an ID in the namespace.
+func (d *Driver) ID(id string) string {
+	return d.prefix + id
+}
+
+// OpenReader opens an entry for reading its content.
+// The entry's key is returned without the namespace prefix.
+func (d *Driver) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	e, r, ok, err := databank.OpenReader(d.next, d.ID(id))
+	if !ok || err != nil {
+		return nil, nil, ok, err
+	}
+	return d.strip(e), r, true, nil
+}
+
+// Prefix of the namespace, including Separator.
+func (d *Driver) Prefix() string {
+	return d.prefix
+}
+
+// Read an entry from storage.
+// The entry's key is returned without the namespace prefix.
+func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
+	e, ok, err := d.next.Read(d.ID(id))
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	return d.strip(e), true, nil
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+func (d *Driver) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRange(d.next, d.ID(id), offset, length)
+}
+
+// Review entries in the namespace, automatically expiring them as necessary.
+func (d *Driver) Review() (uint, bool, []error) {
+	var expired uint
+	ids, ok, err := d.Scan()
+	if err != nil {
+		return expired, false, []error{err}
+	}
+	errs := []error{}
+	for _, id := range ids {
+		e, ok2, err := d.next.Read(d.ID(id))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok2 || !e.MaybeExpire() {
+			continue
+		}
+		ok3, err := d.next.Write(e)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok3 {
+			expired++
+		}
+	}
+	return expired, ok, errs
+}
+
+// Scan for IDs in the namespace.
+// IDs are returned without the namespace prefix.
+func (d *Driver) Scan() ([]string, bool, error) {
+	ids, ok, err := d.next.Scan()
+	return d.filter(ids), ok, err
+}
+
+// Search entries in the namespace.
+// IDs and entry keys are returned without the namespace prefix.
+func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	results, ok, err := d.next.Search(q)
+	filtered := map[string]*databank.Entry{}
+	for id, e := range results {
+		if strings.HasPrefix(id, d.prefix) {
+			filtered[strings.TrimPrefix(id, d.prefix)] = d.strip(e)
+		}
+	}
+	return filtered, ok, err
+}
+
+// Tagged finds the IDs of all entries in the namespace with a tag set to the given value.
+// IDs are returned without the namespace prefix.
+func (d *Driver) Tagged(tag, value string) ([]string, bool, error) {
+	ids, ok, err := databank.FindTagged(d.next, tag, value)
+	return d.filter(ids), ok, err
+}
+
+// WithContext creates a copy of the Driver with the context bound to the next driver.
+func (d *Driver) WithContext(ctx context.Context) databank.Driver {
+	c := *d
+	c.next = databank.WithContext(ctx, d.next)
+	return &c
+}
+
+// Write an entry to storage.
+// The entry itself is not modified; a copy is written with the namespace prefix added to its key.
+func (d *Driver) Write(e *databank.Entry) (bool, error) {
+	pe := *e
+	pe.Key = d.prefix + e.Key
+	return d.next.Write(&pe)
+}
+
+// filter IDs to those in the namespace, removing the prefix.
+func (d *Driver) filter(ids []string) []string {
+	filtered := []string{}
+	for _, id := range ids {
+		if strings.HasPrefix(id, d.prefix) {
+			filtered = append(filtered, strings.TrimPrefix(id, d.prefix))
+		}
+	}
+	return filtered
+}
+
+// strip the namespace prefix from a copy of an entry's key.
+func (d *Driver) strip(e *databank.Entry) *databank.Entry {
+	se := *e
+	se.Key = strings.TrimPrefix(e.Key, d.prefix)
+	return &se
+}
+
+// Close the writer, storing the entry.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	w.e.Size = w.pe.Size
+	return err
+}
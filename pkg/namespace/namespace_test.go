@@ -0,0 +1,116 @@
+package namespace
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/disk"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NamespaceDriver(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return New("test.", atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_NamespaceDriver_Isolation(t *testing.T) {
+	a := assert.New(t)
+	store := atomicdb.New()
+	root := databank.New(nil, store)
+	ns1 := databank.New(nil, New("ns1.", store))
+	ns2 := databank.New(nil, New("ns2.", store))
+	nested := databank.New(nil, New("sub.", New("ns1.", store)))
+
+	ns1.WriteString("key", "abc")
+	ns2.WriteString("key", "def")
+	nested.WriteString("key", "ghi")
+
+	v, _ := ns1.ReadString("key")
+	a.Equal("abc", v)
+	v, _ = ns2.ReadString("key")
+	a.Equal("def", v)
+	v, _ = nested.ReadString("key")
+	a.Equal("ghi", v)
+	v, _ = root.ReadString("ns1.sub.key")
+	a.Equal("ghi", v)
+
+	ids, _ := ns1.Scan()
+	a.ElementsMatch([]string{"key", "sub.key"}, ids)
+	ids, _ = nested.Scan()
+	a.Equal([]string{"key"}, ids)
+	n, _ := root.Count()
+	a.Equal(uint(3), n)
+
+	a.Equal(true, ns1.Flush())
+	a.Equal(false, nested.Has("key"))
+	a.Equal(true, ns2.Has("key"))
+	n, _ = root.Count()
+	a.Equal(uint(1), n)
+}
+
+func Test_NamespaceDriver_Siblings(t *testing.T) {
+	a := assert.New(t)
+	store := atomicdb.New()
+	root := databank.New(nil, store)
+	app := databank.New(nil, New("app", store))
+	apple := databank.New(nil, New("apple", store))
+
+	app.WriteString("key", "abc")
+	apple.WriteString("key", "def")
+	e := apple.NewEntry("old")
+	e.Meta.Expired = true
+	apple.Write(e)
+
+	ids, _ := root.Scan()
+	a.ElementsMatch([]string{"app.key", "apple.key", "apple.old"}, ids)
+	ids, _ = app.Scan()
+	a.Equal([]string{"key"}, ids)
+	n, _ := app.Count()
+	a.Equal(uint(1), n)
+
+	n, _ = app.Cleanup()
+	a.Equal(uint(0), n)
+	a.True(apple.Has("old"))
+
+	a.True(app.Flush())
+	a.False(app.Has("key"))
+	v, _ := apple.ReadString("key")
+	a.Equal("def", v)
+	n, _ = root.Count()
+	a.Equal(uint(2), n)
+}
+
+func Test_NamespaceDriver_Stream(t *testing.T) {
+	a := assert.New(t)
+	store, err := disk.New(disk.NewConfig(t.TempDir()))
+	a.Nil(err)
+	ns := New("ns.", store)
+
+	e := databank.NewEntry("key", 0)
+	w, err := databank.Create(ns, e)
+	a.Nil(err)
+	_, err = w.Write([]byte("abc"))
+	a.Nil(err)
+	a.Nil(w.Close())
+	a.Equal(3, e.Size)
+
+	// content is streamed to the next driver under the prefixed key
+	_, r, ok, err := store.OpenReader("ns.key")
+	a.True(ok)
+	a.Nil(err)
+	r.Close()
+
+	re, r, ok, err := databank.OpenReader(ns, "key")
+	a.True(ok)
+	a.Nil(err)
+	a.Equal("key", re.Key)
+	b, err := ioutil.ReadAll(r)
+	a.Nil(err)
+	a.Nil(r.Close())
+	a.Equal("abc", string(b))
+}
@@ -1,9 +1,14 @@
 package proxy
 
 import (
+	"context"
+
 	"github.com/edge/databank"
 )
 
+// batchSize is the number of entries SyncDriver processes at a time in storage-wide operations.
+const batchSize = 256
+
 // SyncDriver is a synchronous proxying implementation of databank.Driver.
 // It takes any number of other drivers, and mirrors read/write operations sequentially across them.
 //
@@ -23,12 +28,31 @@ func NewSync(drivers ...databank.Driver) *SyncDriver {
 	return &SyncDriver{drivers}
 }
 
+// Atomic reports whether transactions are applied atomically, which requires every driver to be atomic.
+//
+// Transactions are committed to the authority driver, then applied to each other driver in turn (see Transact).
+// Unless each application is atomic, another driver may be left partially applied until the affected IDs are deleted from it.
+func (d *SyncDriver) Atomic() bool {
+	for _, driver := range d.drivers {
+		if !databank.Atomic(driver) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authority gets the authority driver, i.e. the last driver.
+func (d *SyncDriver) Authority() databank.Driver {
+	return d.authority()
+}
+
 // Cleanup all expired entries.
 //
 // SyncDriver works backwards from the authority driver to ensure that front drivers cannot recover data mid-cleanup.
 // Errors encountered are aggregated, but do not stop the iterator.
 //
 // Note that SyncDriver implements this function internally and does not use the Cleanup function of its configured drivers.
+// Entries are read and deleted in batches.
 //
 // TODO This is not performant as driver search [for expired entries] does not work yet.
 // This should be improved by substituting Search() for Scan() ASAP.
@@ -49,31 +73,34 @@ func (d *SyncDriver) Cleanup() (uint, bool, []error) {
 			okResult = false
 			continue
 		}
-		for _, id := range ids {
-			e, ok, err := driver.Read(id)
-			if err != nil {
+		for _, batch := range batches(ids, batchSize) {
+			entries, errs := databank.ReadMany(driver, batch)
+			for _, err := range errs {
 				errors = append(errors, err)
 				okResult = false
-				continue
-			}
-			if !ok {
-				// this just means the ID was not found; ignore
-				continue
 			}
-			if !e.Meta.Expired {
-				continue
+			expired := []string{}
+			for id, e := range entries {
+				if e.Meta.Expired {
+					expired = append(expired, id)
+				}
 			}
-			ok, err = d.Delete(id)
-			if err != nil {
-				errors = append(errors, err)
-				okResult = false
+			if len(expired) == 0 {
 				continue
 			}
-			if !ok {
-				okResult = false
-				continue
+			oks, errs := d.DeleteMany(expired)
+			for _, id := range expired {
+				if err, ok := errs[id]; ok {
+					errors = append(errors, err)
+					okResult = false
+					continue
+				}
+				if !oks[id] {
+					okResult = false
+					continue
+				}
+				deleted++
 			}
-			deleted++
 		}
 	}
 	return deleted, okResult, errors
@@ -107,6 +134,31 @@ func (d *SyncDriver) Delete(id string) (bool, error) {
 	return okResult, errResult
 }
 
+// DeleteMany deletes multiple entries.
+//
+// SyncDriver works backwards from the authority driver, deleting the whole batch from each driver in turn.
+// Errors encountered by any driver do not stop the iterator, but are not aggregated; only the last error for each ID will be returned.
+func (d *SyncDriver) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	errResults := map[string]error{}
+	for _, id := range ids {
+		results[id] = true
+	}
+	for i := range d.drivers {
+		driver := d.drivers[len(d.drivers)-(i+1)]
+		oks, errs := databank.DeleteMany(driver, ids)
+		for _, id := range ids {
+			if err, ok := errs[id]; ok {
+				errResults[id] = err
+			}
+			if !oks[id] {
+				results[id] = false
+			}
+		}
+	}
+	return results, errResults
+}
+
 // Expire an entry.
 //
 // SyncDriver writes to each driver sequentially.
@@ -176,7 +228,7 @@ func (d *SyncDriver) Has(id string) (bool, error) {
 //
 // Errors encountered during writeback are ignored - SyncDriver is naïve and trusts that the prior drivers work, since they didn't return errors the first time.
 func (d *SyncDriver) Read(id string) (*databank.Entry, bool, error) {
-	failed := []*databank.Driver{}
+	failed := []databank.Driver{}
 	var result *databank.Entry
 	for _, driver := range d.drivers {
 		e, ok, err := driver.Read(id)
@@ -187,7 +239,7 @@ func (d *SyncDriver) Read(id string) (*databank.Entry, bool, error) {
 			result = e
 			break
 		}
-		failed = append(failed, &driver)
+		failed = append(failed, driver)
 	}
 	if result == nil {
 		return nil, false, nil
@@ -195,18 +247,57 @@ func (d *SyncDriver) Read(id string) (*databank.Entry, bool, error) {
 	f := len(failed)
 	if f > 0 {
 		for i := range failed {
-			driver := *failed[f-(i+1)]
+			driver := failed[f-(i+1)]
 			driver.Write(result)
 		}
 	}
 	return result, true, nil
 }
 
+// ReadMany reads multiple entries from storage.
+//
+// SyncDriver reads the whole batch from the first driver, then tries each subsequent driver only for the entries that were not found.
+// As with Read, hits are silently written back into each driver that failed to read them, and errors encountered during writeback are ignored.
+// If an error is returned for any entry, that entry is not read from any further drivers.
+func (d *SyncDriver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	results := map[string]*databank.Entry{}
+	errResults := map[string]error{}
+	remaining := ids
+	for i, driver := range d.drivers {
+		if len(remaining) == 0 {
+			break
+		}
+		entries, errs := databank.ReadMany(driver, remaining)
+		missing := []string{}
+		hits := []*databank.Entry{}
+		for _, id := range remaining {
+			if err, ok := errs[id]; ok {
+				errResults[id] = err
+				continue
+			}
+			if e, ok := entries[id]; ok {
+				results[id] = e
+				hits = append(hits, e)
+				continue
+			}
+			missing = append(missing, id)
+		}
+		if len(hits) > 0 {
+			for j := range d.drivers[:i] {
+				databank.WriteMany(d.drivers[i-(j+1)], hits)
+			}
+		}
+		remaining = missing
+	}
+	return results, errResults
+}
+
 // Restore entries from storage.
 //
 // SyncDriver loads all data from the authoritative driver and copies it backward.
 // Its bool return reflects whether ALL entries were successfully retrieved and copied.
 // Errors encountered are aggregated, but do not stop the iterator.
+// Entries are read and written in batches.
 //
 // Usage of this function may not be advisable depending on the size of your data source.
 func (d *SyncDriver) Restore() (bool, []error) {
@@ -219,27 +310,35 @@ func (d *SyncDriver) Restore() (bool, []error) {
 	}
 	errors := []error{}
 	okResult := true
-	for _, id := range ids {
-		e, ok, err := d.authority().Read(id)
-		if err != nil {
-			errors = append(errors, err)
-			continue
-		}
-		if !ok {
-			okResult = false
-			continue
+	for _, batch := range batches(ids, batchSize) {
+		entries, errs := databank.ReadMany(d.authority(), batch)
+		restore := []*databank.Entry{}
+		for _, id := range batch {
+			if err, ok := errs[id]; ok {
+				errors = append(errors, err)
+				continue
+			}
+			e, ok := entries[id]
+			if !ok {
+				okResult = false
+				continue
+			}
+			restore = append(restore, e)
 		}
 		for i := range d.drivers {
 			if i == 0 {
 				continue
 			}
 			driver := d.drivers[len(d.drivers)-(i+1)]
-			ok, err := driver.Write(e)
-			if err != nil {
-				errors = append(errors, err)
-			}
-			if !ok {
-				okResult = false
+			oks, errs := databank.WriteMany(driver, restore)
+			for _, e := range restore {
+				id := e.ID()
+				if err, ok := errs[id]; ok {
+					errors = append(errors, err)
+				}
+				if !oks[id] {
+					okResult = false
+				}
 			}
 		}
 	}
@@ -315,6 +414,51 @@ func (d *SyncDriver) Search(q *databank.Query) (map[string]*databank.Entry, bool
 	return map[string]*databank.Entry{}, false, nil
 }
 
+// Tagged finds the IDs of all entries with a tag set to the given value.
+//
+// SyncDriver searches the authority driver only, using its tag index if it has one.
+func (d *SyncDriver) Tagged(tag, value string) ([]string, bool, error) {
+	return databank.FindTagged(d.authority(), tag, value)
+}
+
+// Transact applies a set of operations.
+//
+// SyncDriver commits the transaction to the authority driver first, checking expected versions there only.
+// If the authority driver is atomic, so is the commit; otherwise, a failure may be partially applied and an error wrapping databank.ErrTxNotAtomic is returned.
+//
+// Once committed to the authority driver, the operations are applied to each other driver, working backwards.
+// If any other driver fails, the affected IDs are deleted from it so that it cannot serve stale data; errors encountered doing so are ignored.
+func (d *SyncDriver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	ok, err := databank.Transact(d.authority(), expect, ops)
+	if err != nil || !ok {
+		return ok, err
+	}
+	ids := []string{}
+	for _, op := range ops {
+		ids = append(ids, op.ID)
+	}
+	for i := range d.drivers {
+		if i == 0 {
+			continue
+		}
+		driver := d.drivers[len(d.drivers)-(i+1)]
+		ok, err := databank.Transact(driver, nil, ops)
+		if err != nil || !ok {
+			databank.DeleteMany(driver, ids)
+		}
+	}
+	return true, nil
+}
+
+// WithContext creates a copy of the SyncDriver with the context bound to each of its drivers.
+func (d *SyncDriver) WithContext(ctx context.Context) databank.Driver {
+	drivers := []databank.Driver{}
+	for _, driver := range d.drivers {
+		drivers = append(drivers, databank.WithContext(ctx, driver))
+	}
+	return &SyncDriver{drivers}
+}
+
 // Write an entry to storage.
 //
 // SyncDriver writes to each driver sequentially.
@@ -332,7 +476,7 @@ func (d *SyncDriver) Write(e *databank.Entry) (bool, error) {
 
 	var errResult error
 	okResult := true
-	written := []*databank.Driver{}
+	written := []databank.Driver{}
 	for _, driver := range d.drivers {
 		ok, err := driver.Write(e)
 		if err != nil {
@@ -344,12 +488,12 @@ func (d *SyncDriver) Write(e *databank.Entry) (bool, error) {
 			okResult = false
 			continue
 		}
-		written = append(written, &driver)
+		written = append(written, driver)
 	}
 	if errResult != nil {
 		w := len(written)
 		for i := range written {
-			driver := *written[w-(i+1)]
+			driver := written[w-(i+1)]
 			if origE != nil {
 				driver.Write(origE)
 			} else {
@@ -360,7 +504,82 @@ func (d *SyncDriver) Write(e *databank.Entry) (bool, error) {
 	return okResult, errResult
 }
 
+// WriteMany writes multiple entries to storage.
+//
+// SyncDriver writes the whole batch to each driver sequentially.
+// Each bool result reflects whether ALL drivers wrote that entry successfully.
+//
+// If a write error is encountered for an entry in any driver, that entry is not written to any further drivers and its prior writes are silently rolled back to the entry in the authority driver.
+// Other entries in the batch are unaffected.
+// As with Write, errors encountered during rollback are ignored.
+func (d *SyncDriver) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	results := map[string]bool{}
+	errResults := map[string]error{}
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID())
+	}
+	origEntries, errs := databank.ReadMany(d.authority(), ids)
+	pending := []*databank.Entry{}
+	for _, e := range entries {
+		id := e.ID()
+		if err, ok := errs[id]; ok {
+			results[id] = false
+			errResults[id] = err
+			continue
+		}
+		results[id] = true
+		pending = append(pending, e)
+	}
+
+	written := map[string][]databank.Driver{}
+	for _, driver := range d.drivers {
+		if len(pending) == 0 {
+			break
+		}
+		oks, errs := databank.WriteMany(driver, pending)
+		next := []*databank.Entry{}
+		for _, e := range pending {
+			id := e.ID()
+			if err, ok := errs[id]; ok {
+				results[id] = false
+				errResults[id] = err
+				w := written[id]
+				for i := range w {
+					if origE, ok := origEntries[id]; ok {
+						w[len(w)-(i+1)].Write(origE)
+					} else {
+						w[len(w)-(i+1)].Delete(id)
+					}
+				}
+				continue
+			}
+			if !oks[id] {
+				results[id] = false
+			} else {
+				written[id] = append(written[id], driver)
+			}
+			next = append(next, e)
+		}
+		pending = next
+	}
+	return results, errResults
+}
+
 // authority driver shorthand.
 func (d *SyncDriver) authority() databank.Driver {
 	return d.drivers[len(d.drivers)-1]
 }
+
+// batches splits IDs into batches of a given size.
+func batches(ids []string, size int) [][]string {
+	b := [][]string{}
+	for len(ids) > size {
+		b = append(b, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		b = append(b, ids)
+	}
+	return b
+}
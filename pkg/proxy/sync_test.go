@@ -10,8 +10,27 @@ import (
 	atomicdb "github.com/edge/databank/pkg/atomic"
 	"github.com/edge/databank/pkg/disk"
 	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
 )
 
+// writeSpy records the content of every entry written to it.
+type writeSpy struct {
+	databank.Driver
+	written []string
+}
+
+func (d *writeSpy) Write(e *databank.Entry) (bool, error) {
+	d.written = append(d.written, string(e.Content))
+	return d.Driver.Write(e)
+}
+
+func (d *writeSpy) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	for _, e := range entries {
+		d.written = append(d.written, string(e.Content))
+	}
+	return databank.WriteMany(d.Driver, entries)
+}
+
 func Test_Proxy_SyncDriver(t *testing.T) {
 	outDir := path.Join(os.TempDir(), "edge", "databank-test")
 	fmt.Printf("Disk cache location: %s\n", outDir)
@@ -28,3 +47,60 @@ func Test_Proxy_SyncDriver(t *testing.T) {
 	})
 	dt.Run(t)
 }
+
+func Test_Proxy_SyncDriver_Restore(t *testing.T) {
+	a := assert.New(t)
+	ad := atomicdb.New()
+	dd, err := disk.New(disk.NewConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := databank.New(nil, dd)
+	for i := 0; i < batchSize+10; i++ {
+		db.WriteString(fmt.Sprintf("restore%d", i), "abc")
+	}
+
+	sd := NewSync(ad, dd)
+	ok, errs := sd.Restore()
+	a.Equal(true, ok)
+	a.Empty(errs)
+	n, _, _ := ad.Count()
+	a.Equal(uint(batchSize+10), n)
+	e, ok, _ := ad.Read("restore0")
+	a.Equal(true, ok)
+	a.Equal([]byte("abc"), e.Content)
+}
+
+func Test_Proxy_SyncDriver_ReadWriteback(t *testing.T) {
+	a := assert.New(t)
+	ad := atomicdb.New()
+	dd, err := disk.New(disk.NewConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	databank.New(nil, dd).WriteString("key", "abc")
+
+	db := databank.New(nil, NewSync(ad, dd))
+	v, ok := db.ReadString("key")
+	a.Equal(true, ok)
+	a.Equal("abc", v)
+	e, ok, _ := ad.Read("key")
+	a.Equal(true, ok)
+	a.Equal([]byte("abc"), e.Content)
+}
+
+func Test_Proxy_SyncDriver_WriteManyNoWriteback(t *testing.T) {
+	a := assert.New(t)
+	front := &writeSpy{Driver: atomicdb.New()}
+	back := atomicdb.New()
+	databank.New(nil, back).WriteString("key", "abc")
+
+	e := databank.NewEntry("key", 0)
+	e.Content = []byte("def")
+	results, errs := NewSync(front, back).WriteMany([]*databank.Entry{e})
+	a.Equal(map[string]bool{"key": true}, results)
+	a.Empty(errs)
+	// the entry being replaced is not written back to the front driver first
+	a.Equal([]string{"def"}, front.written)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket.
+// Tokens are added continuously at a fixed rate, up to the burst size, and each operation takes one or more.
+type bucket struct {
+	mtx    sync.Mutex
+	burst  float64
+	last   time.Time
+	rate   float64
+	tokens float64
+}
+
+// newBucket creates a full bucket for a limit.
+// If the limit has no rate, nil is returned, meaning unlimited.
+func newBucket(l Limit) *bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{
+		burst:  burst,
+		last:   time.Now(),
+		rate:   l.Rate,
+		tokens: burst,
+	}
+}
+
+// cancel a reservation, returning its tokens to the bucket.
+func (b *bucket) cancel(n float64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.tokens += n
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// refill the bucket with tokens accrued since the last refill.
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// reserve tokens, returning how long to wait before they are available.
+// The bucket may go into debt, so that later reservations wait their turn.
+func (b *bucket) reserve(n float64) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// take tokens if they are available now, returning false otherwise.
+// More tokens than the burst size can never be available, so they are taken once the bucket is full, putting it into debt.
+func (b *bucket) take(n float64) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	if b.tokens < n && b.tokens < b.burst {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
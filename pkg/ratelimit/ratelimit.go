@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Modes of limiting.
+const (
+	// Block operations until they are within limits.
+	Block Mode = iota
+	// FailFast operations that exceed limits, returning ErrLimited.
+	FailFast
+)
+
+// ErrLimited is returned by operations that exceed limits in FailFast mode.
+var ErrLimited = errors.New("rate limited")
+
+// Config for a ratelimit Middleware.
+type Config struct {
+	// MaxConcurrent is the maximum number of operations in flight at once.
+	// If 0, concurrency is not limited.
+	MaxConcurrent int
+	// Mode of limiting.
+	Mode Mode
+	// Reads limits Has, OpenReader, Read, ReadMany, ReadRange and Tagged operations.
+	Reads Limit
+	// Store limits operations that process the whole store: Cleanup, Count, Flush, Review, Scan and Search.
+	Store Limit
+	// Writes limits Create, Delete, DeleteMany, Expire, Transact, Write and WriteMany operations.
+	Writes Limit
+}
+
+// Limit is a rate limit for a class of operations.
+type Limit struct {
+	// Burst is the maximum number of operations allowed at once, after a quiet period.
+	// Batch operations count once per entry.
+	// A batch larger than Burst waits for the tokens it exceeds Burst by in Block mode, or is allowed once the bucket is full in FailFast mode; either way, later operations wait or fail until its full cost is repaid.
+	Burst int
+	// Rate of operations per second.
+	// If 0, the rate is not limited.
+	Rate float64
+}
+
+// Middleware is a rate limiting middleware that wraps another driver.
+// It limits the rate of operations with token buckets, separately for reads, writes and whole-store operations, and caps the number of operations in flight.
+//
+// For example, to stop a batch job from saturating a shared disk store:
+//
+//	c := ratelimit.NewConfig()
+//	c.MaxConcurrent = 4
+//	c.Writes = ratelimit.Limit{Rate: 500, Burst: 50}
+//	d := ratelimit.NewMiddleware(c, diskDriver)
+//
+// If the Middleware is bound to a context with WithContext, blocked operations end when the context is done, returning the context's error.
+type Middleware struct {
+	*databank.Intercepted
+
+	config *Config
+
+	reads  *bucket
+	sem    chan struct{}
+	store  *bucket
+	writes *bucket
+}
+
+// Mode of limiting.
+type Mode int
+
+// NewConfig creates a ratelimit Middleware configuration.
+// Nothing is limited by default.
+func NewConfig() *Config {
+	return &Config{
+		Mode: Block,
+	}
+}
+
+// NewMiddleware creates a new ratelimit Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		config: c,
+
+		reads:  newBucket(c.Reads),
+		store:  newBucket(c.Store),
+		writes: newBucket(c.Writes),
+	}
+	if c.MaxConcurrent > 0 {
+		m.sem = make(chan struct{}, c.MaxConcurrent)
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// intercept an operation, within limits.
+// Streams are limited when they are opened; they do not hold a concurrency slot while content is written or read.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	b, n := m.cost(c)
+	release, err := m.acquire(c.Ctx, b, n)
+	if err != nil {
+		return &databank.Result{Err: err}
+	}
+	defer release()
+	return next(c)
+}
+
+// cost of an operation, in tokens from a bucket.
+// Batch operations cost one token per entry.
+// Operations outside the classes of Config are not rate limited, but still take a concurrency slot.
+func (m *Middleware) cost(c *databank.Call) (*bucket, int) {
+	switch c.Op {
+	case databank.OpCleanup, databank.OpCount, databank.OpFlush, databank.OpReview, databank.OpScan, databank.OpSearch:
+		return m.store, 1
+	case databank.OpCreate, databank.OpDelete, databank.OpExpire, databank.OpWrite:
+		return m.writes, 1
+	case databank.OpDeleteMany:
+		return m.writes, len(c.IDs)
+	case databank.OpTransact:
+		return m.writes, len(c.TxOps)
+	case databank.OpWriteMany:
+		return m.writes, len(c.Entries)
+	case databank.OpHas, databank.OpOpenReader, databank.OpRead, databank.OpReadRange, databank.OpTagged:
+		return m.reads, 1
+	case databank.OpReadMany:
+		return m.reads, len(c.IDs)
+	}
+	return nil, 1
+}
+
+// acquire permission for an operation costing n tokens from a bucket, and a concurrency slot.
+// The returned function must be called to release the slot once the operation is complete.
+// If a slot cannot be acquired, the tokens are returned to the bucket, as the operation is not performed.
+func (m *Middleware) acquire(ctx context.Context, b *bucket, n int) (func(), error) {
+	if err := m.wait(ctx, b, n); err != nil {
+		return nil, err
+	}
+	if m.sem == nil {
+		return func() {}, nil
+	}
+	release := func() { <-m.sem }
+	if m.config.Mode == FailFast {
+		select {
+		case m.sem <- struct{}{}:
+			return release, nil
+		default:
+			refund(b, n)
+			return nil, ErrLimited
+		}
+	}
+	select {
+	case m.sem <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		refund(b, n)
+		return nil, ctx.Err()
+	}
+}
+
+// wait for n tokens from a bucket.
+// A nil bucket is unlimited.
+func (m *Middleware) wait(ctx context.Context, b *bucket, n int) error {
+	if b == nil {
+		return nil
+	}
+	tokens := float64(n)
+	if m.config.Mode == FailFast {
+		if !b.take(tokens) {
+			return ErrLimited
+		}
+		return nil
+	}
+	d := b.reserve(tokens)
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel(tokens)
+		return ctx.Err()
+	}
+}
+
+// refund n tokens to a bucket.
+// A nil bucket is unlimited.
+func refund(b *bucket, n int) {
+	if b != nil {
+		b.cancel(float64(n))
+	}
+}
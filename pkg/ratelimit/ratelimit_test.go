@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// hungDriver blocks reads until released.
+type hungDriver struct {
+	databank.Driver
+	release chan struct{}
+}
+
+func (d *hungDriver) Read(id string) (*databank.Entry, bool, error) {
+	<-d.release
+	return d.Driver.Read(id)
+}
+
+func Test_RateLimitMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		c := NewConfig()
+		c.MaxConcurrent = 2
+		c.Reads = Limit{Rate: 10000, Burst: 100}
+		return NewMiddleware(c, atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_RateLimitMiddleware_Block(t *testing.T) {
+	a := assert.New(t)
+	c := NewConfig()
+	c.Reads = Limit{Rate: 100, Burst: 1}
+	m := NewMiddleware(c, atomicdb.New())
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := m.Has("x")
+		a.Nil(err)
+	}
+	a.True(time.Since(start) >= 45*time.Millisecond)
+
+	// writes are limited separately
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		m.Delete("x")
+	}
+	a.True(time.Since(start) < 45*time.Millisecond)
+
+	// batches larger than the burst are charged in full
+	c.Writes = Limit{Rate: 100, Burst: 2}
+	m = NewMiddleware(c, atomicdb.New())
+	start = time.Now()
+	m.DeleteMany([]string{"a", "b", "c", "d", "e", "f"})
+	a.True(time.Since(start) >= 35*time.Millisecond)
+	start = time.Now()
+	m.Delete("a")
+	a.True(time.Since(start) >= 5*time.Millisecond)
+}
+
+func Test_RateLimitMiddleware_FailFast(t *testing.T) {
+	a := assert.New(t)
+	c := NewConfig()
+	c.Mode = FailFast
+	c.Store = Limit{Rate: 1, Burst: 2}
+	m := NewMiddleware(c, atomicdb.New())
+
+	_, _, err := m.Scan()
+	a.Nil(err)
+	_, _, err = m.Count()
+	a.Nil(err)
+	_, errs := m.Flush()
+	a.Equal([]error{ErrLimited}, errs)
+
+	// batches count per entry
+	c.Writes = Limit{Rate: 1, Burst: 3}
+	m = NewMiddleware(c, atomicdb.New())
+	_, bErrs := m.DeleteMany([]string{"a", "b"})
+	a.Empty(bErrs)
+	_, bErrs = m.DeleteMany([]string{"a", "b"})
+	a.Equal(map[string]error{"a": ErrLimited, "b": ErrLimited}, bErrs)
+
+	// batches larger than the burst are allowed once the bucket is full, and charged in full
+	c.Writes = Limit{Rate: 1, Burst: 2}
+	m = NewMiddleware(c, atomicdb.New())
+	_, bErrs = m.DeleteMany([]string{"a", "b", "c", "d", "e"})
+	a.Empty(bErrs)
+	_, err = m.Delete("a")
+	a.Equal(ErrLimited, err)
+
+	// streams are limited when they are opened
+	c.Reads = Limit{Rate: 1, Burst: 1}
+	c.Writes = Limit{Rate: 1, Burst: 1}
+	m = NewMiddleware(c, atomicdb.New())
+	_, _, _, err = m.OpenReader("a")
+	a.Nil(err)
+	_, _, _, err = m.OpenReader("a")
+	a.Equal(ErrLimited, err)
+	_, err = m.Create(databank.NewEntry("a", 0))
+	a.Nil(err)
+	_, err = m.Create(databank.NewEntry("a", 0))
+	a.Equal(ErrLimited, err)
+}
+
+func Test_RateLimitMiddleware_Concurrency(t *testing.T) {
+	a := assert.New(t)
+	for _, mode := range []Mode{Block, FailFast} {
+		d := &hungDriver{atomicdb.New(), make(chan struct{})}
+		c := NewConfig()
+		c.MaxConcurrent = 2
+		c.Mode = mode
+		c.Reads = Limit{Rate: 0.001, Burst: 3}
+		m := NewMiddleware(c, d)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.Read("x")
+			}()
+		}
+		for len(m.sem) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if mode == FailFast {
+			_, err := m.Has("x")
+			a.Equal(ErrLimited, err)
+		} else {
+			// waits for a slot until the context is done
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, err := m.WithContext(ctx).Has("x")
+			cancel()
+			a.Equal(context.DeadlineExceeded, err)
+		}
+
+		// tokens are refunded if no slot is acquired
+		close(d.release)
+		wg.Wait()
+		_, err := m.Has("x")
+		a.Nil(err)
+	}
+}
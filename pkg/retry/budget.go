@@ -0,0 +1,49 @@
+package retry
+
+import "sync"
+
+// budget limits retries to a proportion of requests, to avoid retry storms when a driver is persistently failing.
+// Each request deposits a fraction of a token, and each retry withdraws a whole token.
+type budget struct {
+	mtx    sync.Mutex
+	max    float64
+	ratio  float64
+	tokens float64
+}
+
+// newBudget creates a full budget.
+// If ratio is 0, the budget is unlimited.
+func newBudget(ratio, max float64) *budget {
+	return &budget{
+		max:    max,
+		ratio:  ratio,
+		tokens: max,
+	}
+}
+
+// deposit a request.
+func (b *budget) deposit() {
+	if b.ratio == 0 {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw a retry, returning false if the budget is exhausted.
+func (b *budget) withdraw() bool {
+	if b.ratio == 0 {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,258 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Config for a retry Middleware.
+type Config struct {
+	// Attempts is the maximum number of attempts at each operation, including the first.
+	Attempts int
+	// BaseDelay before the first retry.
+	// The delay doubles with each subsequent retry.
+	BaseDelay time.Duration
+	// BudgetMax is the maximum number of retries that can be saved up in the retry budget.
+	BudgetMax float64
+	// BudgetRatio is the number of retries earned by each operation, e.g. 0.1 allows 1 retry per 10 operations on average.
+	// If 0, retries are not budgeted.
+	BudgetRatio float64
+	// Classify errors, returning true if they are transient and the operation can be retried.
+	// If nil, Retryable is used.
+	Classify func(err error) bool
+	// Jitter is the proportion of each delay that is randomised, between 0 and 1.
+	Jitter float64
+	// MaxDelay between retries.
+	MaxDelay time.Duration
+}
+
+// Middleware is a retry middleware that wraps another driver.
+// Idempotent operations that fail with a transient error are retried with exponential backoff and jitter.
+//
+// Cleanup, Review and Transact are never retried, as repeating them after a partial success could have a different effect.
+// Batch operations retry only the IDs that failed with a transient error.
+// Streams are retried only while opening them; errors writing or reading content are not retried, as it cannot be replayed.
+//
+// Retries are limited by a budget shared across all operations, so that a persistently failing driver is not flooded with retries.
+// If the Middleware is bound to a context with WithContext, retries stop when the context is done.
+type Middleware struct {
+	*databank.Intercepted
+
+	budget *budget
+	config *Config
+	stats  *stats
+}
+
+// Stats are counters of retry activity.
+type Stats struct {
+	// Denied retries, due to the retry budget being exhausted.
+	Denied uint64
+	// Exhausted operations, which failed on their final attempt.
+	Exhausted uint64
+	// Retries performed.
+	Retries uint64
+}
+
+// stats are updated atomically, and shared between copies of a Middleware.
+type stats struct {
+	denied    uint64
+	exhausted uint64
+	retries   uint64
+}
+
+// NewConfig creates a retry Middleware configuration with sensible defaults.
+// Operations are attempted up to 3 times, and retries are budgeted at 1 per 10 operations.
+func NewConfig() *Config {
+	return &Config{
+		Attempts:    3,
+		BaseDelay:   10 * time.Millisecond,
+		BudgetMax:   10,
+		BudgetRatio: 0.1,
+		Classify:    Retryable,
+		Jitter:      0.5,
+		MaxDelay:    time.Second,
+	}
+}
+
+// NewMiddleware creates a new retry Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		budget: newBudget(c.BudgetRatio, c.BudgetMax),
+		config: c,
+		stats:  &stats{},
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// Retryable is the default error classifier.
+// EAGAIN, EINTR and any error with a Temporary method that returns true, such as a temporary net.Error, are retryable.
+func Retryable(err error) bool {
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+		return true
+	}
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return false
+}
+
+// Stats gets a snapshot of retry counters.
+func (m *Middleware) Stats() Stats {
+	return Stats{
+		Denied:    atomic.LoadUint64(&m.stats.denied),
+		Exhausted: atomic.LoadUint64(&m.stats.exhausted),
+		Retries:   atomic.LoadUint64(&m.stats.retries),
+	}
+}
+
+// intercept an operation, retrying it as appropriate.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	switch c.Op {
+	case databank.OpCleanup, databank.OpReview:
+		return next(c)
+	case databank.OpTransact:
+		// a transaction that failed after committing would then fail its version check
+		return next(c)
+	case databank.OpDeleteMany, databank.OpReadMany:
+		return m.doMany(c.Ctx, c.IDs, func(ids []string) *databank.Result {
+			b := *c
+			b.IDs = ids
+			return next(&b)
+		})
+	case databank.OpWriteMany:
+		byID := map[string]*databank.Entry{}
+		ids := []string{}
+		for _, e := range c.Entries {
+			byID[e.ID()] = e
+			ids = append(ids, e.ID())
+		}
+		return m.doMany(c.Ctx, ids, func(ids []string) *databank.Result {
+			b := *c
+			b.Entries = []*databank.Entry{}
+			for _, id := range ids {
+				b.Entries = append(b.Entries, byID[id])
+			}
+			return next(&b)
+		})
+	case databank.OpFlush:
+		// retried only if all errors are retryable
+		var r *databank.Result
+		m.do(c.Ctx, func() error {
+			r = next(c)
+			for _, err := range r.Errs {
+				if !m.classify(err) {
+					return nil
+				}
+			}
+			if len(r.Errs) > 0 {
+				return r.Errs[0]
+			}
+			return nil
+		})
+		return r
+	}
+	var r *databank.Result
+	m.do(c.Ctx, func() error {
+		r = next(c)
+		return r.Err
+	})
+	return r
+}
+
+// again decides whether to retry after a failed attempt, waiting for the backoff delay if so.
+func (m *Middleware) again(ctx context.Context, attempt int) bool {
+	if attempt >= m.config.Attempts {
+		atomic.AddUint64(&m.stats.exhausted, 1)
+		return false
+	}
+	if !m.budget.withdraw() {
+		atomic.AddUint64(&m.stats.denied, 1)
+		return false
+	}
+	t := time.NewTimer(m.delay(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	atomic.AddUint64(&m.stats.retries, 1)
+	return true
+}
+
+// classify an error.
+func (m *Middleware) classify(err error) bool {
+	if m.config.Classify == nil {
+		return Retryable(err)
+	}
+	return m.config.Classify(err)
+}
+
+// delay before a retry.
+func (m *Middleware) delay(attempt int) time.Duration {
+	d := m.config.BaseDelay << uint(attempt-1)
+	if d <= 0 || (m.config.MaxDelay > 0 && d > m.config.MaxDelay) {
+		d = m.config.MaxDelay
+	}
+	if m.config.Jitter > 0 {
+		j := float64(d) * m.config.Jitter
+		d = time.Duration(float64(d) - j + rand.Float64()*j)
+	}
+	return d
+}
+
+// do an operation, retrying while it fails with a retryable error, until the context is done.
+// The last error is returned.
+func (m *Middleware) do(ctx context.Context, f func() error) error {
+	m.budget.deposit()
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !m.classify(err) || !m.again(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// doMany does a batch operation, retrying only the IDs that failed with a retryable error, until the context is done.
+// The results of all attempts are merged, with the errors of the last attempt for each ID.
+func (m *Middleware) doMany(ctx context.Context, ids []string, f func(ids []string) *databank.Result) *databank.Result {
+	m.budget.deposit()
+	all := &databank.Result{
+		Entries: map[string]*databank.Entry{},
+		ErrMap:  map[string]error{},
+		Results: map[string]bool{},
+	}
+	for attempt := 1; ; attempt++ {
+		r := f(ids)
+		for id, e := range r.Entries {
+			all.Entries[id] = e
+		}
+		for id, ok := range r.Results {
+			all.Results[id] = ok
+		}
+		retry := []string{}
+		for id, err := range r.ErrMap {
+			all.ErrMap[id] = err
+			if m.classify(err) {
+				retry = append(retry, id)
+			}
+		}
+		if len(retry) == 0 || !m.again(ctx, attempt) {
+			return all
+		}
+		sort.Strings(retry)
+		for _, id := range retry {
+			delete(all.ErrMap, id)
+		}
+		ids = retry
+	}
+}
@@ -0,0 +1,192 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyDriver fails reads and writes with an error until it has failed a set number of times per ID.
+type flakyDriver struct {
+	databank.Driver
+	err      error
+	failures int
+
+	mtx   sync.Mutex
+	calls map[string]int
+}
+
+func newFlaky(failures int, err error) *flakyDriver {
+	return &flakyDriver{
+		Driver:   atomicdb.New(),
+		err:      err,
+		failures: failures,
+		calls:    map[string]int{},
+	}
+}
+
+func (d *flakyDriver) Calls(id string) int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.calls[id]
+}
+
+func (d *flakyDriver) Read(id string) (*databank.Entry, bool, error) {
+	if d.fail(id) {
+		return nil, false, d.err
+	}
+	return d.Driver.Read(id)
+}
+
+func (d *flakyDriver) Write(e *databank.Entry) (bool, error) {
+	if d.fail(e.ID()) {
+		return false, d.err
+	}
+	return d.Driver.Write(e)
+}
+
+func (d *flakyDriver) fail(id string) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.calls[id]++
+	return d.calls[id] <= d.failures
+}
+
+func newEntry(key string) *databank.Entry {
+	e := databank.NewEntry(key, 0)
+	e.WriteString(key)
+	return e
+}
+
+func testConfig() *Config {
+	c := NewConfig()
+	c.BaseDelay = time.Millisecond
+	c.MaxDelay = 5 * time.Millisecond
+	return c
+}
+
+func Test_RetryMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware(testConfig(), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_RetryMiddleware_Transient(t *testing.T) {
+	a := assert.New(t)
+	flaky := newFlaky(2, fmt.Errorf("write: %w", syscall.EAGAIN))
+	m := NewMiddleware(testConfig(), flaky)
+
+	e := newEntry("key")
+	ok, err := m.Write(e)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal(3, flaky.Calls(e.ID()))
+	a.Equal(Stats{Retries: 2}, m.Stats())
+
+	// exhausted after 3 attempts
+	flaky.failures = 10
+	e = newEntry("other")
+	ok, err = m.Write(e)
+	a.False(ok)
+	a.True(errors.Is(err, syscall.EAGAIN))
+	a.Equal(3, flaky.Calls(e.ID()))
+	a.Equal(Stats{Exhausted: 1, Retries: 4}, m.Stats())
+}
+
+func Test_RetryMiddleware_Permanent(t *testing.T) {
+	a := assert.New(t)
+	flaky := newFlaky(1, errors.New("disk on fire"))
+	m := NewMiddleware(testConfig(), flaky)
+
+	e := newEntry("key")
+	_, err := m.Write(e)
+	a.NotNil(err)
+	a.Equal(1, flaky.Calls(e.ID()))
+	a.Equal(Stats{}, m.Stats())
+
+	// custom classifier
+	m.config.Classify = func(err error) bool { return true }
+	e = newEntry("other")
+	_, err = m.Write(e)
+	a.Nil(err)
+	a.Equal(2, flaky.Calls(e.ID()))
+}
+
+func Test_RetryMiddleware_Stream(t *testing.T) {
+	a := assert.New(t)
+	flaky := newFlaky(2, fmt.Errorf("read: %w", syscall.EAGAIN))
+	flaky.Driver.Write(newEntry("key"))
+	m := NewMiddleware(testConfig(), flaky)
+
+	// opening a stream is retried
+	_, r, ok, err := m.OpenReader("key")
+	a.True(ok)
+	a.Nil(err)
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	a.Equal("key", string(b))
+	a.Equal(3, flaky.Calls("key"))
+	a.Equal(Stats{Retries: 2}, m.Stats())
+}
+
+func Test_RetryMiddleware_Budget(t *testing.T) {
+	a := assert.New(t)
+	c := testConfig()
+	c.BudgetMax = 2
+	c.BudgetRatio = 0.1
+	flaky := newFlaky(1, syscall.EINTR)
+	m := NewMiddleware(c, flaky)
+
+	for i := 0; i < 4; i++ {
+		m.Write(newEntry(fmt.Sprintf("key%d", i)))
+	}
+	stats := m.Stats()
+	a.Equal(uint64(2), stats.Retries)
+	a.Equal(uint64(2), stats.Denied)
+}
+
+func Test_RetryMiddleware_Batch(t *testing.T) {
+	a := assert.New(t)
+	flaky := newFlaky(1, syscall.EAGAIN)
+	m := NewMiddleware(testConfig(), flaky)
+
+	entries := []*databank.Entry{}
+	for _, key := range []string{"a", "b", "c"} {
+		entries = append(entries, newEntry(key))
+	}
+	results, errs := m.WriteMany(entries)
+	a.Empty(errs)
+	a.Len(results, 3)
+	for _, e := range entries {
+		a.True(results[e.ID()])
+		a.Equal(2, flaky.Calls(e.ID()))
+	}
+	a.Equal(uint64(1), m.Stats().Retries)
+}
+
+func Test_RetryMiddleware_Context(t *testing.T) {
+	a := assert.New(t)
+	c := testConfig()
+	c.BaseDelay = time.Hour
+	c.MaxDelay = time.Hour
+	flaky := newFlaky(1, syscall.EAGAIN)
+	m := NewMiddleware(c, flaky)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	e := newEntry("key")
+	_, err := m.WithContext(ctx).Write(e)
+	a.NotNil(err)
+	a.Equal(1, flaky.Calls(e.ID()))
+}
@@ -2,6 +2,8 @@ package tests
 
 import (
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
@@ -67,9 +69,23 @@ func (dt *Tester) Run(t *testing.T) {
 	dt.testHas(t, d)
 	dt.testRead(t, d)
 	dt.testDelete(t, d)
+	dt.testTags(t, d)
 	dt.testFlush(t, d)
 
+	// batch operations
+	dt.testBatch(t, d)
+
+	// transactions
+	dt.testTx(t, d)
+
+	// typed values
+	dt.testTypes(t, d)
+
+	// streaming
+	dt.testStream(t, d)
+
 	// test various handling of expiry
+	// this is step 11; steps must be numbered in the order they run, as checked by expect
 	// dt.testExpire(t, d)
 }
 
@@ -90,6 +106,49 @@ func (dt *Tester) expect(step int) {
 	dt.step = next
 }
 
+func (dt *Tester) testBatch(t *testing.T, d databank.Databank) {
+	dt.expect(7)
+	a := assert.New(t)
+
+	entries := []*databank.Entry{}
+	ids := []string{}
+	for _, data := range testData {
+		e := d.NewEntry(data.Key)
+		if len(data.Tags) > 0 {
+			e.Tags = data.Tags
+		}
+		e.Content = []byte(data.Content)
+		entries = append(entries, e)
+		ids = append(ids, data.ID)
+	}
+	written := d.WriteMany(entries)
+	a.Equal(len(testData), len(written))
+	for _, id := range ids {
+		a.Equal(true, written[id])
+	}
+
+	read := d.ReadMany(append(append([]string{}, ids...), invalidIDs...))
+	a.Equal(len(testData), len(read))
+	for _, data := range testData {
+		e, ok := read[data.ID]
+		if a.Equal(true, ok) {
+			a.Equal(data.Key, e.Key)
+			a.Equal([]byte(data.Content), e.Content)
+			a.Equal(data.Size, e.Size)
+		}
+	}
+
+	deleted := d.DeleteMany(append([]string{ids[0], ids[1]}, invalidIDs...))
+	a.Equal(2+len(invalidIDs), len(deleted))
+	for _, ok := range deleted {
+		a.Equal(true, ok)
+	}
+	n, _ := d.Count()
+	a.Equal(uint(len(testData)-2), n)
+
+	a.Equal(true, d.Flush())
+}
+
 func (dt *Tester) testCount(t *testing.T, d databank.Databank) {
 	dt.expect(2)
 	a := assert.New(t)
@@ -117,7 +176,7 @@ func (dt *Tester) testDelete(t *testing.T, d databank.Databank) {
 }
 
 func (dt *Tester) testFlush(t *testing.T, d databank.Databank) {
-	dt.expect(5)
+	dt.expect(6)
 	a := assert.New(t)
 	a.Equal(true, d.Flush())
 }
@@ -169,6 +228,226 @@ func (dt *Tester) testScan(t *testing.T, d databank.Databank) {
 	}
 }
 
+func (dt *Tester) testStream(t *testing.T, d databank.Databank) {
+	dt.expect(10)
+	a := assert.New(t)
+
+	content := strings.Repeat("0123456789", 1000)
+	w := d.Create("stream")
+	for i := 0; i < len(content); i += 999 {
+		end := i + 999
+		if end > len(content) {
+			end = len(content)
+		}
+		n, err := w.Write([]byte(content[i:end]))
+		a.Nil(err)
+		a.Equal(end-i, n)
+	}
+	a.Equal(false, d.Has("stream"))
+	a.Nil(w.Close())
+	a.NotNil(w.Close())
+
+	r, ok := d.OpenReader("stream")
+	if a.Equal(true, ok) {
+		b, err := ioutil.ReadAll(r)
+		a.Nil(err)
+		a.Equal(content, string(b))
+		a.Nil(r.Close())
+	}
+
+	e, ok := d.Read("stream")
+	a.Equal(true, ok)
+	a.Equal(content, string(e.Content))
+	a.Equal(len(content), e.Size)
+
+	// entries written normally can be streamed too
+	d.WriteString("string", "abc")
+	r, ok = d.OpenReader("string")
+	if a.Equal(true, ok) {
+		b, _ := ioutil.ReadAll(r)
+		a.Equal("abc", string(b))
+		r.Close()
+	}
+
+	for _, id := range invalidIDs {
+		_, ok = d.OpenReader(id)
+		a.Equal(false, ok)
+	}
+
+	a.Equal(true, d.Flush())
+}
+
+func (dt *Tester) testTags(t *testing.T, d databank.Databank) {
+	dt.expect(6)
+	a := assert.New(t)
+
+	ids, ok := d.Tagged("tag1", "val1")
+	a.Equal(true, ok)
+	a.ElementsMatch([]string{"test4_16257516605739849767", "test5_5091786465586096835"}, ids)
+
+	ids, ok = d.Tagged("tag1", "val2")
+	a.Equal(true, ok)
+	a.Empty(ids)
+
+	n, ok := d.ExpireByTag("vec", "54")
+	a.Equal(true, ok)
+	a.Equal(uint(1), n)
+	e, ok, _ := d.Driver().Read("test6_12385537651473712091")
+	a.Equal(true, ok)
+	a.Equal(true, e.Meta.Expired)
+
+	n, ok = d.DeleteByTag("tag1", "val1")
+	a.Equal(true, ok)
+	a.Equal(uint(2), n)
+	ids, _ = d.Tagged("tag1", "val1")
+	a.Empty(ids)
+	ids, _ = d.Tagged("tag2", "val2")
+	a.Empty(ids)
+	a.Equal(false, d.Has("test4_16257516605739849767"))
+	a.Equal(true, d.Has("test3"))
+}
+
+func (dt *Tester) testTx(t *testing.T, d databank.Databank) {
+	dt.expect(8)
+	a := assert.New(t)
+
+	// commit
+	tx := d.Begin()
+	for _, data := range testData[:3] {
+		e := d.NewEntry(data.Key)
+		e.Content = []byte(data.Content)
+		a.Nil(tx.Write(e))
+	}
+	e, ok, err := tx.Read(testData[0].ID)
+	a.Nil(err)
+	a.Equal(true, ok)
+	a.Equal([]byte(testData[0].Content), e.Content)
+	a.Equal(false, d.Has(testData[0].ID))
+	a.Nil(tx.Commit())
+	for _, data := range testData[:3] {
+		e, ok := d.Read(data.ID)
+		if a.Equal(true, ok) {
+			a.Equal([]byte(data.Content), e.Content)
+		}
+	}
+	a.Equal(databank.ErrTxDone, tx.Commit())
+
+	// read-modify-write and delete
+	tx = d.Begin()
+	e, ok, err = tx.Read(testData[0].ID)
+	a.Nil(err)
+	a.Equal(true, ok)
+	e.Content = []byte("modified")
+	a.Nil(tx.Write(e))
+	a.Nil(tx.Delete(testData[1].ID))
+	_, ok, _ = tx.Read(testData[1].ID)
+	a.Equal(false, ok)
+	a.Nil(tx.Commit())
+	v, _ := d.ReadString(testData[0].ID)
+	a.Equal("modified", v)
+	a.Equal(false, d.Has(testData[1].ID))
+
+	// conflict
+	tx = d.Begin()
+	e, _, _ = tx.Read(testData[0].ID)
+	e.Content = []byte("conflicted")
+	a.Nil(tx.Write(e))
+	a.Nil(tx.Delete(testData[2].ID))
+	d.WriteString(testData[0].Key, "external")
+	a.Equal(databank.ErrTxConflict, tx.Commit())
+	v, _ = d.ReadString(testData[0].ID)
+	a.Equal("external", v)
+	a.Equal(true, d.Has(testData[2].ID))
+
+	// rollback
+	tx = d.Begin()
+	a.Nil(tx.Delete(testData[2].ID))
+	a.Nil(tx.Rollback())
+	a.Equal(databank.ErrTxDone, tx.Commit())
+	a.Equal(true, d.Has(testData[2].ID))
+
+	a.Equal(true, d.Flush())
+}
+
+func (dt *Tester) testTypes(t *testing.T, d databank.Databank) {
+	dt.expect(9)
+	a := assert.New(t)
+
+	now := time.Date(2021, 7, 6, 15, 4, 5, 123456789, time.FixedZone("CEST", 2*60*60))
+
+	d.WriteBool("bool", true)
+	d.WriteDuration("duration", -90*time.Second)
+	d.WriteFloat32("float32", 1.5)
+	d.WriteFloat64("float64", -0.1)
+	d.WriteInt8("int8", -8)
+	d.WriteInt16("int16", -16)
+	d.WriteInt32("int32", -32)
+	d.WriteInt64("int64", -64)
+	d.WriteString("string", "abc")
+	d.WriteStrings("strings", []string{"a", "", "bc"})
+	d.WriteTime("time", now)
+	d.WriteUint8("uint8", 8)
+	d.WriteUint16("uint16", 16)
+	d.WriteUint32("uint32", 32)
+	d.WriteUint64("uint64", 64)
+
+	b, ok := d.ReadBool("bool")
+	a.Equal(true, ok)
+	a.Equal(true, b)
+	du, ok := d.ReadDuration("duration")
+	a.Equal(true, ok)
+	a.Equal(-90*time.Second, du)
+	f32, ok := d.ReadFloat32("float32")
+	a.Equal(true, ok)
+	a.Equal(float32(1.5), f32)
+	f64, ok := d.ReadFloat64("float64")
+	a.Equal(true, ok)
+	a.Equal(-0.1, f64)
+	i8, ok := d.ReadInt8("int8")
+	a.Equal(true, ok)
+	a.Equal(int8(-8), i8)
+	i16, ok := d.ReadInt16("int16")
+	a.Equal(true, ok)
+	a.Equal(int16(-16), i16)
+	i32, ok := d.ReadInt32("int32")
+	a.Equal(true, ok)
+	a.Equal(int32(-32), i32)
+	i64, ok := d.ReadInt64("int64")
+	a.Equal(true, ok)
+	a.Equal(int64(-64), i64)
+	s, ok := d.ReadString("string")
+	a.Equal(true, ok)
+	a.Equal("abc", s)
+	ss, ok := d.ReadStrings("strings")
+	a.Equal(true, ok)
+	a.Equal([]string{"a", "", "bc"}, ss)
+	tm, ok := d.ReadTime("time")
+	a.Equal(true, ok)
+	a.True(now.Equal(tm))
+	_, offset := tm.Zone()
+	a.Equal(2*60*60, offset)
+	u8, ok := d.ReadUint8("uint8")
+	a.Equal(true, ok)
+	a.Equal(uint8(8), u8)
+	u16, ok := d.ReadUint16("uint16")
+	a.Equal(true, ok)
+	a.Equal(uint16(16), u16)
+	u32, ok := d.ReadUint32("uint32")
+	a.Equal(true, ok)
+	a.Equal(uint32(32), u32)
+	u64, ok := d.ReadUint64("uint64")
+	a.Equal(true, ok)
+	a.Equal(uint64(64), u64)
+
+	// mismatched types are refused
+	_, ok = d.ReadInt64("float64")
+	a.Equal(false, ok)
+	_, ok = d.ReadBool("uint8")
+	a.Equal(false, ok)
+
+	a.Equal(true, d.Flush())
+}
+
 func (dt *Tester) testWrite(t *testing.T, d databank.Databank) {
 	dt.expect(1)
 	a := assert.New(t)
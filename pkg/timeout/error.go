@@ -0,0 +1,34 @@
+package timeout
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// ErrTimeout matches any TimeoutError with errors.Is.
+var ErrTimeout = errors.New("operation timed out")
+
+// TimeoutError is returned by operations that do not complete within their timeout.
+type TimeoutError struct {
+	Op      databank.Op
+	Timeout time.Duration
+}
+
+// Error message.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+// Is the target ErrTimeout?
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Temporary is always true, as the operation may succeed if retried.
+// This allows timed out operations to be retried by retry.Middleware.
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
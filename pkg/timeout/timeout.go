@@ -0,0 +1,168 @@
+package timeout
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Operation states, used to decide whether an operation was abandoned.
+const (
+	running int32 = iota
+	done
+	abandoned
+)
+
+// Config for a timeout Middleware.
+type Config struct {
+	// Default timeout for operations that have no specific timeout.
+	// If 0, such operations are not bounded.
+	Default time.Duration
+	// Timeouts for specific operations.
+	// A timeout of 0 disables the timeout for that operation.
+	Timeouts map[databank.Op]time.Duration
+}
+
+// Middleware is a timeout middleware that wraps another driver.
+// Each operation is bounded by a timeout, after which a *TimeoutError is returned to the caller.
+//
+// Driver operations cannot be cancelled, so a timed out operation is abandoned: it continues running in the background and its result is discarded.
+// Any stream it opens is closed, so that it does not hold resources such as files.
+// Abandoned operations are counted in Stats, so that a backend that is hanging rather than merely slow can be observed.
+//
+// If the Middleware is bound to a context with WithContext, operations also end when the context is done, returning the context's error.
+type Middleware struct {
+	*databank.Intercepted
+
+	config *Config
+	stats  *stats
+}
+
+// Stats are counters of timeout activity.
+type Stats struct {
+	// Abandoned operations that are still running.
+	Abandoned uint64
+	// Completed abandoned operations, which eventually returned.
+	Completed uint64
+	// Timeouts of operations.
+	Timeouts uint64
+}
+
+// stats are updated atomically, and shared between copies of a Middleware.
+type stats struct {
+	abandoned uint64
+	completed uint64
+	timeouts  uint64
+}
+
+// NewConfig creates a timeout Middleware configuration with sensible defaults.
+// Operations time out after 5 seconds, or 30 seconds for operations that process the whole store.
+func NewConfig() *Config {
+	return &Config{
+		Default: 5 * time.Second,
+		Timeouts: map[databank.Op]time.Duration{
+			databank.OpCleanup: 30 * time.Second,
+			databank.OpFlush:   30 * time.Second,
+			databank.OpReview:  30 * time.Second,
+			databank.OpSearch:  30 * time.Second,
+		},
+	}
+}
+
+// NewMiddleware creates a new timeout Middleware.
+func NewMiddleware(c *Config, next databank.Driver) *Middleware {
+	m := &Middleware{
+		config: c,
+		stats:  &stats{},
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// Stats gets a snapshot of timeout counters.
+func (m *Middleware) Stats() Stats {
+	return Stats{
+		Abandoned: atomic.LoadUint64(&m.stats.abandoned),
+		Completed: atomic.LoadUint64(&m.stats.completed),
+		Timeouts:  atomic.LoadUint64(&m.stats.timeouts),
+	}
+}
+
+// intercept an operation, bounding it by its timeout.
+// Only opening streams is bounded, not writing or reading their content.
+// A stream opened by an abandoned operation is closed once it opens; for a streamed write, this writes the entry without content.
+// Note that a transaction that times out may still be committed by the abandoned operation.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	r, err := m.do(c.Ctx, c.Op, func() *databank.Result {
+		return next(c)
+	})
+	if err != nil {
+		return &databank.Result{Err: err}
+	}
+	return r
+}
+
+// do an operation within its timeout.
+// If the operation times out or the context is done first, it is abandoned and an error is returned instead of its result.
+func (m *Middleware) do(ctx context.Context, op databank.Op, f func() *databank.Result) (*databank.Result, error) {
+	timeout := m.timeout(op)
+	if timeout <= 0 && ctx.Done() == nil {
+		return f(), nil
+	}
+
+	state := running
+	ch := make(chan *databank.Result, 1)
+	go func() {
+		r := f()
+		ch <- r
+		if !atomic.CompareAndSwapInt32(&state, running, done) {
+			// nobody else will close a stream opened by an abandoned operation
+			if r.Reader != nil {
+				r.Reader.Close()
+			}
+			if r.Writer != nil {
+				r.Writer.Close()
+			}
+			atomic.AddUint64(&m.stats.abandoned, ^uint64(0))
+			atomic.AddUint64(&m.stats.completed, 1)
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	var err error
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-expired:
+		err = &TimeoutError{Op: op, Timeout: timeout}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// count before abandoning, so the goroutine cannot uncount first
+	atomic.AddUint64(&m.stats.abandoned, 1)
+	if !atomic.CompareAndSwapInt32(&state, running, abandoned) {
+		// completed while timing out
+		atomic.AddUint64(&m.stats.abandoned, ^uint64(0))
+		return <-ch, nil
+	}
+	if _, ok := err.(*TimeoutError); ok {
+		atomic.AddUint64(&m.stats.timeouts, 1)
+	}
+	return nil, err
+}
+
+// timeout for an operation.
+func (m *Middleware) timeout(op databank.Op) time.Duration {
+	if t, ok := m.config.Timeouts[op]; ok {
+		return t
+	}
+	return m.config.Default
+}
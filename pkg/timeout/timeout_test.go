@@ -0,0 +1,152 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// hungDriver blocks reads until released.
+type hungDriver struct {
+	databank.Driver
+	release chan struct{}
+}
+
+// hungStreamer blocks opening streams until released, and counts how many it has closed.
+type hungStreamer struct {
+	databank.Driver
+	closed  int32
+	release chan struct{}
+}
+
+// stream counts its closure.
+type stream struct {
+	bytes.Buffer
+	closed *int32
+}
+
+func (d *hungStreamer) Create(e *databank.Entry) (io.WriteCloser, error) {
+	<-d.release
+	return &stream{closed: &d.closed}, nil
+}
+
+func (d *hungStreamer) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	<-d.release
+	return databank.NewEntry(id, 0), &stream{closed: &d.closed}, true, nil
+}
+
+func (s *stream) Close() error {
+	atomic.AddInt32(s.closed, 1)
+	return nil
+}
+
+func (d *hungDriver) Read(id string) (*databank.Entry, bool, error) {
+	<-d.release
+	return d.Driver.Read(id)
+}
+
+func Test_TimeoutMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware(NewConfig(), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_TimeoutMiddleware_Timeout(t *testing.T) {
+	a := assert.New(t)
+	d := &hungDriver{atomicdb.New(), make(chan struct{})}
+	c := NewConfig()
+	c.Timeouts[databank.OpRead] = 10 * time.Millisecond
+	m := NewMiddleware(c, d)
+
+	_, ok, err := m.Read("x")
+	a.False(ok)
+	a.True(errors.Is(err, ErrTimeout))
+	terr, isTimeout := err.(*TimeoutError)
+	a.True(isTimeout)
+	a.Equal(databank.OpRead, terr.Op)
+	a.Equal(10*time.Millisecond, terr.Timeout)
+	a.Equal(Stats{Abandoned: 1, Timeouts: 1}, m.Stats())
+
+	// other operations are unaffected
+	ok, err = m.Has("x")
+	a.False(ok)
+	a.Nil(err)
+
+	// streams are bounded while they are opened
+	c.Timeouts[databank.OpOpenReader] = 10 * time.Millisecond
+	_, _, ok, err = m.OpenReader("x")
+	a.False(ok)
+	a.True(errors.Is(err, ErrTimeout))
+	a.Equal(databank.OpOpenReader, err.(*TimeoutError).Op)
+	a.Equal(Stats{Abandoned: 2, Timeouts: 2}, m.Stats())
+
+	// abandoned operations complete in the background
+	close(d.release)
+	for i := 0; i < 100 && m.Stats().Abandoned > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(Stats{Completed: 2, Timeouts: 2}, m.Stats())
+}
+
+func Test_TimeoutMiddleware_Disabled(t *testing.T) {
+	a := assert.New(t)
+	d := &hungDriver{atomicdb.New(), make(chan struct{})}
+	c := NewConfig()
+	c.Default = 10 * time.Millisecond
+	c.Timeouts[databank.OpRead] = 0
+	m := NewMiddleware(c, d)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(d.release)
+	}()
+	_, _, err := m.Read("x")
+	a.Nil(err)
+	a.Equal(Stats{}, m.Stats())
+}
+
+func Test_TimeoutMiddleware_Context(t *testing.T) {
+	a := assert.New(t)
+	d := &hungDriver{atomicdb.New(), make(chan struct{})}
+	defer close(d.release)
+	m := NewMiddleware(NewConfig(), d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := m.WithContext(ctx).Read("x")
+	a.Equal(context.DeadlineExceeded, err)
+	a.Equal(Stats{Abandoned: 1}, m.Stats())
+}
+
+func Test_TimeoutMiddleware_AbandonedStreams(t *testing.T) {
+	a := assert.New(t)
+	d := &hungStreamer{Driver: atomicdb.New(), release: make(chan struct{})}
+	c := NewConfig()
+	c.Default = 10 * time.Millisecond
+	m := NewMiddleware(c, d)
+
+	w, err := m.Create(databank.NewEntry("x", 0))
+	a.Nil(w)
+	a.True(errors.Is(err, ErrTimeout))
+	_, r, _, err := m.OpenReader("x")
+	a.Nil(r)
+	a.True(errors.Is(err, ErrTimeout))
+
+	// streams opened by abandoned operations are closed, as the caller never receives them
+	close(d.release)
+	for i := 0; i < 100 && m.Stats().Abandoned > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(Stats{Completed: 2, Timeouts: 2}, m.Stats())
+	a.Equal(int32(2), atomic.LoadInt32(&d.closed))
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// contextKey for spans stored in a context.
+type contextKey struct{}
+
+// Exporter exports spans once they have ended.
+// Implementations must be safe for concurrent use.
+type Exporter interface {
+	Export(s *Span)
+}
+
+// MemoryExporter keeps exported spans in memory.
+// This is intended for tests.
+type MemoryExporter struct {
+	mtx   sync.Mutex
+	spans []*Span
+}
+
+// Span records a single operation.
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+
+	Name  string
+	Start time.Time
+	End   time.Time
+
+	Attributes map[string]interface{}
+	Err        error
+}
+
+// Tracer creates spans and exports them when they end.
+type Tracer struct {
+	exporter Exporter
+}
+
+// ContextWithSpan creates a context containing a span.
+// Spans started with the context will be children of the span.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// NewMemoryExporter creates an empty MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{
+		spans: []*Span{},
+	}
+}
+
+// NewTracer creates a Tracer that exports spans to an Exporter.
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{
+		exporter: e,
+	}
+}
+
+// SpanFromContext gets the span in a context.
+// If there is none, nil is returned.
+func SpanFromContext(ctx context.Context) *Span {
+	if s, ok := ctx.Value(contextKey{}).(*Span); ok {
+		return s
+	}
+	return nil
+}
+
+// Export a span.
+func (e *MemoryExporter) Export(s *Span) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Reset the exporter, discarding all spans.
+func (e *MemoryExporter) Reset() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.spans = []*Span{}
+}
+
+// Spans gets all exported spans, in the order they ended.
+func (e *MemoryExporter) Spans() []*Span {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return append([]*Span{}, e.spans...)
+}
+
+// Duration of the span.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Set an attribute on the span.
+func (s *Span) Set(k string, v interface{}) *Span {
+	s.Attributes[k] = v
+	return s
+}
+
+// End a span and export it.
+func (t *Tracer) End(s *Span) {
+	s.End = time.Now()
+	t.exporter.Export(s)
+}
+
+// Start a span.
+// If the context contains a span, the new span is its child; otherwise, it starts a new trace.
+// The returned context contains the new span.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{
+		SpanID: newID(8),
+
+		Name:  name,
+		Start: time.Now(),
+
+		Attributes: map[string]interface{}{},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		s.TraceID = newID(16)
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+// newID generates a random hex ID of n bytes.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
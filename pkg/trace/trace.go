@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/edge/databank"
+)
+
+// Span attributes set by Middleware.
+const (
+	AttrDriver    = "driver"
+	AttrHit       = "hit"
+	AttrID        = "id"
+	AttrN         = "n"
+	AttrOperation = "operation"
+	AttrSize      = "size"
+)
+
+// Middleware is a tracing middleware that wraps another driver.
+// It records a span for each operation, named after the driver and operation, e.g. "disk.read".
+//
+// Spans nest through any drivers that implement databank.ContextBinder, such as proxy.SyncDriver.
+// To see where time is spent in a proxy, wrap each of its drivers as well as the proxy itself:
+//
+//	tr := trace.NewTracer(exporter)
+//	d := trace.NewMiddleware("sync", tr, proxy.NewSync(
+//		trace.NewMiddleware("memory", tr, atomic.New()),
+//		trace.NewMiddleware("disk", tr, diskDriver),
+//	))
+//
+// Use databank.Databank.WithContext to make spans children of a span in your own code.
+type Middleware struct {
+	*databank.Intercepted
+
+	name   string
+	tracer *Tracer
+}
+
+// writer ends the span of a streamed write when it is closed.
+type writer struct {
+	io.WriteCloser
+
+	closed bool
+	e      *databank.Entry
+	m      *Middleware
+	s      *Span
+}
+
+// NewMiddleware creates a new tracing Middleware.
+// The name identifies the wrapped driver in spans.
+func NewMiddleware(name string, t *Tracer, next databank.Driver) *Middleware {
+	m := &Middleware{
+		name:   name,
+		tracer: t,
+	}
+	m.Intercepted = databank.Intercept(next, m.intercept)
+	return m
+}
+
+// end a span, recording any error.
+func (m *Middleware) end(s *Span, err error) {
+	s.Err = err
+	m.tracer.End(s)
+}
+
+// intercept traces an operation.
+// The next driver is bound to a context containing the span, so that any spans it starts are nested.
+//
+// The span of a streamed write ends when the returned writer is closed.
+// The span of a streamed read ends once the entry is open, not when its content has been read.
+func (m *Middleware) intercept(c *databank.Call, next databank.Handler) *databank.Result {
+	ctx, s := m.tracer.Start(c.Ctx, fmt.Sprintf("%s.%s", m.name, c.Op))
+	s.Set(AttrDriver, m.name).Set(AttrOperation, string(c.Op))
+	if c.ID != "" {
+		s.Set(AttrID, c.ID)
+	} else if c.Entry != nil {
+		s.Set(AttrID, c.Entry.ID())
+	}
+	switch c.Op {
+	case databank.OpDeleteMany, databank.OpReadMany:
+		s.Set(AttrN, len(c.IDs))
+	case databank.OpTransact:
+		s.Set(AttrN, len(c.TxOps))
+	case databank.OpWrite:
+		s.Set(AttrSize, c.Entry.Size)
+	case databank.OpWriteMany:
+		s.Set(AttrN, len(c.Entries))
+	}
+
+	c.Ctx = ctx
+	r := next(c)
+	switch c.Op {
+	case databank.OpCleanup, databank.OpCount, databank.OpReview:
+		s.Set(AttrN, r.N)
+	case databank.OpCreate:
+		if r.Err == nil {
+			r.Writer = &writer{WriteCloser: r.Writer, e: c.Entry, m: m, s: s}
+			return r
+		}
+	case databank.OpHas:
+		s.Set(AttrHit, r.OK)
+	case databank.OpOpenReader, databank.OpRead:
+		s.Set(AttrHit, r.OK)
+		if r.OK && r.Entry != nil {
+			s.Set(AttrSize, r.Entry.Size)
+		}
+	case databank.OpReadMany:
+		s.Set(AttrHit, len(r.Entries))
+	case databank.OpReadRange:
+		// the size recorded is that of the range read, not of the entry
+		s.Set(AttrHit, r.OK)
+		if r.OK {
+			s.Set(AttrSize, len(r.Content))
+		}
+	case databank.OpScan, databank.OpTagged:
+		s.Set(AttrN, len(r.IDs))
+	case databank.OpSearch:
+		s.Set(AttrN, len(r.Entries))
+	}
+	m.end(s, flatten(r.Errors()))
+	return r
+}
+
+// Close the writer and end its span.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	w.s.Set(AttrSize, w.e.Size)
+	w.m.end(w.s, err)
+	return err
+}
+
+// flatten multiple errors into one.
+func flatten(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("%d errors, first: %s", len(errs), errs[0])
+}
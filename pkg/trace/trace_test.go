@@ -0,0 +1,131 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/invalidate"
+	"github.com/edge/databank/pkg/metrics"
+	"github.com/edge/databank/pkg/namespace"
+	"github.com/edge/databank/pkg/proxy"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/edge/databank/pkg/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TraceMiddleware(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return NewMiddleware("atomic", NewTracer(NewMemoryExporter()), atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_TraceMiddleware_Nesting(t *testing.T) {
+	a := assert.New(t)
+	ex := NewMemoryExporter()
+	tr := NewTracer(ex)
+	back := atomicdb.New()
+	databank.New(nil, back).WriteString("key", "abc")
+
+	db := databank.New(nil, NewMiddleware("sync", tr, proxy.NewSync(
+		NewMiddleware("memory", tr, atomicdb.New()),
+		NewMiddleware("back", tr, back),
+	)))
+
+	ctx, root := tr.Start(context.Background(), "request")
+	v, ok := db.WithContext(ctx).ReadString("key")
+	tr.End(root)
+	a.Equal(true, ok)
+	a.Equal("abc", v)
+
+	spans := ex.Spans()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+		a.Equal(root.TraceID, s.TraceID)
+	}
+	a.Equal([]string{"memory.read", "back.read", "memory.write", "sync.read", "request"}, names)
+
+	syncRead := spans[3]
+	a.Equal(root.SpanID, syncRead.ParentID)
+	a.Equal("sync", syncRead.Attributes[AttrDriver])
+	a.Equal("read", syncRead.Attributes[AttrOperation])
+	a.Equal("key", syncRead.Attributes[AttrID])
+	a.Equal(true, syncRead.Attributes[AttrHit])
+	a.Equal(3, syncRead.Attributes[AttrSize])
+	for _, s := range spans[:3] {
+		a.Equal(syncRead.SpanID, s.ParentID)
+		a.True(s.Duration() <= syncRead.Duration())
+	}
+	a.Equal(false, spans[0].Attributes[AttrHit])
+	a.Equal(true, spans[1].Attributes[AttrHit])
+
+	// without a context, each call starts a new trace
+	ex.Reset()
+	db.Has("key")
+	spans = ex.Spans()
+	a.Equal(2, len(spans))
+	a.Equal("", spans[1].ParentID)
+	a.Equal(spans[1].SpanID, spans[0].ParentID)
+}
+
+func Test_TraceMiddleware_Wrappers(t *testing.T) {
+	a := assert.New(t)
+	bus, err := invalidate.NewBus(invalidate.NewConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	wrappers := map[string]func(next databank.Driver) databank.Driver{
+		"invalidate": func(next databank.Driver) databank.Driver {
+			return invalidate.New(bus, next)
+		},
+		"metrics": func(next databank.Driver) databank.Driver {
+			return metrics.NewMiddleware(metrics.NewConfig(), next)
+		},
+		"namespace": func(next databank.Driver) databank.Driver {
+			return namespace.New("ns.", next)
+		},
+		"watch": func(next databank.Driver) databank.Driver {
+			return watch.New(next)
+		},
+	}
+	for name, wrap := range wrappers {
+		ex := NewMemoryExporter()
+		tr := NewTracer(ex)
+		db := databank.New(nil, wrap(NewMiddleware("atomic", tr, atomicdb.New())))
+
+		ctx, root := tr.Start(context.Background(), "request")
+		db.WithContext(ctx).Has("key")
+		tr.End(root)
+		spans := ex.Spans()
+		if a.Equal(2, len(spans), name) {
+			a.Equal(root.SpanID, spans[0].ParentID, name)
+		}
+	}
+}
+
+func Test_TraceMiddleware_Stream(t *testing.T) {
+	a := assert.New(t)
+	ex := NewMemoryExporter()
+	db := databank.New(nil, NewMiddleware("atomic", NewTracer(ex), atomicdb.New()))
+
+	w := db.Create("key")
+	w.Write([]byte("abc"))
+	a.Equal(0, len(ex.Spans()))
+	a.Nil(w.Close())
+	r, ok := db.OpenReader("key")
+	a.True(ok)
+	r.Close()
+
+	spans := ex.Spans()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	a.Equal([]string{"atomic.create", "atomic.openReader"}, names)
+	a.Equal(3, spans[0].Attributes[AttrSize])
+	a.Equal(true, spans[1].Attributes[AttrHit])
+}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"strings"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Event types.
+const (
+	// Cleanup of an expired entry, which has been deleted.
+	Cleanup EventType = "cleanup"
+	// Delete of an entry.
+	Delete EventType = "delete"
+	// Dropped events. N reports the number of events that were not delivered because the subscriber's buffer was full.
+	Dropped EventType = "dropped"
+	// Expire an entry.
+	Expire EventType = "expire"
+	// Flush all entries.
+	Flush EventType = "flush"
+	// Review of an entry, which has been expired automatically.
+	Review EventType = "review"
+	// Write an entry.
+	Write EventType = "write"
+)
+
+// Event describes a change in storage.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// ID of the entry changed, if the event concerns a single entry.
+	ID string
+	// Key, Size and Meta describe the entry changed, if it could be read.
+	// Write events describe the entry as written, and Review events as it was once expired; others describe it as it was beforehand.
+	Key  string
+	Meta *databank.EntryMetadata
+	Size int
+
+	// N is the number of events dropped, for a Dropped event.
+	N uint
+}
+
+// EventType describes what happened in an Event.
+type EventType string
+
+// Filter events.
+// If a filter returns false, the event is not delivered.
+type Filter func(ev *Event) bool
+
+// Prefix creates a filter that passes events for entries whose ID has the given prefix.
+// Events that do not concern a single entry, such as Flush, are also passed.
+func Prefix(prefix string) Filter {
+	return func(ev *Event) bool {
+		return ev.ID == "" || strings.HasPrefix(ev.ID, prefix)
+	}
+}
+
+// Types creates a filter that passes events of the given types.
+func Types(types ...EventType) Filter {
+	return func(ev *Event) bool {
+		for _, t := range types {
+			if ev.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
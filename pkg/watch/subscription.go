@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"sync"
+	"time"
+)
+
+// Subscription to events from a watching Driver.
+type Subscription struct {
+	// C delivers events. It is closed when the subscription is closed.
+	C <-chan *Event
+
+	c      chan *Event
+	d      *Driver
+	filter Filter
+
+	closed  bool
+	dropped uint64
+	mtx     sync.Mutex
+	// unreported is the number of events dropped since the last Dropped event was delivered.
+	unreported uint64
+}
+
+// Close the subscription.
+// No further events will be delivered, and C is closed.
+func (s *Subscription) Close() {
+	s.d.unsubscribe(s)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+// Dropped gets the total number of events that were not delivered because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.dropped
+}
+
+// send an event without blocking.
+// If any events were previously dropped, a Dropped event must be delivered first.
+func (s *Subscription) send(ev *Event) {
+	if s.filter != nil && !s.filter(ev) {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return
+	}
+	if s.unreported > 0 {
+		select {
+		case s.c <- &Event{Type: Dropped, Time: time.Now(), N: uint(s.unreported)}:
+			s.unreported = 0
+		default:
+			s.drop()
+			return
+		}
+	}
+	select {
+	case s.c <- ev:
+	default:
+		s.drop()
+	}
+}
+
+// drop an event.
+func (s *Subscription) drop() {
+	s.dropped++
+	s.unreported++
+}
@@ -0,0 +1,377 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/edge/databank"
+)
+
+// Driver is a watching implementation of databank.Driver.
+// It wraps another driver and emits events for changes made through it to any number of subscribers.
+//
+// Only changes made through the Driver are observed; changes made directly to the wrapped driver, or by other processes sharing its storage, are not.
+type Driver struct {
+	next databank.Driver
+
+	mtx  *sync.RWMutex
+	subs map[*Subscription]bool
+}
+
+// writer emits a Write event when it is closed and its entry is stored.
+type writer struct {
+	io.WriteCloser
+
+	closed bool
+	d      *Driver
+	e      *databank.Entry
+}
+
+// New watching Driver.
+func New(next databank.Driver) *Driver {
+	return &Driver{
+		next: next,
+		mtx:  &sync.RWMutex{},
+		subs: map[*Subscription]bool{},
+	}
+}
+
+// Atomic reports whether the next driver applies transactions atomically.
+func (d *Driver) Atomic() bool {
+	return databank.Atomic(d.next)
+}
+
+// Cleanup all expired entries.
+// A Cleanup event is emitted for each entry deleted.
+//
+// The entries deleted are found by comparing storage before and after, so while there are subscribers, Cleanup reads every entry.
+func (d *Driver) Cleanup() (uint, bool, []error) {
+	before := d.peekAll(func(e *databank.Entry) bool {
+		return e.Meta.Expired || e.ShouldExpire()
+	})
+	n, ok, errs := d.next.Cleanup()
+	if n == 0 || len(before) == 0 {
+		return n, ok, errs
+	}
+	ids, _, err := d.next.Scan()
+	if err != nil {
+		return n, ok, append(errs, err)
+	}
+	for _, id := range ids {
+		delete(before, id)
+	}
+	for _, id := range sortedIDs(before) {
+		d.emit(entryEvent(Cleanup, id, before[id]))
+	}
+	return n, ok, errs
+}
+
+// Count total number of entries in storage.
+// Note that this includes expired entries.
+func (d *Driver) Count() (uint, bool, error) {
+	return d.next.Count()
+}
+
+// Create an entry whose content is written through the returned writer.
+// A Write event is emitted once the writer is closed and the entry is stored.
+func (d *Driver) Create(e *databank.Entry) (io.WriteCloser, error) {
+	w, err := databank.Create(d.next, e)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{WriteCloser: w, d: d, e: e}, nil
+}
+
+// Delete an entry.
+// A Delete event is emitted if successful, describing the entry as it was before it was deleted.
+func (d *Driver) Delete(id string) (bool, error) {
+	before := d.peek([]string{id})
+	ok, err := d.next.Delete(id)
+	if ok && err == nil {
+		d.emit(entryEvent(Delete, id, before[id]))
+	}
+	return ok, err
+}
+
+// DeleteMany deletes multiple entries.
+// A Delete event is emitted for each entry deleted successfully, as with Delete.
+func (d *Driver) DeleteMany(ids []string) (map[string]bool, map[string]error) {
+	before := d.peek(ids)
+	results, errs := databank.DeleteMany(d.next, ids)
+	for _, id := range ids {
+		if _, failed := errs[id]; results[id] && !failed {
+			d.emit(entryEvent(Delete, id, before[id]))
+		}
+	}
+	return results, errs
+}
+
+// Expire an entry.
+// An Expire event is emitted if successful, describing the entry as it was before it was expired.
+func (d *Driver) Expire(id string) (bool, error) {
+	before := d.peek([]string{id})
+	ok, err := d.next.Expire(id)
+	if ok && err == nil {
+		d.emit(entryEvent(Expire, id, before[id]))
+	}
+	return ok, err
+}
+
+// Flush all entries.
+// A Flush event is emitted if successful.
+func (d *Driver) Flush() (bool, []error) {
+	ok, errs := d.next.Flush()
+	if ok {
+		d.emit(&Event{Type: Flush})
+	}
+	return ok, errs
+}
+
+// Has an ID, i.e. entry exists in storage?
+// Note that an expired entry still 'exists' until it is deleted or flushed out.
+func (d *Driver) Has(id string) (bool, error) {
+	return d.next.Has(id)
+}
+
+// OpenReader opens an entry for reading its content.
+func (d *Driver) OpenReader(id string) (*databank.Entry, io.ReadCloser, bool, error) {
+	return databank.OpenReader(d.next, id)
+}
+
+// Read an entry from storage.
+func (d *Driver) Read(id string) (*databank.Entry, bool, error) {
+	return d.next.Read(id)
+}
+
+// ReadMany reads multiple entries from storage.
+func (d *Driver) ReadMany(ids []string) (map[string]*databank.Entry, map[string]error) {
+	return databank.ReadMany(d.next, ids)
+}
+
+// ReadRange reads part of an entry's content, starting at an offset.
+func (d *Driver) ReadRange(id string, offset, length int) ([]byte, bool, error) {
+	return databank.ReadRange(d.next, id, offset, length)
+}
+
+// Review entries, automatically expiring them as necessary.
+// A Review event is emitted for each entry expired.
+//
+// The entries expired are found by comparing storage before and after, so while there are subscribers, Review reads every entry.
+func (d *Driver) Review() (uint, bool, []error) {
+	before := d.peekAll(func(e *databank.Entry) bool {
+		return !e.Meta.Expired
+	})
+	n, ok, errs := d.next.Review()
+	if n == 0 || len(before) == 0 {
+		return n, ok, errs
+	}
+	after, readErrs := databank.ReadMany(d.next, sortedIDs(before))
+	for _, err := range readErrs {
+		errs = append(errs, err)
+	}
+	for _, id := range sortedIDs(before) {
+		if e, ok := after[id]; ok && e.Meta != nil && e.Meta.Expired {
+			d.emit(entryEvent(Review, id, e))
+		}
+	}
+	return n, ok, errs
+}
+
+// Scan for IDs.
+func (d *Driver) Scan() ([]string, bool, error) {
+	return d.next.Scan()
+}
+
+// Search entries.
+func (d *Driver) Search(q *databank.Query) (map[string]*databank.Entry, bool, error) {
+	return d.next.Search(q)
+}
+
+// Tagged finds the IDs of all entries with a tag set to the given value.
+func (d *Driver) Tagged(tag, value string) ([]string, bool, error) {
+	return databank.FindTagged(d.next, tag, value)
+}
+
+// Transact applies a set of operations.
+// Once the transaction is committed, an event is emitted for each of its operations, as with Write and Delete.
+func (d *Driver) Transact(expect map[string]string, ops []databank.TxOp) (bool, error) {
+	deleted := []string{}
+	for _, op := range ops {
+		if op.Entry == nil {
+			deleted = append(deleted, op.ID)
+		}
+	}
+	before := d.peek(deleted)
+	ok, err := databank.Transact(d.next, expect, ops)
+	if ok && err == nil {
+		for _, op := range ops {
+			if op.Entry != nil {
+				d.emit(writeEvent(op.Entry))
+			} else {
+				d.emit(entryEvent(Delete, op.ID, before[op.ID]))
+			}
+		}
+	}
+	return ok, err
+}
+
+// Watch for events.
+// Only events that pass the filter are delivered; if the filter is nil, all events are delivered.
+//
+// Events are buffered up to the given size.
+// If the subscriber does not keep up, further events are dropped until there is space in the buffer, at which point a Dropped event is delivered reporting how many were lost.
+func (d *Driver) Watch(f Filter, size int) *Subscription {
+	c := make(chan *Event, size)
+	s := &Subscription{
+		C: c,
+
+		c:      c,
+		d:      d,
+		filter: f,
+	}
+	d.mtx.Lock()
+	d.subs[s] = true
+	d.mtx.Unlock()
+	return s
+}
+
+// WithContext creates a copy of the Driver with the context bound to the next driver.
+// The copy shares its subscribers with the original.
+func (d *Driver) WithContext(ctx context.Context) databank.Driver {
+	c := *d
+	c.next = databank.WithContext(ctx, d.next)
+	return &c
+}
+
+// Write an entry to storage.
+// A Write event is emitted if successful, or an Expire event if the entry is expired.
+func (d *Driver) Write(e *databank.Entry) (bool, error) {
+	ok, err := d.next.Write(e)
+	if ok && err == nil {
+		d.emit(writeEvent(e))
+	}
+	return ok, err
+}
+
+// WriteMany writes multiple entries to storage.
+// An event is emitted for each entry written successfully, as with Write.
+func (d *Driver) WriteMany(entries []*databank.Entry) (map[string]bool, map[string]error) {
+	results, errs := databank.WriteMany(d.next, entries)
+	for _, e := range entries {
+		id := e.ID()
+		if _, failed := errs[id]; results[id] && !failed {
+			d.emit(writeEvent(e))
+		}
+	}
+	return results, errs
+}
+
+// emit an event to all subscribers.
+func (d *Driver) emit(ev *Event) {
+	ev.Time = time.Now()
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	for s := range d.subs {
+		s.send(ev)
+	}
+}
+
+// peek at entries before they are changed, so that events can describe them.
+// Entries are only read while there are subscribers; entries that cannot be read are omitted.
+//
+// Entries are cloned, as some drivers return the entries they store, which the change may then modify in place.
+func (d *Driver) peek(ids []string) map[string]*databank.Entry {
+	if !d.watched() || len(ids) == 0 {
+		return map[string]*databank.Entry{}
+	}
+	entries, _ := databank.ReadMany(d.next, ids)
+	for id, e := range entries {
+		entries[id] = e.Clone()
+	}
+	return entries
+}
+
+// peekAll peeks at every entry in storage that passes a filter.
+func (d *Driver) peekAll(f func(e *databank.Entry) bool) map[string]*databank.Entry {
+	if !d.watched() {
+		return map[string]*databank.Entry{}
+	}
+	ids, _, err := d.next.Scan()
+	if err != nil {
+		return map[string]*databank.Entry{}
+	}
+	entries := d.peek(ids)
+	for id, e := range entries {
+		if e.Meta == nil || !f(e) {
+			delete(entries, id)
+		}
+	}
+	return entries
+}
+
+// unsubscribe a subscription.
+func (d *Driver) unsubscribe(s *Subscription) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.subs, s)
+}
+
+// watched checks whether there are any subscribers.
+func (d *Driver) watched() bool {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return len(d.subs) > 0
+}
+
+// Close the writer, emitting a Write event if the entry is stored.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+	if err == nil {
+		w.d.emit(writeEvent(w.e))
+	}
+	return err
+}
+
+// entryEvent creates an event concerning a single entry.
+// If the entry is nil, e.g. it could not be read, only the ID is set.
+func entryEvent(t EventType, id string, e *databank.Entry) *Event {
+	ev := &Event{
+		Type: t,
+		ID:   id,
+	}
+	if e != nil {
+		ev.Key = e.Key
+		ev.Size = e.Size
+		if e.Meta != nil {
+			meta := *e.Meta
+			ev.Meta = &meta
+		}
+	}
+	return ev
+}
+
+// sortedIDs gets the IDs of entries in order, so that events are emitted consistently.
+func sortedIDs(entries map[string]*databank.Entry) []string {
+	ids := []string{}
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// writeEvent creates an event for an entry having been written.
+func writeEvent(e *databank.Entry) *Event {
+	ev := entryEvent(Write, e.ID(), e)
+	if ev.Meta != nil && ev.Meta.Expired {
+		ev.Type = Expire
+	}
+	return ev
+}
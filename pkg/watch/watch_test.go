@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WatchDriver(t *testing.T) {
+	dt := tests.NewTester(func() databank.Driver {
+		return New(atomicdb.New())
+	})
+	dt.Run(t)
+}
+
+func Test_WatchDriver_Events(t *testing.T) {
+	a := assert.New(t)
+	d := New(atomicdb.New())
+	db := databank.New(nil, d)
+	all := d.Watch(nil, 10)
+	deletes := d.Watch(Types(Delete, Flush), 10)
+	prefixed := d.Watch(Prefix("b"), 10)
+
+	db.WriteString("abc", "1")
+	db.WriteString("bcd", "2")
+	db.Expire("abc")
+	db.Delete("bcd")
+	db.Flush()
+
+	expected := []*Event{
+		{Type: Write, ID: "abc", Key: "abc", Size: 1},
+		{Type: Write, ID: "bcd", Key: "bcd", Size: 1},
+		{Type: Expire, ID: "abc", Key: "abc", Size: 1},
+		{Type: Delete, ID: "bcd", Key: "bcd", Size: 1},
+		{Type: Flush},
+	}
+	for _, exp := range expected {
+		ev := <-all.C
+		a.Equal(exp.Type, ev.Type)
+		a.Equal(exp.ID, ev.ID)
+		a.Equal(exp.Key, ev.Key)
+		a.Equal(exp.Size, ev.Size)
+		a.False(ev.Time.IsZero())
+		if exp.Type != Flush {
+			a.NotNil(ev.Meta)
+		}
+		if exp.Type == Expire {
+			// the entry as it was before it was expired, although the atomic driver expires it in place
+			a.False(ev.Meta.Expired)
+		}
+	}
+	a.Equal(Delete, (<-deletes.C).Type)
+	a.Equal(Flush, (<-deletes.C).Type)
+	a.Equal("bcd", (<-prefixed.C).ID)
+	a.Equal(Delete, (<-prefixed.C).Type)
+	a.Equal(Flush, (<-prefixed.C).Type)
+
+	all.Close()
+	_, open := <-all.C
+	a.False(open)
+	db.WriteString("bcd", "1")
+	a.Equal(Write, (<-prefixed.C).Type)
+}
+
+func Test_WatchDriver_Expiry(t *testing.T) {
+	a := assert.New(t)
+	d := New(atomicdb.New())
+	db := databank.New(nil, d)
+
+	e := db.NewEntry("abc")
+	e.Meta.Expires = e.Meta.Created.Add(-time.Second)
+	e.Meta.ExpiresNever = false
+	e.Tags["tag"] = "value"
+	e.WriteString("1")
+	db.Write(e)
+	db.WriteString("bcd", "2")
+	db.WriteString("cde", "3")
+	db.Expire("cde")
+
+	s := d.Watch(nil, 10)
+	n, _ := db.Review()
+	a.Equal(uint(1), n)
+	ev := <-s.C
+	a.Equal(Review, ev.Type)
+	a.Equal(e.ID(), ev.ID)
+	a.Equal("abc", ev.Key)
+	a.True(ev.Meta.Expired)
+
+	n, _ = db.Cleanup()
+	a.Equal(uint(2), n)
+	for _, id := range []string{e.ID(), "cde"} {
+		ev := <-s.C
+		a.Equal(Cleanup, ev.Type)
+		a.Equal(id, ev.ID)
+		a.Equal(1, ev.Size)
+		a.True(ev.Meta.Expired)
+	}
+	a.Empty(s.C)
+}
+
+func Test_WatchDriver_Stream(t *testing.T) {
+	a := assert.New(t)
+	d := New(atomicdb.New())
+	db := databank.New(nil, d)
+	sub := d.Watch(nil, 10)
+
+	// streamed writes emit an event once stored
+	w := db.Create("key")
+	w.Write([]byte("abc"))
+	a.Len(sub.C, 0)
+	a.Nil(w.Close())
+	ev := <-sub.C
+	a.Equal(Write, ev.Type)
+	a.Equal("key", ev.ID)
+	a.Equal(3, ev.Size)
+
+	r, ok := db.OpenReader("key")
+	a.True(ok)
+	r.Close()
+	a.Len(sub.C, 0)
+}
+
+func Test_WatchDriver_Dropped(t *testing.T) {
+	a := assert.New(t)
+	d := New(atomicdb.New())
+	db := databank.New(nil, d)
+	s := d.Watch(nil, 2)
+
+	for i := 0; i < 5; i++ {
+		db.WriteString("abc", "1")
+	}
+	a.Equal(uint64(3), s.Dropped())
+	a.Equal(Write, (<-s.C).Type)
+	a.Equal(Write, (<-s.C).Type)
+
+	db.Delete("abc")
+	ev := <-s.C
+	a.Equal(Dropped, ev.Type)
+	a.Equal(uint(3), ev.N)
+	a.Equal(Delete, (<-s.C).Type)
+	a.Equal(uint64(3), s.Dropped())
+}
@@ -0,0 +1,207 @@
+package databank
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTxConflict is returned when a transaction cannot be committed because an entry it read has since changed.
+	ErrTxConflict = errors.New("transaction conflict")
+	// ErrTxDone is returned when a transaction is used after it has been committed or rolled back.
+	ErrTxDone = errors.New("transaction is done")
+	// ErrTxFailed is returned when a driver fails to commit a transaction without raising an error of its own.
+	ErrTxFailed = errors.New("transaction failed")
+	// ErrTxNotAtomic is returned when a transaction fails partway through being committed by a driver that is not atomic.
+	// Some of its operations will have been applied.
+	ErrTxNotAtomic = errors.New("transaction was not committed atomically")
+)
+
+// Tx is a transaction over multiple entries.
+//
+// Operations are recorded in the transaction and not applied to storage until it is committed.
+// Conflicts are detected optimistically: if any entry read in the transaction has changed in storage by the time it is committed, the commit fails with ErrTxConflict.
+// Writes and deletes of entries that were not read in the transaction are applied regardless.
+//
+// A Tx is not safe for concurrent use.
+type Tx struct {
+	db *databank
+
+	done   bool
+	expect map[string]string
+	ops    []TxOp
+	writes map[string]int
+}
+
+// TxOp is a single operation in a transaction.
+// If Entry is nil, the ID is deleted. Otherwise, Entry is written.
+type TxOp struct {
+	ID    string `json:"id"`
+	Entry *Entry `json:"entry"`
+}
+
+// Transact applies a set of operations to a driver.
+//
+// If the driver implements Transactor, the operations are passed to it, and are applied atomically if it reports so (see Atomic).
+// Otherwise, expected versions are checked and then operations are applied in sequence.
+// If an operation fails after others have been applied, an error wrapping ErrTxNotAtomic is returned.
+func Transact(d Driver, expect map[string]string, ops []TxOp) (bool, error) {
+	if t, ok := d.(Transactor); ok {
+		return t.Transact(expect, ops)
+	}
+	for id, v := range expect {
+		e, _, err := d.Read(id)
+		if err != nil {
+			return false, err
+		}
+		if Version(e) != v {
+			return false, ErrTxConflict
+		}
+	}
+	for i, op := range ops {
+		var ok bool
+		var err error
+		if op.Entry != nil {
+			ok, err = d.Write(op.Entry)
+		} else {
+			ok, err = d.Delete(op.ID)
+		}
+		if err == nil && ok {
+			continue
+		}
+		if i == 0 {
+			return ok, err
+		}
+		if err == nil {
+			err = fmt.Errorf("operation on %s failed", op.ID)
+		}
+		return false, fmt.Errorf("%w: %d of %d operations applied: %v", ErrTxNotAtomic, i, len(ops), err)
+	}
+	return true, nil
+}
+
+// Version calculates the version of an entry, which changes whenever the entry is modified.
+// This is used to detect conflicts in transactions.
+//
+// If the entry is nil, i.e. does not exist, the version is an empty string.
+func Version(e *Entry) string {
+	if e == nil {
+		return ""
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		// this should never happen, but if it does, the entry should never match any other version
+		return fmt.Sprintf("error: %s", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// Atomic reports whether the transaction will be committed atomically.
+// If not, a failed commit may be partially applied.
+//
+// This reflects every driver the transaction passes through, including middlewares, down to the storage that applies it.
+func (tx *Tx) Atomic() bool {
+	return Atomic(tx.db.driver)
+}
+
+// Commit the transaction, applying all of its operations to storage.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	ok, err := Transact(tx.db.driver, tx.expect, tx.ops)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTxFailed
+	}
+	return nil
+}
+
+// Delete an entry in the transaction.
+func (tx *Tx) Delete(id string) error {
+	return tx.record(TxOp{ID: id})
+}
+
+// Read an entry in the transaction.
+//
+// If the entry has been written or deleted in the transaction, that is reflected in the result.
+// Otherwise, the entry is read from storage and its version is recorded for conflict detection.
+// The entry returned is a copy, so it can be modified and written back safely.
+func (tx *Tx) Read(id string) (*Entry, bool, error) {
+	if tx.done {
+		return nil, false, ErrTxDone
+	}
+	if i, ok := tx.writes[id]; ok {
+		if e := tx.ops[i].Entry; e != nil {
+			return e.Clone(), true, nil
+		}
+		return nil, false, nil
+	}
+	e, ok, err := tx.db.driver.Read(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, read := tx.expect[id]; !read {
+		if ok {
+			tx.expect[id] = Version(e)
+		} else {
+			tx.expect[id] = Version(nil)
+		}
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if !tx.db.config.Hot && e.ShouldExpire() {
+		return nil, false, nil
+	}
+	return e.Clone(), true, nil
+}
+
+// Rollback the transaction, discarding all of its operations.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+// Write an entry in the transaction.
+// The entry is copied, so changes made to it after writing are not committed.
+func (tx *Tx) Write(e *Entry) error {
+	e.CalculateSize()
+	return tx.record(TxOp{ID: e.ID(), Entry: e.Clone()})
+}
+
+// record an operation, replacing any prior operation on the same ID.
+func (tx *Tx) record(op TxOp) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if i, ok := tx.writes[op.ID]; ok {
+		tx.ops[i] = op
+		return nil
+	}
+	tx.writes[op.ID] = len(tx.ops)
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+func (d *databank) Begin() *Tx {
+	return &Tx{
+		db: d,
+
+		expect: map[string]string{},
+		ops:    []TxOp{},
+		writes: map[string]int{},
+	}
+}
@@ -0,0 +1,51 @@
+package databank_test
+
+import (
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/edge/databank/pkg/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// basic is a driver that implements no optional Driver extensions.
+type basic struct {
+	databank.Driver
+}
+
+func Test_Tx_Atomic(t *testing.T) {
+	a := assert.New(t)
+	passthrough := func(next databank.Driver) databank.Driver {
+		return databank.NewPassthrough(next)
+	}
+	intercept := databank.InterceptMiddleware(func(c *databank.Call, next databank.Handler) *databank.Result {
+		return next(c)
+	})
+
+	a.True(databank.New(nil, atomicdb.New()).Begin().Atomic())
+	a.False(databank.New(nil, &basic{atomicdb.New()}).Begin().Atomic())
+
+	// wrappers are only as atomic as the driver they wrap
+	a.True(databank.New(nil, atomicdb.New(), databank.WithMiddleware(passthrough, intercept)).Begin().Atomic())
+	a.False(databank.New(nil, &basic{atomicdb.New()}, databank.WithMiddleware(passthrough, intercept)).Begin().Atomic())
+
+	a.True(databank.New(nil, proxy.NewSync(atomicdb.New(), atomicdb.New())).Begin().Atomic())
+	a.False(databank.New(nil, proxy.NewSync(&basic{atomicdb.New()}, atomicdb.New())).Begin().Atomic())
+}
+
+func Test_Tx_Write(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New())
+
+	tx := db.Begin()
+	e := db.NewEntry("key")
+	e.WriteString("abc")
+	a.Nil(tx.Write(e))
+	// changes after writing are not committed
+	e.WriteString("def")
+	a.Nil(tx.Commit())
+	v, ok := db.ReadString("key")
+	a.True(ok)
+	a.Equal("abc", v)
+}
@@ -0,0 +1,80 @@
+package databank
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWriteFailed is returned when a Databank fails to write an entry without raising an error of its own.
+var ErrWriteFailed = errors.New("write failed")
+
+// Typed is a view over a Databank that stores values of a single type, encoded with a codec.
+// Entries are identified by key and tags, as with EntryID.
+//
+//	users := databank.NewTyped[User](db, databank.JSON)
+//	err := users.Set("alice", nil, User{Name: "Alice"})
+//	u, ok, err := users.Get("alice", nil)
+type Typed[T any] struct {
+	codec Codec
+	db    Databank
+}
+
+// NewTyped creates a typed view over a Databank.
+// If the codec is nil, JSON is used.
+func NewTyped[T any](db Databank, c Codec) *Typed[T] {
+	if c == nil {
+		c = JSON
+	}
+	return &Typed[T]{
+		codec: c,
+		db:    db,
+	}
+}
+
+// Delete a value.
+func (t *Typed[T]) Delete(key string, tags map[string]string) bool {
+	return t.db.Delete(EntryID(key, tags))
+}
+
+// Get a value.
+// This returns false if there is no value, or an error if the stored value cannot be decoded as T.
+func (t *Typed[T]) Get(key string, tags map[string]string) (T, bool, error) {
+	var v T
+	e, ok := t.db.Read(EntryID(key, tags))
+	if !ok {
+		return v, false, nil
+	}
+	if err := e.ReadValue(t.codec, &v); err != nil {
+		return v, true, err
+	}
+	return v, true, nil
+}
+
+// GetOrLoad gets a value, or loads and sets it if there is none.
+// If the stored value cannot be decoded as T, it is replaced.
+// If the loaded value cannot be set, it is still returned along with the error.
+func (t *Typed[T]) GetOrLoad(key string, tags map[string]string, load func() (T, error)) (T, error) {
+	if v, ok, err := t.Get(key, tags); ok && err == nil {
+		return v, nil
+	}
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	return v, t.Set(key, tags, v)
+}
+
+// Set a value.
+func (t *Typed[T]) Set(key string, tags map[string]string, v T) error {
+	e := t.db.NewEntry(key)
+	for k, tv := range tags {
+		e.Tags[k] = tv
+	}
+	if err := e.WriteValue(t.codec, v); err != nil {
+		return err
+	}
+	if !t.db.Write(e) {
+		return fmt.Errorf("%w: %s", ErrWriteFailed, e.ID())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package databank_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/edge/databank"
+	atomicdb "github.com/edge/databank/pkg/atomic"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Typed(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New())
+	users := databank.NewTyped[user](db, databank.Gob)
+	tags := map[string]string{"region": "eu"}
+
+	_, ok, err := users.Get("alice", tags)
+	a.False(ok)
+	a.Nil(err)
+
+	a.Nil(users.Set("alice", tags, user{Name: "alice"}))
+	u, ok, err := users.Get("alice", tags)
+	a.True(ok)
+	a.Nil(err)
+	a.Equal("alice", u.Name)
+
+	// tags are part of identity
+	_, ok, _ = users.Get("alice", nil)
+	a.False(ok)
+
+	a.True(users.Delete("alice", tags))
+	_, ok, _ = users.Get("alice", tags)
+	a.False(ok)
+
+	// values of another type are refused
+	db.WriteString("bob", "bob")
+	_, ok, err = users.Get("bob", nil)
+	a.True(ok)
+	a.True(errors.Is(err, databank.ErrTypeMismatch))
+}
+
+func Test_Typed_GetOrLoad(t *testing.T) {
+	a := assert.New(t)
+	db := databank.New(nil, atomicdb.New())
+	counts := databank.NewTyped[int](db, nil)
+
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return 42, nil
+	}
+	for i := 0; i < 3; i++ {
+		v, err := counts.GetOrLoad("answer", nil, load)
+		a.Nil(err)
+		a.Equal(42, v)
+	}
+	a.Equal(1, loads)
+
+	failed := errors.New("failed")
+	_, err := counts.GetOrLoad("question", nil, func() (int, error) {
+		return 0, failed
+	})
+	a.Equal(failed, err)
+	a.False(db.Has("question"))
+}